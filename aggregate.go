@@ -25,10 +25,14 @@ type AggregateRoot interface {
 // All required methods to implement an aggregate are here, to implement the
 // Aggregate root interface your aggregate will need to implement the Apply
 // method that will contain behaviour specific to your aggregate.
+//
+// Instead of a switch over the events in Apply, aggregates can register a
+// typed handler per event with On and raise events with Raise, see On.
 type AggregateBase struct {
 	id      string
 	version int
 	changes []EventMessage
+	routes  []eventRoute
 }
 
 // NewAggregateBase contructs a new AggregateBase.
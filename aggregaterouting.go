@@ -0,0 +1,127 @@
+package ycq
+
+// eventRoute applies the event when it is of the type the route was registered
+// for and reports whether it did.
+type eventRoute func(event EventMessage) bool
+
+// On registers fn as the handler of the events of type T on the aggregate.
+//
+// T is either the type of an Event implementation, e.g. *ItemCreated, or the
+// payload type of a TypedEvent, e.g. ItemCreated for *TypedEvent[ItemCreated].
+// Handlers are usually registered in the constructor of the aggregate:
+//
+//	func NewItem(id string) *Item {
+//		item := &Item{AggregateBase: ycq.NewAggregateBase(id)}
+//		ycq.On(item.AggregateBase, item.onCreated)
+//		return item
+//	}
+//
+//	func (a *Item) Rename(name string) error {
+//		return a.Raise(ycq.NewTypedEvent(ItemRenamed{Name: name}))
+//	}
+//
+// Raise returns the error of the handler. The repositories load aggregates
+// with registered handlers through Rebuild, as RebuildAggregate does with the
+// events at hand, so an event without a handler fails the command or the load
+// with ErrUnhandledEvent:
+//
+//	item := NewItem(id)
+//	if err := ycq.RebuildAggregate(item, events); err != nil {
+//		return err
+//	}
+//
+// Apply and RebuildFromEvents are still required by AggregateRoot, they are
+// not called for aggregates with registered handlers and can be left empty:
+//
+//	func (a *Item) Apply(event ycq.EventMessage) {}
+//
+//	func (a *Item) RebuildFromEvents(events []ycq.EventMessage) {}
+func On[T any](a *AggregateBase, fn func(T)) {
+	a.routes = append(a.routes, func(event EventMessage) bool {
+		switch e := event.Event().(type) {
+		case T:
+			fn(e)
+		case *TypedEvent[T]:
+			fn(e.Payload())
+		default:
+			return false
+		}
+
+		return true
+	})
+}
+
+// ApplyEvent calls the handler registered with On for the event.
+//
+// ErrUnhandledEvent is returned when no handler is registered for the event.
+func (a *AggregateBase) ApplyEvent(event EventMessage) error {
+	for _, route := range a.routes {
+		if route(event) {
+			return nil
+		}
+	}
+
+	return &ErrUnhandledEvent{
+		AggregateID: a.id,
+		EventName:   event.Event().Name(),
+	}
+}
+
+// Raise applies a new event to the aggregate with the handler registered with
+// On and tracks it as a change at the next version of the aggregate.
+//
+// Nothing is tracked when no handler is registered for the event.
+func (a *AggregateBase) Raise(event Event) error {
+	em := NewEventMessage(nil, event, Int(a.CurrentVersion()+1))
+	if err := a.ApplyEvent(em); err != nil {
+		return err
+	}
+
+	a.TrackChange(em)
+	return nil
+}
+
+// Rebuild applies the events loaded from a stream with the handlers registered
+// with On and increments the version for each of them.
+//
+// It stops at the first event without a handler and returns ErrUnhandledEvent.
+func (a *AggregateBase) Rebuild(events []EventMessage) error {
+	for _, event := range events {
+		if err := a.ApplyEvent(event); err != nil {
+			return err
+		}
+		a.IncrementVersion()
+	}
+
+	return nil
+}
+
+// routesEvents reports whether handlers were registered with On.
+func (a *AggregateBase) routesEvents() bool {
+	return len(a.routes) > 0
+}
+
+// RebuildAggregate applies the events loaded from the stream of the aggregate
+// the way the repositories do: through Rebuild when handlers were registered
+// with On, so an event without a handler fails with ErrUnhandledEvent, and
+// through RebuildFromEvents otherwise. The error recorded by the
+// RebuildFromEvents of a ProcessManagerBase is returned.
+func RebuildAggregate(aggregate AggregateRoot, events []EventMessage) error {
+	if r, ok := aggregate.(eventRouter); ok && r.routesEvents() {
+		return r.Rebuild(events)
+	}
+
+	aggregate.RebuildFromEvents(events)
+	if r, ok := aggregate.(interface{ rebuildError() error }); ok {
+		return r.rebuildError()
+	}
+
+	return nil
+}
+
+// eventRouter is implemented by aggregates embedding an AggregateBase, the
+// repositories rebuild the aggregates with registered handlers through Rebuild.
+type eventRouter interface {
+	routesEvents() bool
+	Rebuild(events []EventMessage) error
+}
@@ -0,0 +1,102 @@
+package ycq
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AggregateRoutingSuite{})
+
+type AggregateRoutingSuite struct{}
+
+// routedAggregate routes SomeEvent and ItemAdded with On.
+type routedAggregate struct {
+	*AggregateBase
+	items []string
+	count int
+}
+
+func newRoutedAggregate(id string) *routedAggregate {
+	a := &routedAggregate{AggregateBase: NewAggregateBase(id)}
+	On(a.AggregateBase, a.onSomeEvent)
+	On(a.AggregateBase, a.onItemAdded)
+	return a
+}
+
+func (a *routedAggregate) onSomeEvent(e *SomeEvent) {
+	a.items = append(a.items, e.Item)
+}
+
+func (a *routedAggregate) onItemAdded(e ItemAdded) {
+	a.count += e.Count
+}
+
+func (a *routedAggregate) Apply(event EventMessage) {
+	_ = a.ApplyEvent(event)
+}
+
+func (a *routedAggregate) RebuildFromEvents(events []EventMessage) {
+	_ = a.Rebuild(events)
+}
+
+func (s *AggregateRoutingSuite) TestRaiseAppliesAndTracksEvents(c *C) {
+	agg := newRoutedAggregate(NewUUID())
+
+	c.Assert(agg.Raise(&SomeEvent{Item: "a"}), IsNil)
+	c.Assert(agg.Raise(NewTypedEvent(ItemAdded{Item: "b", Count: 2})), IsNil)
+
+	c.Assert(agg.items, DeepEquals, []string{"a"})
+	c.Assert(agg.count, Equals, 2)
+	c.Assert(agg.GetChanges(), HasLen, 2)
+	c.Assert(*agg.GetChanges()[0].Version(), Equals, 1)
+	c.Assert(*agg.GetChanges()[1].Version(), Equals, 2)
+	c.Assert(agg.CurrentVersion(), Equals, 2)
+}
+
+func (s *AggregateRoutingSuite) TestRaiseOfUnhandledEventFails(c *C) {
+	agg := newRoutedAggregate(NewUUID())
+
+	err := agg.Raise(&SomeOtherEvent{})
+	c.Assert(err, DeepEquals, &ErrUnhandledEvent{AggregateID: agg.AggregateID(), EventName: "SomeOtherEvent"})
+	c.Assert(agg.GetChanges(), HasLen, 0)
+}
+
+func (s *AggregateRoutingSuite) TestRepositoryRebuildsWithRegisteredHandlers(c *C) {
+	ctx := context.Background()
+	repo, err := NewSqlDomainRepository(NewInMemoryEventRepository(), NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	factory.RegisterDelegate("SomeEvent", func() Event { return &SomeEvent{} })
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+	repo.SetEventFactory(factory)
+
+	id := NewUUID()
+	agg := newRoutedAggregate(id)
+	c.Assert(agg.Raise(&SomeEvent{Item: "a"}), IsNil)
+	c.Assert(agg.Raise(NewTypedEvent(ItemAdded{Count: 3})), IsNil)
+	c.Assert(repo.Save(ctx, id, agg, Int(0)), IsNil)
+
+	got := newRoutedAggregate(id)
+	c.Assert(repo.Load(ctx, id, got), IsNil)
+	c.Assert(got.count, Equals, 3)
+	c.Assert(got.CurrentVersion(), Equals, 2)
+}
+
+func (s *AggregateRoutingSuite) TestRepositoryLoadFailsOnUnhandledEvent(c *C) {
+	ctx := context.Background()
+	eventRepo := NewInMemoryEventRepository()
+	repo, err := NewSqlDomainRepository(eventRepo, NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	factory.RegisterDelegate("SomeOtherEvent", func() Event { return &SomeOtherEvent{} })
+	repo.SetEventFactory(factory)
+
+	id := NewUUID()
+	c.Assert(eventRepo.Append(ctx, id, []EventMessage{NewEventMessage(nil, &SomeOtherEvent{}, nil)}, nil), IsNil)
+
+	err = repo.Load(ctx, id, newRoutedAggregate(id))
+	c.Assert(err, FitsTypeOf, &ErrUnhandledEvent{})
+}
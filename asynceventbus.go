@@ -0,0 +1,274 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAsyncEventBusWorkers   = 4
+	defaultAsyncEventBusQueueSize = 100
+)
+
+// AsyncEventBusOptions configures an AsyncEventBus.
+type AsyncEventBusOptions struct {
+	// Workers is the number of goroutines delivering events. Defaults to 4.
+	Workers int
+
+	// QueueSize is the capacity of the queue of every worker. PublishEvent
+	// blocks while the queue of the event is full. Defaults to 100.
+	QueueSize int
+
+	// PartitionKey returns the key events are ordered by, events with the same
+	// key are delivered by the same worker in publish order. Defaults to the id
+	// of the stream the event belongs to.
+	PartitionKey func(EventMessage) string
+
+	// OnError is called with the ErrPublishFailed of every event error aware
+	// handlers failed to handle. Publishers can't be told about failures that
+	// happen after PublishEvent returned, they are collected here instead.
+	OnError func(error)
+}
+
+// AsyncEventBusMetrics is a snapshot of the state of an AsyncEventBus.
+type AsyncEventBusMetrics struct {
+	// QueueDepth is the number of events waiting to be delivered.
+	QueueDepth int
+
+	// QueueDepths is the number of events waiting in the queue of every worker.
+	QueueDepths []int
+
+	// Published, Delivered, Failed and Dropped count the events accepted by
+	// PublishEvent, the events all their handlers handled, the events
+	// handlers failed to handle and the events published after Shutdown.
+	// Every published event is eventually either delivered or failed.
+	Published uint64
+	Delivered uint64
+	Failed    uint64
+	Dropped   uint64
+}
+
+// AsyncEventBus is an in process event bus that delivers events to the handlers
+// on a pool of worker goroutines.
+//
+// Events are partitioned over the workers by stream, events of the same stream
+// are delivered in the order they were published while streams are delivered
+// concurrently.
+type AsyncEventBus struct {
+	// The counters come first to keep them 64-bit aligned for atomic access.
+	published uint64
+	delivered uint64
+	failed    uint64
+	dropped   uint64
+
+	mu            sync.RWMutex
+	eventHandlers map[string]map[EventHandler]struct{}
+
+	// queuesMu guards closed, the queues are closed once closed is set and
+	// the publishers that were sending returned.
+	queuesMu   sync.RWMutex
+	queues     []chan queuedEvent
+	closed     bool
+	done       chan struct{}
+	publishing sync.WaitGroup
+	wg         sync.WaitGroup
+
+	partitionKey func(EventMessage) string
+	onError      func(error)
+}
+
+// NewAsyncEventBus constructs an AsyncEventBus and starts its workers.
+func NewAsyncEventBus(options AsyncEventBusOptions) *AsyncEventBus {
+	if options.Workers <= 0 {
+		options.Workers = defaultAsyncEventBusWorkers
+	}
+
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultAsyncEventBusQueueSize
+	}
+
+	if options.PartitionKey == nil {
+		options.PartitionKey = func(event EventMessage) string {
+			streamId, _ := EventStreamId(event)
+			return streamId
+		}
+	}
+
+	b := &AsyncEventBus{
+		eventHandlers: make(map[string]map[EventHandler]struct{}),
+		queues:        make([]chan queuedEvent, options.Workers),
+		done:          make(chan struct{}),
+		partitionKey:  options.PartitionKey,
+		onError:       options.OnError,
+	}
+
+	for i := range b.queues {
+		b.queues[i] = make(chan queuedEvent, options.QueueSize)
+		b.wg.Add(1)
+		go b.work(b.queues[i])
+	}
+
+	return b
+}
+
+// PublishEvent queues the event for delivery to all registered event handlers.
+//
+// The handlers get the values of ctx but not its deadline and cancellation,
+// the event is delivered after PublishEvent returned. ctx only bounds the wait
+// for room in a full queue.
+//
+// Events published after Shutdown, or whose ctx is done before they could be
+// queued, are dropped and an error is returned. A publish waiting for room in
+// a full queue when Shutdown is called is dropped too. Failures of the handlers
+// are reported to OnError.
+func (b *AsyncEventBus) PublishEvent(ctx context.Context, event EventMessage) error {
+	b.queuesMu.RLock()
+	if b.closed {
+		b.queuesMu.RUnlock()
+		return b.drop(event)
+	}
+	b.publishing.Add(1)
+	b.queuesMu.RUnlock()
+	defer b.publishing.Done()
+
+	select {
+	case b.queues[b.partition(event)] <- queuedEvent{ctx: detachedContext{ctx}, event: event}:
+		atomic.AddUint64(&b.published, 1)
+		return nil
+	case <-b.done:
+		return b.drop(event)
+	case <-ctx.Done():
+		atomic.AddUint64(&b.dropped, 1)
+		return ctx.Err()
+	}
+}
+
+func (b *AsyncEventBus) drop(event EventMessage) error {
+	atomic.AddUint64(&b.dropped, 1)
+	return fmt.Errorf("event bus is shut down, event %s dropped", event.Event().Name())
+}
+
+// AddHandler registers an event handler for all of the events specified in the
+// variadic events parameter.
+func (b *AsyncEventBus) AddHandler(handler EventHandler, events ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	addHandler(b.eventHandlers, handler, events...)
+}
+
+// RemoveHandler unregisters an event handler from the events specified in the
+// variadic events parameter, or from all events when none are specified.
+//
+// Events already queued are not delivered to the removed handler.
+func (b *AsyncEventBus) RemoveHandler(handler EventHandler, events ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removeHandler(b.eventHandlers, handler, events...)
+}
+
+// Shutdown stops accepting events and waits until the queued events were
+// delivered or ctx is done.
+func (b *AsyncEventBus) Shutdown(ctx context.Context) error {
+	b.queuesMu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+
+		// No publisher starts sending once closed is set, the ones blocked
+		// on a full queue return once done is closed.
+		go func() {
+			b.publishing.Wait()
+			for _, q := range b.queues {
+				close(q)
+			}
+		}()
+	}
+	b.queuesMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Metrics returns the current queue depths and event counters.
+func (b *AsyncEventBus) Metrics() AsyncEventBusMetrics {
+	m := AsyncEventBusMetrics{
+		QueueDepths: make([]int, len(b.queues)),
+		Published:   atomic.LoadUint64(&b.published),
+		Delivered:   atomic.LoadUint64(&b.delivered),
+		Failed:      atomic.LoadUint64(&b.failed),
+		Dropped:     atomic.LoadUint64(&b.dropped),
+	}
+
+	for i, q := range b.queues {
+		m.QueueDepths[i] = len(q)
+		m.QueueDepth += len(q)
+	}
+
+	return m
+}
+
+func (b *AsyncEventBus) partition(event EventMessage) int {
+	h := fnv.New32a()
+	h.Write([]byte(b.partitionKey(event)))
+
+	return int(h.Sum32() % uint32(len(b.queues)))
+}
+
+func (b *AsyncEventBus) work(queue <-chan queuedEvent) {
+	defer b.wg.Done()
+
+	for q := range queue {
+		err := deliverEvent(q.ctx, handlersOf(&b.mu, b.eventHandlers, q.event.Event().Name()), q.event)
+		if err != nil {
+			atomic.AddUint64(&b.failed, 1)
+			if b.onError != nil {
+				b.onError(err)
+			}
+			continue
+		}
+		atomic.AddUint64(&b.delivered, 1)
+	}
+}
+
+type queuedEvent struct {
+	ctx   context.Context
+	event EventMessage
+}
+
+// detachedContext carries the values of its parent without its deadline and
+// cancellation, so that a queued event outlives the publish that queued it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
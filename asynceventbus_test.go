@@ -0,0 +1,226 @@
+package ycq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AsyncEventBusSuite{})
+
+type AsyncEventBusSuite struct {
+	bus *AsyncEventBus
+}
+
+func (s *AsyncEventBusSuite) TearDownTest(c *C) {
+	if s.bus != nil {
+		s.bus.Shutdown(context.Background())
+	}
+}
+
+// recordingEventHandler records the events it handles, it is safe for
+// concurrent use and can block until released.
+type recordingEventHandler struct {
+	mu       sync.Mutex
+	events   []EventMessage
+	contexts []context.Context
+	release  chan struct{}
+}
+
+func (h *recordingEventHandler) Handle(ctx context.Context, event EventMessage) {
+	if h.release != nil {
+		<-h.release
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+	h.contexts = append(h.contexts, ctx)
+}
+
+func (h *recordingEventHandler) handled() []EventMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]EventMessage(nil), h.events...)
+}
+
+func (h *recordingEventHandler) handledContexts() []context.Context {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]context.Context(nil), h.contexts...)
+}
+
+type testContextKey struct{}
+
+func newStreamEvent(streamId string, version int) EventMessage {
+	ev := NewEventMessage(nil, &SomeEvent{Item: streamId, Count: version}, Int(version))
+	ev.SetHeader(HeaderStreamId, streamId)
+
+	return ev
+}
+
+func (s *AsyncEventBusSuite) TestDeliversInOrderPerStream(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{Workers: 4})
+	handler := &recordingEventHandler{}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	streams := []string{"a", "b", "c", "d", "e"}
+	for v := 1; v <= 50; v++ {
+		for _, stream := range streams {
+			s.bus.PublishEvent(context.Background(), newStreamEvent(stream, v))
+		}
+	}
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+
+	last := map[string]int{}
+	for _, ev := range handler.handled() {
+		streamId, _ := EventStreamId(ev)
+		c.Assert(*ev.Version(), Equals, last[streamId]+1)
+		last[streamId] = *ev.Version()
+	}
+	c.Assert(handler.handled(), HasLen, 250)
+	c.Assert(s.bus.Metrics().Delivered, Equals, uint64(250))
+}
+
+func (s *AsyncEventBusSuite) TestPublishDoesNotWaitForHandlers(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{Workers: 1, QueueSize: 10})
+	handler := &recordingEventHandler{release: make(chan struct{})}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	for v := 1; v <= 5; v++ {
+		s.bus.PublishEvent(context.Background(), newStreamEvent("a", v))
+	}
+
+	// One event is held by the blocked handler, the rest wait in the queue.
+	deadline := time.Now().Add(5 * time.Second)
+	for s.bus.Metrics().QueueDepth != 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	metrics := s.bus.Metrics()
+	c.Assert(metrics.QueueDepth, Equals, 4)
+	c.Assert(metrics.QueueDepths, DeepEquals, []int{4})
+	c.Assert(metrics.Published, Equals, uint64(5))
+	c.Assert(handler.handled(), HasLen, 0)
+
+	close(handler.release)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+	c.Assert(handler.handled(), HasLen, 5)
+}
+
+func (s *AsyncEventBusSuite) TestShutdownDropsLaterEvents(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{})
+	handler := &recordingEventHandler{}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+	s.bus.PublishEvent(context.Background(), newStreamEvent("a", 1))
+
+	c.Assert(handler.handled(), HasLen, 0)
+	c.Assert(s.bus.Metrics().Dropped, Equals, uint64(1))
+}
+
+func (s *AsyncEventBusSuite) TestShutdownHonoursContext(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{Workers: 1})
+	handler := &recordingEventHandler{release: make(chan struct{})}
+	s.bus.AddHandler(handler, "SomeEvent")
+	s.bus.PublishEvent(context.Background(), newStreamEvent("a", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(s.bus.Shutdown(ctx), Equals, context.DeadlineExceeded)
+
+	close(handler.release)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+	c.Assert(handler.handled(), HasLen, 1)
+}
+
+func (s *AsyncEventBusSuite) TestHandlersGetContextValuesWithoutCancellation(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{})
+	handler := &recordingEventHandler{release: make(chan struct{})}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "trace"))
+	c.Assert(s.bus.PublishEvent(ctx, newStreamEvent("a", 1)), IsNil)
+	cancel()
+
+	close(handler.release)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+
+	contexts := handler.handledContexts()
+	c.Assert(contexts, HasLen, 1)
+	c.Assert(contexts[0].Value(testContextKey{}), Equals, "trace")
+	c.Assert(contexts[0].Err(), IsNil)
+}
+
+func (s *AsyncEventBusSuite) TestPublishHonoursContextWhenQueueIsFull(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{Workers: 1, QueueSize: 1})
+	handler := &recordingEventHandler{release: make(chan struct{})}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	// The first event blocks the worker, the second fills the queue.
+	c.Assert(s.bus.PublishEvent(context.Background(), newStreamEvent("a", 1)), IsNil)
+	for s.bus.Metrics().QueueDepth > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(s.bus.PublishEvent(context.Background(), newStreamEvent("a", 2)), IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(s.bus.PublishEvent(ctx, newStreamEvent("a", 3)), Equals, context.DeadlineExceeded)
+	c.Assert(s.bus.Metrics().Dropped, Equals, uint64(1))
+
+	close(handler.release)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+	c.Assert(handler.handled(), HasLen, 2)
+}
+
+func (s *AsyncEventBusSuite) TestShutdownReleasesPublishWaitingForFullQueue(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{Workers: 1, QueueSize: 1})
+	handler := &recordingEventHandler{release: make(chan struct{})}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	c.Assert(s.bus.PublishEvent(context.Background(), newStreamEvent("a", 1)), IsNil)
+	for s.bus.Metrics().QueueDepth > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(s.bus.PublishEvent(context.Background(), newStreamEvent("a", 2)), IsNil)
+
+	published := make(chan error)
+	go func() {
+		published <- s.bus.PublishEvent(context.Background(), newStreamEvent("a", 3))
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(s.bus.Shutdown(ctx), Equals, context.DeadlineExceeded)
+	c.Assert(<-published, ErrorMatches, "event bus is shut down, .*")
+	c.Assert(s.bus.Metrics().Dropped, Equals, uint64(1))
+
+	close(handler.release)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+	c.Assert(handler.handled(), HasLen, 2)
+}
+
+func (s *AsyncEventBusSuite) TestSqlDomainRepoPublishesWithStreamId(c *C) {
+	s.bus = NewAsyncEventBus(AsyncEventBusOptions{})
+	handler := &recordingEventHandler{}
+	s.bus.AddHandler(handler, "SomeEvent")
+
+	repo, err := NewSqlDomainRepository(NewInMemoryEventRepository(), s.bus)
+	c.Assert(err, IsNil)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+	c.Assert(repo.Save(context.Background(), id, agg, Int(0)), IsNil)
+	c.Assert(s.bus.Shutdown(context.Background()), IsNil)
+
+	c.Assert(handler.handled(), HasLen, 1)
+	streamId, _ := EventStreamId(handler.handled()[0])
+	c.Assert(streamId, Equals, id)
+}
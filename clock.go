@@ -0,0 +1,65 @@
+package ycq
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the parts of the package that act on it, such as the
+// CommandScheduler and the ProcessManagerRunner, so tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns the Clock of the system.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// clockFunc adapts a function returning the current time to a Clock.
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time {
+	return f()
+}
+
+// ManualClock is a Clock that only moves when it is set or advanced, it is
+// meant for tests.
+type ManualClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+// NewManualClock constructs a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+// Set sets the time of the clock.
+func (c *ManualClock) Set(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,29 @@
+package ycq
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ClockSuite{})
+
+type ClockSuite struct{}
+
+func (s *ClockSuite) TestManualClockOnlyMovesWhenTold(c *C) {
+	start := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	c.Assert(clock.Now(), Equals, start)
+
+	clock.Advance(time.Minute)
+	c.Assert(clock.Now(), Equals, start.Add(time.Minute))
+
+	clock.Set(start)
+	c.Assert(clock.Now(), Equals, start)
+}
+
+func (s *ClockSuite) TestSystemClock(c *C) {
+	before := time.Now()
+	now := SystemClock().Now()
+	c.Assert(now.Before(before), Equals, false)
+}
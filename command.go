@@ -40,6 +40,25 @@ func NewCommandMessage(aggregateID string, command interface{}) *CommandDescript
 	}
 }
 
+// NewCommandMessageWithID returns a new command descriptor identified by
+// commandID.
+//
+// Clients set the id of a command to make retries of the command idempotent,
+// see DeduplicationMiddleware. Commands without an id are given one by the
+// dispatcher.
+func NewCommandMessageWithID(commandID string, aggregateID string, command interface{}) *CommandDescriptor {
+	c := NewCommandMessage(aggregateID, command)
+	c.SetHeader(HeaderCommandId, commandID)
+	return c
+}
+
+// CommandID returns the id of the command, or an empty string when the command
+// has no id yet.
+func CommandID(command CommandMessage) string {
+	id, _ := command.Headers()[HeaderCommandId].(string)
+	return id
+}
+
 // CommandName returns the command type name as a string
 func (c *CommandDescriptor) CommandName() string {
 	return TypeOf(c.command)
@@ -49,6 +49,17 @@ func (s *CommandSuite) TestNewCommandMessage(c *C) {
 	c.Assert(cm.headers, NotNil)
 }
 
+func (s *CommandSuite) TestNewCommandMessageWithID(c *C) {
+	id := NewUUID()
+	commandID := NewUUID()
+
+	cm := NewCommandMessageWithID(commandID, id, &SomeCommand{})
+
+	c.Assert(cm.AggregateID(), Equals, id)
+	c.Assert(CommandID(cm), Equals, commandID)
+	c.Assert(CommandID(NewCommandMessage(id, &SomeCommand{})), Equals, "")
+}
+
 func (s *CommandSuite) TestShouldGetTypeOfCommand(c *C) {
 	sc := &SomeCommand{"Some String", 42}
 	cm := &CommandDescriptor{command: sc}
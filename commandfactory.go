@@ -0,0 +1,53 @@
+package ycq
+
+import (
+	"fmt"
+)
+
+// CommandFactory returns instances of a command given the command type as a
+// string.
+//
+// A command factory is required to deserialise commands that were persisted,
+// e.g. by a DeadLetterStore.
+type CommandFactory interface {
+	GetCommand(string) interface{}
+}
+
+// DelegateCommandFactory uses delegate functions to instantiate command instances
+// given the name of the command type as a string.
+type DelegateCommandFactory struct {
+	delegates map[string]func() interface{}
+}
+
+// NewDelegateCommandFactory constructs a new DelegateCommandFactory
+func NewDelegateCommandFactory() *DelegateCommandFactory {
+	return &DelegateCommandFactory{
+		delegates: make(map[string]func() interface{}),
+	}
+}
+
+// RegisterDelegate registers a delegate that returns a pointer to a new instance
+// of the command type.
+//
+//	func() interface{} { return &MyCommand{} }
+//
+// If an attempt is made to register multiple delegates for a command type, an
+// error is returned.
+func (t *DelegateCommandFactory) RegisterDelegate(command interface{}, delegate func() interface{}) error {
+	typeName := TypeOf(command)
+	if _, ok := t.delegates[typeName]; ok {
+		return fmt.Errorf("Factory delegate already registered for type: \"%s\"", typeName)
+	}
+	t.delegates[typeName] = delegate
+	return nil
+}
+
+// GetCommand returns a command instance given a command type as a string.
+//
+// If no delegate is registered for the command type, the method returns nil.
+func (t *DelegateCommandFactory) GetCommand(typeName string) interface{} {
+	if f, ok := t.delegates[typeName]; ok {
+		return f()
+	}
+	return nil
+}
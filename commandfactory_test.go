@@ -0,0 +1,39 @@
+package ycq
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&DelegateCommandFactorySuite{})
+
+type DelegateCommandFactorySuite struct {
+	factory *DelegateCommandFactory
+}
+
+func (s *DelegateCommandFactorySuite) SetUpTest(c *C) {
+	s.factory = NewDelegateCommandFactory()
+}
+
+func (s *DelegateCommandFactorySuite) TestCanGetCommandInstanceFromString(c *C) {
+	err := s.factory.RegisterDelegate(&SomeCommand{},
+		func() interface{} { return &SomeCommand{} })
+	c.Assert(err, IsNil)
+
+	c.Assert(s.factory.GetCommand(TypeOf(&SomeCommand{})), DeepEquals, &SomeCommand{})
+	c.Assert(s.factory.GetCommand("Unknown"), IsNil)
+}
+
+func (s *DelegateCommandFactorySuite) TestDuplicateCommandFactoryRegistrationReturnsAnError(c *C) {
+	err := s.factory.RegisterDelegate(&SomeCommand{},
+		func() interface{} { return &SomeCommand{} })
+	c.Assert(err, IsNil)
+
+	err = s.factory.RegisterDelegate(&SomeCommand{},
+		func() interface{} { return &SomeCommand{} })
+	c.Assert(err,
+		DeepEquals,
+		fmt.Errorf("Factory delegate already registered for type: \"%s\"",
+			TypeOf(&SomeCommand{})))
+}
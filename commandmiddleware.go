@@ -0,0 +1,131 @@
+package ycq
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// CommandMiddleware wraps a CommandHandler with behaviour that applies to many
+// commands, such as logging or recovering from panics.
+type CommandMiddleware func(CommandHandler) CommandHandler
+
+// CommandHandlerFunc is an adapter to use an ordinary function as a CommandHandler.
+type CommandHandlerFunc func(context.Context, CommandMessage) (any, error)
+
+// Handle calls f(ctx, command).
+func (f CommandHandlerFunc) Handle(ctx context.Context, command CommandMessage) (any, error) {
+	return f(ctx, command)
+}
+
+// ChainCommandMiddleware wraps the handler in the middlewares, the first
+// middleware is the outermost and runs first.
+func ChainCommandMiddleware(handler CommandHandler, middlewares ...CommandMiddleware) CommandHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Logger is the logger used by LoggingMiddleware and LogAndContinue, it is
+// satisfied by *log.Logger and most structured loggers.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// LoggingMiddleware logs every command with its outcome and duration.
+func LoggingMiddleware(logger Logger) CommandMiddleware {
+	return TimingMiddleware(func(command CommandMessage, elapsed time.Duration, err error) {
+		if err != nil {
+			logger.Printf("command %s for aggregate %s failed after %s: %s", command.CommandName(), command.AggregateID(), elapsed, err)
+			return
+		}
+
+		logger.Printf("command %s for aggregate %s handled in %s", command.CommandName(), command.AggregateID(), elapsed)
+	})
+}
+
+// RecoveryMiddleware turns a panic in a command handler into an ErrCommandPanicked.
+func RecoveryMiddleware() CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (result any, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					result = nil
+					err = &ErrCommandPanicked{
+						Command: command,
+						Value:   r,
+						Stack:   string(debug.Stack()),
+					}
+				}
+			}()
+
+			return next.Handle(ctx, command)
+		})
+	}
+}
+
+// TimingMiddleware calls observe with the time taken to handle every command
+// and the error returned by the handler.
+func TimingMiddleware(observe func(command CommandMessage, elapsed time.Duration, err error)) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+			start := time.Now()
+			result, err := next.Handle(ctx, command)
+			observe(command, time.Since(start), err)
+
+			return result, err
+		})
+	}
+}
+
+type commandHeadersKey struct{}
+
+// ContextWithHeaders returns a copy of ctx carrying the headers. The headers are
+// merged with the headers already carried by ctx.
+func ContextWithHeaders(ctx context.Context, headers map[string]interface{}) context.Context {
+	merged := make(map[string]interface{}, len(headers))
+	for k, v := range HeadersFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, commandHeadersKey{}, merged)
+}
+
+// HeadersFromContext returns the headers carried by ctx.
+func HeadersFromContext(ctx context.Context) map[string]interface{} {
+	headers, _ := ctx.Value(commandHeadersKey{}).(map[string]interface{})
+	return headers
+}
+
+// HeaderPropagationMiddleware propagates the headers with the given keys between
+// the context and the commands.
+//
+// A header carried by the context is set on the command when the command does
+// not have it yet, then the headers of the command are put on the context
+// passed to the handler so that commands dispatched by the handler inherit them.
+func HeaderPropagationMiddleware(keys ...string) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+			fromCtx := HeadersFromContext(ctx)
+			propagated := make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				if _, ok := command.Headers()[key]; !ok {
+					if v, ok := fromCtx[key]; ok {
+						command.SetHeader(key, v)
+					}
+				}
+
+				if v, ok := command.Headers()[key]; ok {
+					propagated[key] = v
+				}
+			}
+
+			return next.Handle(ContextWithHeaders(ctx, propagated), command)
+		})
+	}
+}
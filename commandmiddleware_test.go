@@ -0,0 +1,103 @@
+package ycq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CommandMiddlewareSuite{})
+
+type CommandMiddlewareSuite struct{}
+
+func (s *CommandMiddlewareSuite) TestRecoveryMiddlewareReturnsPanicAsError(c *C) {
+	handler := ChainCommandMiddleware(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		panic("boom")
+	}), RecoveryMiddleware())
+
+	cmd := NewSomeCommandMessage(NewUUID())
+	result, err := handler.Handle(context.Background(), cmd)
+	c.Assert(result, IsNil)
+	c.Assert(err, FitsTypeOf, &ErrCommandPanicked{})
+	c.Assert(err.(*ErrCommandPanicked).Value, Equals, "boom")
+	c.Assert(err.(*ErrCommandPanicked).Command, Equals, cmd)
+	c.Assert(err.(*ErrCommandPanicked).Stack, Not(Equals), "")
+}
+
+func (s *CommandMiddlewareSuite) TestTimingMiddlewareObservesOutcome(c *C) {
+	var observed time.Duration
+	var observedErr error
+	handler := ChainCommandMiddleware(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		time.Sleep(time.Millisecond)
+		return nil, fmt.Errorf("failed")
+	}), TimingMiddleware(func(command CommandMessage, elapsed time.Duration, err error) {
+		observed = elapsed
+		observedErr = err
+	}))
+
+	_, err := handler.Handle(context.Background(), NewSomeCommandMessage(NewUUID()))
+	c.Assert(err, ErrorMatches, "failed")
+	c.Assert(observedErr, Equals, err)
+	c.Assert(observed >= time.Millisecond, Equals, true)
+}
+
+func (s *CommandMiddlewareSuite) TestLoggingMiddleware(c *C) {
+	var buf bytes.Buffer
+	handler := ChainCommandMiddleware(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		return "ok", nil
+	}), LoggingMiddleware(log.New(&buf, "", 0)))
+
+	result, err := handler.Handle(context.Background(), NewCommandMessage("agg-1", &SomeCommand{}))
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, "ok")
+	c.Assert(strings.HasPrefix(buf.String(), "command SomeCommand for aggregate agg-1 handled in "), Equals, true)
+}
+
+func (s *CommandMiddlewareSuite) TestHeaderPropagation(c *C) {
+	bus := NewInMemoryDispatcher()
+	bus.Use(HeaderPropagationMiddleware("tenant"))
+
+	var inner CommandMessage
+	err := bus.RegisterHandler(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		// Commands dispatched by a handler inherit the propagated headers.
+		return bus.Dispatch(ctx, NewSomeOtherCommandMessage(NewUUID()))
+	}), &SomeCommand{})
+	c.Assert(err, IsNil)
+	err = bus.RegisterHandler(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		inner = command
+		return nil, nil
+	}), &SomeOtherCommand{})
+	c.Assert(err, IsNil)
+
+	cmd := NewSomeCommandMessage(NewUUID())
+	cmd.SetHeader("tenant", "acme")
+	cmd.SetHeader("private", true)
+
+	_, err = bus.Dispatch(context.Background(), cmd)
+	c.Assert(err, IsNil)
+	c.Assert(inner.Headers()["tenant"], Equals, "acme")
+	_, ok := inner.Headers()["private"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *CommandMiddlewareSuite) TestHeaderPropagationKeepsCommandHeaders(c *C) {
+	var got CommandMessage
+	handler := ChainCommandMiddleware(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		got = command
+		c.Assert(HeadersFromContext(ctx)["tenant"], Equals, "own")
+		return nil, nil
+	}), HeaderPropagationMiddleware("tenant"))
+
+	ctx := ContextWithHeaders(context.Background(), map[string]interface{}{"tenant": "acme"})
+	cmd := NewSomeCommandMessage(NewUUID())
+	cmd.SetHeader("tenant", "own")
+
+	_, err := handler.Handle(ctx, cmd)
+	c.Assert(err, IsNil)
+	c.Assert(got.Headers()["tenant"], Equals, "own")
+}
@@ -0,0 +1,490 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSchedulerPollInterval = time.Second
+	defaultSchedulerBatchSize    = 100
+	defaultSchedulerLease        = time.Minute
+	defaultSchedulerRetryBackoff = 30 * time.Second
+	defaultSchedulerMaxAttempts  = 10
+)
+
+// ScheduledCommand is a command stored by a CommandScheduler until it is due.
+type ScheduledCommand struct {
+	// ID identifies the schedule, it is returned by DispatchAt and
+	// DispatchAfter to cancel the command.
+	ID          string
+	CommandName string
+	AggregateID string
+
+	// Data is the JSON encoded command.
+	Data    string
+	Headers map[string]interface{}
+
+	// DueAt is the time the command is dispatched at, or retried at after a
+	// failed dispatch.
+	DueAt time.Time
+
+	// Attempts is the number of times the command was claimed for dispatch.
+	Attempts int
+
+	// LastError is the error of the last failed dispatch.
+	LastError string
+
+	CreatedAt time.Time
+}
+
+// CommandMessage decodes the scheduled command with the factory.
+func (s *ScheduledCommand) CommandMessage(factory CommandFactory) (CommandMessage, error) {
+	command := factory.GetCommand(s.CommandName)
+	if command == nil {
+		return nil, fmt.Errorf("no command registered with the factory for type: %s", s.CommandName)
+	}
+
+	if err := json.Unmarshal([]byte(s.Data), command); err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	cm := NewCommandMessage(s.AggregateID, command)
+	for k, v := range s.Headers {
+		cm.SetHeader(k, v)
+	}
+
+	return cm, nil
+}
+
+// CommandScheduleStore stores the commands of a CommandScheduler.
+type CommandScheduleStore interface {
+	// Schedule stores a command.
+	Schedule(ctx context.Context, command *ScheduledCommand) error
+
+	// Get returns the scheduled command with the id, ErrScheduledCommandNotFound
+	// when it does not exist.
+	Get(ctx context.Context, id string) (*ScheduledCommand, error)
+
+	// Cancel removes the scheduled command with the id,
+	// ErrScheduledCommandNotFound when it does not exist.
+	Cancel(ctx context.Context, id string) error
+
+	// Due returns up to limit commands due at now, by due time.
+	Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledCommand, error)
+
+	// Claim takes a due command for dispatch by moving its due time to until
+	// and incrementing its attempts. It reports false when the command was
+	// claimed or removed since it was read, i.e. its attempts changed.
+	Claim(ctx context.Context, command *ScheduledCommand, until time.Time) (bool, error)
+
+	// Fail records the error of a failed dispatch and the time the command is
+	// retried at. A command that was cancelled meanwhile is ignored.
+	Fail(ctx context.Context, id string, retryAt time.Time, lastError string) error
+
+	// Complete removes a dispatched command. A command that was cancelled
+	// meanwhile is ignored.
+	Complete(ctx context.Context, id string) error
+}
+
+// InMemoryCommandScheduleStore is a CommandScheduleStore that keeps the
+// commands in memory, it is meant for tests and single process applications.
+type InMemoryCommandScheduleStore struct {
+	sync.RWMutex
+	commands map[string]*ScheduledCommand
+}
+
+// NewInMemoryCommandScheduleStore constructs an empty InMemoryCommandScheduleStore.
+func NewInMemoryCommandScheduleStore() *InMemoryCommandScheduleStore {
+	return &InMemoryCommandScheduleStore{
+		commands: make(map[string]*ScheduledCommand),
+	}
+}
+
+func (s *InMemoryCommandScheduleStore) Schedule(ctx context.Context, command *ScheduledCommand) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.commands[command.ID]; ok {
+		return fmt.Errorf("command already scheduled with id: %s", command.ID)
+	}
+
+	s.commands[command.ID] = copyScheduledCommand(command)
+	return nil
+}
+
+func (s *InMemoryCommandScheduleStore) Get(ctx context.Context, id string) (*ScheduledCommand, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	command, ok := s.commands[id]
+	if !ok {
+		return nil, &ErrScheduledCommandNotFound{ID: id}
+	}
+
+	return copyScheduledCommand(command), nil
+}
+
+func (s *InMemoryCommandScheduleStore) Cancel(ctx context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.commands[id]; !ok {
+		return &ErrScheduledCommandNotFound{ID: id}
+	}
+
+	delete(s.commands, id)
+	return nil
+}
+
+func (s *InMemoryCommandScheduleStore) Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledCommand, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var due []*ScheduledCommand
+	for _, command := range s.commands {
+		if !command.DueAt.After(now) {
+			due = append(due, copyScheduledCommand(command))
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+func (s *InMemoryCommandScheduleStore) Claim(ctx context.Context, command *ScheduledCommand, until time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	stored, ok := s.commands[command.ID]
+	if !ok || stored.Attempts != command.Attempts {
+		return false, nil
+	}
+
+	stored.DueAt = until
+	stored.Attempts++
+	return true, nil
+}
+
+func (s *InMemoryCommandScheduleStore) Fail(ctx context.Context, id string, retryAt time.Time, lastError string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	stored, ok := s.commands[id]
+	if !ok {
+		return nil
+	}
+
+	stored.DueAt = retryAt
+	stored.LastError = lastError
+	return nil
+}
+
+func (s *InMemoryCommandScheduleStore) Complete(ctx context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.commands, id)
+	return nil
+}
+
+func copyScheduledCommand(command *ScheduledCommand) *ScheduledCommand {
+	c := *command
+	c.Headers = copyHeaders(command.Headers)
+	return &c
+}
+
+// CommandSchedulerOptions configures a CommandScheduler.
+type CommandSchedulerOptions struct {
+	// Clock tells the time commands are due against. Defaults to the
+	// SystemClock.
+	Clock Clock
+
+	// PollInterval is the interval at which Run looks for due commands.
+	// Defaults to one second.
+	PollInterval time.Duration
+
+	// BatchSize is the number of due commands read at once. Defaults to 100.
+	BatchSize int
+
+	// Lease is how long a claimed command is withheld from other workers, a
+	// worker that stops while dispatching lets the command be dispatched
+	// again after the lease. Defaults to one minute.
+	Lease time.Duration
+
+	// RetryBackoff is the delay before a failed dispatch is retried. Defaults
+	// to 30 seconds.
+	RetryBackoff time.Duration
+
+	// Parker parks the commands that can't be dispatched, the commands whose
+	// dispatch failed MaxAttempts times and the commands that can't be
+	// decoded, and removes them from the schedule. Without a Parker a failed
+	// dispatch is retried until it succeeds.
+	Parker CommandParker
+
+	// MaxAttempts is the number of times the dispatch of a command is
+	// attempted before the command is parked. It requires a Parker and
+	// defaults to 10 with one.
+	MaxAttempts int
+
+	// Logger logs the errors Run recovers from.
+	Logger Logger
+}
+
+// CommandScheduler dispatches commands at a later time.
+//
+// Commands are kept in a CommandScheduleStore until they are due, a worker
+// started with Run hands the due commands to the Dispatcher. Commands are
+// dispatched at least once: a failed dispatch is retried after RetryBackoff
+// and a command is only removed from the store once it was dispatched or
+// parked. A dispatch failing with ErrPublishFailed or ErrSnapshotFailed
+// persisted the events of the command, it is logged and not retried. Every
+// command is given a command id when it is scheduled, so a command dispatched
+// twice can be dropped by DeduplicationMiddleware.
+type CommandScheduler struct {
+	store      CommandScheduleStore
+	dispatcher Dispatcher
+	factory    CommandFactory
+	options    CommandSchedulerOptions
+}
+
+// NewCommandScheduler constructs a CommandScheduler, factory decodes the
+// scheduled commands when they are due.
+func NewCommandScheduler(store CommandScheduleStore, dispatcher Dispatcher, factory CommandFactory, options CommandSchedulerOptions) (*CommandScheduler, error) {
+	if store == nil {
+		return nil, fmt.Errorf("nil CommandScheduleStore injected into command scheduler")
+	}
+
+	if dispatcher == nil {
+		return nil, fmt.Errorf("nil Dispatcher injected into command scheduler")
+	}
+
+	if factory == nil {
+		return nil, fmt.Errorf("nil CommandFactory injected into command scheduler")
+	}
+
+	if options.Clock == nil {
+		options.Clock = SystemClock()
+	}
+
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultSchedulerPollInterval
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultSchedulerBatchSize
+	}
+
+	if options.Lease <= 0 {
+		options.Lease = defaultSchedulerLease
+	}
+
+	if options.RetryBackoff <= 0 {
+		options.RetryBackoff = defaultSchedulerRetryBackoff
+	}
+
+	if options.Parker == nil && options.MaxAttempts > 0 {
+		return nil, fmt.Errorf("command scheduler MaxAttempts requires a Parker")
+	}
+
+	if options.Parker != nil && options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultSchedulerMaxAttempts
+	}
+
+	return &CommandScheduler{
+		store:      store,
+		dispatcher: dispatcher,
+		factory:    factory,
+		options:    options,
+	}, nil
+}
+
+// DispatchAt schedules the command to be dispatched at the time and returns the
+// id of the schedule.
+//
+// The correlation id, causation id and actor carried by ctx are set on the
+// command, so the command continues the correlation it was scheduled in.
+func (s *CommandScheduler) DispatchAt(ctx context.Context, command CommandMessage, at time.Time) (string, error) {
+	data, err := json.Marshal(command.Command())
+	if err != nil {
+		return "", &ErrUnexpected{Err: err}
+	}
+
+	fromCtx := HeadersFromContext(ctx)
+	setMissingHeader(command.Headers(), command.SetHeader, HeaderCommandId, NewUUID())
+	for _, key := range []string{HeaderCorrelationId, HeaderCausationId, HeaderActor} {
+		setMissingHeader(command.Headers(), command.SetHeader, key, fromCtx[key])
+	}
+
+	scheduled := &ScheduledCommand{
+		ID:          NewUUID(),
+		CommandName: command.CommandName(),
+		AggregateID: command.AggregateID(),
+		Data:        string(data),
+		Headers:     copyHeaders(command.Headers()),
+		DueAt:       at.UTC(),
+		CreatedAt:   s.options.Clock.Now().UTC(),
+	}
+
+	if err := s.store.Schedule(ctx, scheduled); err != nil {
+		return "", err
+	}
+
+	return scheduled.ID, nil
+}
+
+// DispatchAfter schedules the command to be dispatched after the duration and
+// returns the id of the schedule.
+func (s *CommandScheduler) DispatchAfter(ctx context.Context, command CommandMessage, after time.Duration) (string, error) {
+	return s.DispatchAt(ctx, command, s.options.Clock.Now().Add(after))
+}
+
+// Cancel cancels the scheduled command with the id. ErrScheduledCommandNotFound
+// is returned when the command was dispatched or cancelled already.
+func (s *CommandScheduler) Cancel(ctx context.Context, id string) error {
+	return s.store.Cancel(ctx, id)
+}
+
+// DispatchDue dispatches the commands that are due and returns how many were
+// dispatched.
+//
+// A failed dispatch is recorded and retried later, it does not stop the other
+// commands from being dispatched. Errors of the store are returned.
+func (s *CommandScheduler) DispatchDue(ctx context.Context) (int, error) {
+	dispatched := 0
+	for {
+		now := s.options.Clock.Now()
+		due, err := s.store.Due(ctx, now, s.options.BatchSize)
+		if err != nil {
+			return dispatched, err
+		}
+
+		for _, command := range due {
+			ok, err := s.dispatch(ctx, command, now)
+			if err != nil {
+				return dispatched, err
+			}
+
+			if ok {
+				dispatched++
+			}
+		}
+
+		if len(due) < s.options.BatchSize {
+			return dispatched, nil
+		}
+	}
+}
+
+// Run dispatches the due commands every PollInterval until ctx is cancelled.
+//
+// Errors are logged with the Logger and the due commands are tried again after
+// PollInterval. Run returns nil once ctx is cancelled.
+func (s *CommandScheduler) Run(ctx context.Context) error {
+	for {
+		if _, err := s.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			s.logf("command scheduler failed to dispatch due commands: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.options.PollInterval):
+		}
+	}
+}
+
+func (s *CommandScheduler) logf(format string, args ...interface{}) {
+	if s.options.Logger != nil {
+		s.options.Logger.Printf(format, args...)
+	}
+}
+
+// dispatch claims the command and dispatches it, it reports whether the command
+// was dispatched.
+func (s *CommandScheduler) dispatch(ctx context.Context, command *ScheduledCommand, now time.Time) (bool, error) {
+	claimed, err := s.store.Claim(ctx, command, now.Add(s.options.Lease).UTC())
+	if err != nil || !claimed {
+		return false, err
+	}
+	attempts := command.Attempts + 1
+
+	cm, err := command.CommandMessage(s.factory)
+	if err != nil {
+		// A command that can't be decoded fails every attempt.
+		if s.options.Parker != nil {
+			return false, s.park(ctx, command.ID, &undecodedCommand{scheduled: command}, err, attempts)
+		}
+
+		return false, s.store.Fail(ctx, command.ID, now.Add(s.options.RetryBackoff).UTC(), err.Error())
+	}
+
+	if _, err := s.dispatcher.Dispatch(ctx, cm); err != nil {
+		if isCommittedError(err) {
+			// The events of the command were persisted, dispatching it
+			// again would persist them twice.
+			s.logf("scheduled command %s failed after its events were committed: %s", command.ID, err)
+			return true, s.store.Complete(ctx, command.ID)
+		}
+
+		if s.options.Parker != nil && attempts >= s.options.MaxAttempts {
+			return false, s.park(ctx, command.ID, cm, err, attempts)
+		}
+
+		return false, s.store.Fail(ctx, command.ID, now.Add(s.options.RetryBackoff).UTC(), err.Error())
+	}
+
+	return true, s.store.Complete(ctx, command.ID)
+}
+
+// park hands the command to the Parker and removes it from the schedule.
+func (s *CommandScheduler) park(ctx context.Context, id string, command CommandMessage, err error, attempts int) error {
+	parkErr := s.options.Parker.ParkCommand(ctx, &CommandFailure{
+		Command:     command,
+		HandlerName: command.CommandName(),
+		Err:         err,
+		Attempts:    attempts,
+	})
+	if parkErr != nil {
+		return fmt.Errorf("parking scheduled command %s failed: %s, dispatch failed: %w", id, parkErr, err)
+	}
+
+	return s.store.Complete(ctx, id)
+}
+
+// undecodedCommand is a scheduled command that can't be decoded, it is parked
+// as it was scheduled.
+type undecodedCommand struct {
+	scheduled *ScheduledCommand
+}
+
+func (c *undecodedCommand) AggregateID() string {
+	return c.scheduled.AggregateID
+}
+
+func (c *undecodedCommand) Headers() map[string]interface{} {
+	return c.scheduled.Headers
+}
+
+func (c *undecodedCommand) SetHeader(key string, value interface{}) {
+	c.scheduled.Headers[key] = value
+}
+
+func (c *undecodedCommand) Command() interface{} {
+	return json.RawMessage(c.scheduled.Data)
+}
+
+func (c *undecodedCommand) CommandName() string {
+	return c.scheduled.CommandName
+}
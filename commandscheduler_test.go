@@ -0,0 +1,354 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = suiteForEveryRepository(func(fixture repositoryFixture) interface{} {
+	return &CommandSchedulerSuite{repositoryFixture: fixture}
+})
+
+// CommandSchedulerSuite runs against every CommandScheduleStore implementation.
+type CommandSchedulerSuite struct {
+	repositoryFixture
+	newStore  func(c *C) CommandScheduleStore
+	store     CommandScheduleStore
+	clock     *ManualClock
+	commands  *recordingCommandHandler
+	scheduler *CommandScheduler
+	ctx       context.Context
+}
+
+func (s *CommandSchedulerSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	repo := s.openRepository(c)
+
+	s.store = NewInMemoryCommandScheduleStore()
+	if s.sql {
+		var err error
+		s.store, err = NewSqlCommandScheduleStore(repo)
+		c.Assert(err, IsNil)
+	}
+
+	s.clock = NewManualClock(time.Date(2022, 12, 6, 9, 0, 0, 0, time.UTC))
+	s.commands = &recordingCommandHandler{}
+
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(s.commands, &SomeCommand{}, &SomeOtherCommand{}), IsNil)
+
+	factory := NewDelegateCommandFactory()
+	c.Assert(factory.RegisterDelegate(&SomeCommand{}, func() interface{} { return &SomeCommand{} }), IsNil)
+	c.Assert(factory.RegisterDelegate(&SomeOtherCommand{}, func() interface{} { return &SomeOtherCommand{} }), IsNil)
+
+	var err error
+	s.scheduler, err = NewCommandScheduler(s.store, dispatcher, factory, CommandSchedulerOptions{
+		Clock:        s.clock,
+		BatchSize:    2,
+		RetryBackoff: time.Minute,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *CommandSchedulerSuite) TestNewCommandSchedulerRequiresDependencies(c *C) {
+	_, err := NewCommandScheduler(nil, NewInMemoryDispatcher(), NewDelegateCommandFactory(), CommandSchedulerOptions{})
+	c.Assert(err, ErrorMatches, "nil CommandScheduleStore injected into command scheduler")
+
+	_, err = NewCommandScheduler(s.store, nil, NewDelegateCommandFactory(), CommandSchedulerOptions{})
+	c.Assert(err, ErrorMatches, "nil Dispatcher injected into command scheduler")
+
+	_, err = NewCommandScheduler(s.store, NewInMemoryDispatcher(), nil, CommandSchedulerOptions{})
+	c.Assert(err, ErrorMatches, "nil CommandFactory injected into command scheduler")
+}
+
+func (s *CommandSchedulerSuite) TestCommandIsDispatchedWhenDue(c *C) {
+	id, err := s.scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a", Count: 2}), time.Hour)
+	c.Assert(err, IsNil)
+
+	n, err := s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	c.Assert(s.commands.names(), HasLen, 0)
+
+	s.clock.Advance(time.Hour)
+	n, err = s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	c.Assert(s.commands.commands, HasLen, 1)
+	command := s.commands.commands[0]
+	c.Assert(command.AggregateID(), Equals, "item")
+	c.Assert(command.Command(), DeepEquals, &SomeCommand{Item: "a", Count: 2})
+
+	_, err = s.store.Get(s.ctx, id)
+	c.Assert(err, DeepEquals, &ErrScheduledCommandNotFound{ID: id})
+}
+
+func (s *CommandSchedulerSuite) TestCommandsAreDispatchedByDueTime(c *C) {
+	now := s.clock.Now()
+	_, err := s.scheduler.DispatchAt(s.ctx, NewCommandMessage("b", &SomeOtherCommand{OrderID: "b"}), now.Add(2*time.Minute))
+	c.Assert(err, IsNil)
+	_, err = s.scheduler.DispatchAt(s.ctx, NewCommandMessage("a", &SomeCommand{Item: "a"}), now.Add(time.Minute))
+	c.Assert(err, IsNil)
+	_, err = s.scheduler.DispatchAt(s.ctx, NewCommandMessage("c", &SomeCommand{Item: "c"}), now.Add(3*time.Minute))
+	c.Assert(err, IsNil)
+
+	// Three due commands are read in two batches of BatchSize.
+	s.clock.Advance(time.Hour)
+	n, err := s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(s.commands.names(), DeepEquals, []string{"SomeCommand", "SomeOtherCommand", "SomeCommand"})
+}
+
+func (s *CommandSchedulerSuite) TestCancelledCommandIsNotDispatched(c *C) {
+	id, err := s.scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), time.Minute)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.scheduler.Cancel(s.ctx, id), IsNil)
+	c.Assert(s.scheduler.Cancel(s.ctx, id), DeepEquals, &ErrScheduledCommandNotFound{ID: id})
+
+	s.clock.Advance(time.Hour)
+	n, err := s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	c.Assert(s.commands.names(), HasLen, 0)
+}
+
+func (s *CommandSchedulerSuite) TestFailedDispatchIsRetried(c *C) {
+	s.commands.failures = 1
+	id, err := s.scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), time.Minute)
+	c.Assert(err, IsNil)
+
+	s.clock.Advance(time.Minute)
+	n, err := s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	scheduled, err := s.store.Get(s.ctx, id)
+	c.Assert(err, IsNil)
+	c.Assert(scheduled.Attempts, Equals, 1)
+	c.Assert(scheduled.LastError, Equals, "dispatch failed")
+	c.Assert(scheduled.DueAt.Equal(s.clock.Now().Add(time.Minute)), Equals, true)
+
+	// The retry is not due before the backoff.
+	n, err = s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	s.clock.Advance(time.Minute)
+	n, err = s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(s.commands.names(), DeepEquals, []string{"SomeCommand"})
+	c.Assert(CommandID(s.commands.commands[0]), Equals, scheduled.Headers[HeaderCommandId])
+}
+
+func (s *CommandSchedulerSuite) TestCommittedFailureIsNotRetried(c *C) {
+	s.commands.failures = 1
+	s.commands.committed = true
+	id, err := s.scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), time.Minute)
+	c.Assert(err, IsNil)
+
+	s.clock.Advance(time.Minute)
+	n, err := s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	_, err = s.store.Get(s.ctx, id)
+	c.Assert(err, FitsTypeOf, &ErrScheduledCommandNotFound{})
+
+	s.clock.Advance(time.Hour)
+	n, err = s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	c.Assert(s.commands.names(), DeepEquals, []string{"SomeCommand"})
+}
+
+func (s *CommandSchedulerSuite) TestClaimedCommandIsNotClaimedTwice(c *C) {
+	id, err := s.scheduler.DispatchAt(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), s.clock.Now())
+	c.Assert(err, IsNil)
+
+	due, err := s.store.Due(s.ctx, s.clock.Now(), 10)
+	c.Assert(err, IsNil)
+	c.Assert(due, HasLen, 1)
+	c.Assert(due[0].ID, Equals, id)
+
+	claimed, err := s.store.Claim(s.ctx, due[0], s.clock.Now().Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(claimed, Equals, true)
+
+	// A second worker read the command before it was claimed.
+	claimed, err = s.store.Claim(s.ctx, due[0], s.clock.Now().Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(claimed, Equals, false)
+
+	// The claimed command is withheld until its lease ends.
+	due, err = s.store.Due(s.ctx, s.clock.Now(), 10)
+	c.Assert(err, IsNil)
+	c.Assert(due, HasLen, 0)
+
+	due, err = s.store.Due(s.ctx, s.clock.Now().Add(time.Minute), 10)
+	c.Assert(err, IsNil)
+	c.Assert(due, HasLen, 1)
+	c.Assert(due[0].Attempts, Equals, 1)
+}
+
+func (s *CommandSchedulerSuite) TestScheduledCommandCarriesContextHeaders(c *C) {
+	ctx := ContextWithHeaders(s.ctx, map[string]interface{}{
+		HeaderCorrelationId: "correlation",
+		HeaderCausationId:   "cause",
+		HeaderActor:         "alice",
+	})
+
+	command := NewCommandMessage("item", &SomeCommand{Item: "a"})
+	id, err := s.scheduler.DispatchAfter(ctx, command, time.Minute)
+	c.Assert(err, IsNil)
+
+	scheduled, err := s.store.Get(s.ctx, id)
+	c.Assert(err, IsNil)
+	c.Assert(scheduled.CommandName, Equals, "SomeCommand")
+	c.Assert(scheduled.Headers[HeaderCommandId], Equals, CommandID(command))
+	c.Assert(CorrelationId(scheduled.Headers), Equals, "correlation")
+
+	s.clock.Advance(time.Minute)
+	_, err = s.scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.commands.commands, HasLen, 1)
+	dispatched := s.commands.commands[0]
+	c.Assert(CommandID(dispatched), Equals, CommandID(command))
+	c.Assert(CorrelationId(dispatched.Headers()), Equals, "correlation")
+	c.Assert(CausationId(dispatched.Headers()), Equals, "cause")
+	c.Assert(Actor(dispatched.Headers()), Equals, "alice")
+}
+
+func (s *CommandSchedulerSuite) TestRunDispatchesUntilCancelled(c *C) {
+	_, err := s.scheduler.DispatchAt(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), s.clock.Now())
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan error)
+	go func() {
+		done <- s.scheduler.Run(ctx)
+	}()
+
+	for i := 0; i < 100 && len(s.commands.names()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	c.Assert(<-done, IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"SomeCommand"})
+}
+
+func (s *CommandSchedulerSuite) TestCommandCancelledWhileDispatchingIsIgnored(c *C) {
+	var scheduler *CommandScheduler
+	var id string
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		c.Assert(scheduler.Cancel(ctx, id), IsNil)
+		return nil, fmt.Errorf("dispatch failed")
+	})
+
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(handler, &SomeCommand{}), IsNil)
+
+	factory := NewDelegateCommandFactory()
+	c.Assert(factory.RegisterDelegate(&SomeCommand{}, func() interface{} { return &SomeCommand{} }), IsNil)
+
+	scheduler, err := NewCommandScheduler(s.store, dispatcher, factory, CommandSchedulerOptions{Clock: s.clock})
+	c.Assert(err, IsNil)
+
+	id, err = scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), time.Minute)
+	c.Assert(err, IsNil)
+
+	s.clock.Advance(time.Minute)
+	n, err := scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	_, err = s.store.Get(s.ctx, id)
+	c.Assert(err, FitsTypeOf, &ErrScheduledCommandNotFound{})
+}
+
+func (s *CommandSchedulerSuite) schedulerWithParker(c *C, parker CommandParker) *CommandScheduler {
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(s.commands, &SomeCommand{}), IsNil)
+
+	factory := NewDelegateCommandFactory()
+	c.Assert(factory.RegisterDelegate(&SomeCommand{}, func() interface{} { return &SomeCommand{} }), IsNil)
+
+	scheduler, err := NewCommandScheduler(s.store, dispatcher, factory, CommandSchedulerOptions{
+		Clock:        s.clock,
+		RetryBackoff: time.Minute,
+		Parker:       parker,
+		MaxAttempts:  2,
+	})
+	c.Assert(err, IsNil)
+
+	return scheduler
+}
+
+func (s *CommandSchedulerSuite) TestPoisonCommandIsParked(c *C) {
+	parked := NewInMemoryDeadLetterStore()
+	scheduler := s.schedulerWithParker(c, parked)
+
+	s.commands.failures = 5
+	id, err := scheduler.DispatchAfter(s.ctx, NewCommandMessage("item", &SomeCommand{Item: "a"}), time.Minute)
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 2; i++ {
+		s.clock.Advance(time.Minute)
+		n, err := scheduler.DispatchDue(s.ctx)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, 0)
+	}
+
+	_, err = s.store.Get(s.ctx, id)
+	c.Assert(err, FitsTypeOf, &ErrScheduledCommandNotFound{})
+
+	letters, err := parked.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Name, Equals, "SomeCommand")
+	c.Assert(letters[0].Attempts, Equals, 2)
+	c.Assert(letters[0].Error, Equals, "dispatch failed")
+}
+
+func (s *CommandSchedulerSuite) TestUndecodableCommandIsParked(c *C) {
+	parked := NewInMemoryDeadLetterStore()
+	scheduler := s.schedulerWithParker(c, parked)
+
+	c.Assert(s.store.Schedule(s.ctx, &ScheduledCommand{
+		ID:          NewUUID(),
+		CommandName: "RetiredCommand",
+		AggregateID: "item",
+		Data:        `{"Item":"a"}`,
+		Headers:     map[string]interface{}{},
+		DueAt:       s.clock.Now(),
+		CreatedAt:   s.clock.Now(),
+	}), IsNil)
+
+	n, err := scheduler.DispatchDue(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	letters, err := parked.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Name, Equals, "RetiredCommand")
+	c.Assert(letters[0].Data, Equals, `{"Item":"a"}`)
+	c.Assert(letters[0].Attempts, Equals, 1)
+
+	due, err := s.store.Due(s.ctx, s.clock.Now().Add(time.Hour), 0)
+	c.Assert(err, IsNil)
+	c.Assert(due, HasLen, 0)
+}
+
+func (s *CommandSchedulerSuite) TestMaxAttemptsRequiresParker(c *C) {
+	_, err := NewCommandScheduler(s.store, NewInMemoryDispatcher(), NewDelegateCommandFactory(), CommandSchedulerOptions{MaxAttempts: 3})
+	c.Assert(err, ErrorMatches, "command scheduler MaxAttempts requires a Parker")
+}
@@ -0,0 +1,147 @@
+package ycq
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConcurrencyRetries    = 3
+	defaultConcurrencyBackoff    = 10 * time.Millisecond
+	defaultConcurrencyMaxBackoff = time.Second
+)
+
+// ConcurrencyRetryOptions configures ConcurrencyRetryMiddleware and
+// UpdateAggregate.
+type ConcurrencyRetryOptions struct {
+	// Retries is the number of times a command is handled again after an
+	// ErrConcurrencyViolation. Defaults to 3, a negative value disables
+	// retries.
+	Retries int
+
+	// Backoff is the delay before the first retry, it doubles with every
+	// further retry up to MaxBackoff. Every delay is jittered to a random
+	// duration between half and all of it, so that conflicting commands do not
+	// retry in lockstep. Defaults to 10 milliseconds.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between retries. Defaults to one second.
+	MaxBackoff time.Duration
+
+	// ShouldRetry decides whether a command that failed with the error is safe
+	// to handle again, e.g. because its handler has no side effects outside of
+	// the aggregate it saves. Defaults to retrying every command.
+	//
+	// ShouldRetry is only called by ConcurrencyRetryMiddleware.
+	ShouldRetry func(command CommandMessage, err *ErrConcurrencyViolation) bool
+}
+
+// ConcurrencyRetryMiddleware handles a command again when its handler fails
+// with an ErrConcurrencyViolation, i.e. when the aggregate was changed by
+// another command between the load and the save of the handler.
+//
+// Handlers load the aggregate through the DomainRepository every time they
+// handle a command, so the command is re-executed against the aggregate with
+// the changes that won the race. The error of the last attempt is returned
+// when the command keeps conflicting or the context is done.
+func ConcurrencyRetryMiddleware(options ConcurrencyRetryOptions) CommandMiddleware {
+	options = concurrencyRetryDefaults(options)
+
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+			var result any
+			err := retryOnConcurrencyViolation(ctx, options, func(violation *ErrConcurrencyViolation) bool {
+				return options.ShouldRetry == nil || options.ShouldRetry(command, violation)
+			}, func() error {
+				var err error
+				result, err = next.Handle(ctx, command)
+				return err
+			})
+
+			return result, err
+		})
+	}
+}
+
+// UpdateAggregate loads the aggregate from its stream, calls act with it and
+// saves its changes, expecting the version it was loaded at.
+//
+// When the save fails with an ErrConcurrencyViolation a new aggregate is
+// loaded and act is called again, as configured by options. act must only
+// change the aggregate, as it may be called more than once.
+func UpdateAggregate(ctx context.Context, repo DomainRepository, streamId string, newAggregate func() AggregateRoot, act func(AggregateRoot) error, options ConcurrencyRetryOptions) error {
+	options = concurrencyRetryDefaults(options)
+
+	return retryOnConcurrencyViolation(ctx, options, nil, func() error {
+		aggregate := newAggregate()
+		if err := repo.Load(ctx, streamId, aggregate); err != nil {
+			return err
+		}
+
+		if err := act(aggregate); err != nil {
+			return err
+		}
+
+		return repo.Save(ctx, streamId, aggregate, Int(aggregate.OriginalVersion()))
+	})
+}
+
+func concurrencyRetryDefaults(options ConcurrencyRetryOptions) ConcurrencyRetryOptions {
+	if options.Retries == 0 {
+		options.Retries = defaultConcurrencyRetries
+	} else if options.Retries < 0 {
+		options.Retries = 0
+	}
+
+	if options.Backoff <= 0 {
+		options.Backoff = defaultConcurrencyBackoff
+	}
+
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultConcurrencyMaxBackoff
+	}
+
+	return options
+}
+
+// retryOnConcurrencyViolation calls attempt until it does not fail with an
+// ErrConcurrencyViolation, retry returns false or the retries are exhausted.
+func retryOnConcurrencyViolation(ctx context.Context, options ConcurrencyRetryOptions, retry func(*ErrConcurrencyViolation) bool, attempt func() error) error {
+	backoff := options.Backoff
+	for i := 0; ; i++ {
+		err := attempt()
+
+		var violation *ErrConcurrencyViolation
+		if !errors.As(err, &violation) || i == options.Retries || (retry != nil && !retry(violation)) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jitter(backoff)):
+		}
+
+		if backoff *= 2; backoff > options.MaxBackoff {
+			backoff = options.MaxBackoff
+		}
+	}
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration between half and all of d.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+
+	return half + time.Duration(jitterRand.Int63n(int64(d-half)+1))
+}
@@ -0,0 +1,183 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ConcurrencyRetrySuite{})
+
+type ConcurrencyRetrySuite struct {
+	ctx       context.Context
+	eventRepo EventRepository
+	repo      DomainRepository
+	streamId  string
+}
+
+func (s *ConcurrencyRetrySuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	s.eventRepo = NewInMemoryEventRepository()
+	s.streamId = NewUUID()
+
+	var err error
+	s.repo, err = NewSqlDomainRepository(s.eventRepo, NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+	s.repo.SetEventFactory(factory)
+}
+
+// addConcurrently appends an event to the stream as a concurrent writer would.
+func (s *ConcurrencyRetrySuite) addConcurrently(c *C, count int) {
+	c.Assert(s.eventRepo.Append(s.ctx, s.streamId, []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Count: count}), nil),
+	}, nil), IsNil)
+}
+
+func (s *ConcurrencyRetrySuite) count(c *C) int {
+	agg := newRoutedAggregate(s.streamId)
+	c.Assert(s.repo.Load(s.ctx, s.streamId, agg), IsNil)
+	return agg.count
+}
+
+// conflictingHandler adds the count of a SomeCommand to the aggregate, the
+// first conflicts attempts race with a concurrent writer.
+type conflictingHandler struct {
+	s         *ConcurrencyRetrySuite
+	c         *C
+	conflicts int
+	attempts  int
+}
+
+func (h *conflictingHandler) Handle(ctx context.Context, command CommandMessage) (any, error) {
+	h.attempts++
+	agg := newRoutedAggregate(h.s.streamId)
+	if err := h.s.repo.Load(ctx, h.s.streamId, agg); err != nil {
+		return nil, err
+	}
+
+	if err := agg.Raise(NewTypedEvent(ItemAdded{Count: command.Command().(*SomeCommand).Count})); err != nil {
+		return nil, err
+	}
+
+	if h.attempts <= h.conflicts {
+		h.s.addConcurrently(h.c, 100)
+	}
+
+	if err := h.s.repo.Save(ctx, h.s.streamId, agg, Int(agg.OriginalVersion())); err != nil {
+		return nil, fmt.Errorf("saving item failed: %w", err)
+	}
+
+	return agg.count, nil
+}
+
+func (s *ConcurrencyRetrySuite) dispatcher(c *C, handler CommandHandler, options ConcurrencyRetryOptions) *InMemoryDispatcher {
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(handler, &SomeCommand{}), IsNil)
+	dispatcher.Use(ConcurrencyRetryMiddleware(options))
+
+	return dispatcher
+}
+
+func (s *ConcurrencyRetrySuite) TestConflictingCommandIsRetried(c *C) {
+	handler := &conflictingHandler{s: s, c: c, conflicts: 2}
+	dispatcher := s.dispatcher(c, handler, ConcurrencyRetryOptions{Backoff: time.Millisecond})
+
+	result, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(s.streamId, &SomeCommand{Count: 1}))
+	c.Assert(err, IsNil)
+	c.Assert(handler.attempts, Equals, 3)
+
+	// The last attempt saw the changes of both concurrent writers.
+	c.Assert(result, Equals, 201)
+	c.Assert(s.count(c), Equals, 201)
+}
+
+func (s *ConcurrencyRetrySuite) TestRetriesAreLimited(c *C) {
+	handler := &conflictingHandler{s: s, c: c, conflicts: 10}
+	dispatcher := s.dispatcher(c, handler, ConcurrencyRetryOptions{Retries: 2, Backoff: time.Millisecond})
+
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(s.streamId, &SomeCommand{Count: 1}))
+	c.Assert(err, ErrorMatches, "saving item failed: ConcurrencyError.*")
+	c.Assert(handler.attempts, Equals, 3)
+}
+
+func (s *ConcurrencyRetrySuite) TestNegativeRetriesDisableRetries(c *C) {
+	handler := &conflictingHandler{s: s, c: c, conflicts: 1}
+	dispatcher := s.dispatcher(c, handler, ConcurrencyRetryOptions{Retries: -1, Backoff: time.Millisecond})
+
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(s.streamId, &SomeCommand{Count: 1}))
+	c.Assert(err, ErrorMatches, "saving item failed: ConcurrencyError.*")
+	c.Assert(handler.attempts, Equals, 1)
+}
+
+func (s *ConcurrencyRetrySuite) TestShouldRetryDecidesWhichCommandsAreRetried(c *C) {
+	var asked []string
+	handler := &conflictingHandler{s: s, c: c, conflicts: 1}
+	dispatcher := s.dispatcher(c, handler, ConcurrencyRetryOptions{
+		Backoff: time.Millisecond,
+		ShouldRetry: func(command CommandMessage, err *ErrConcurrencyViolation) bool {
+			asked = append(asked, err.StreamName)
+			return command.Command().(*SomeCommand).Item != "unsafe"
+		},
+	})
+
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(s.streamId, &SomeCommand{Item: "unsafe", Count: 1}))
+	c.Assert(err, FitsTypeOf, fmt.Errorf("%w", &ErrConcurrencyViolation{}))
+	c.Assert(handler.attempts, Equals, 1)
+	c.Assert(asked, DeepEquals, []string{s.streamId})
+}
+
+func (s *ConcurrencyRetrySuite) TestOtherErrorsAreNotRetried(c *C) {
+	attempts := 0
+	dispatcher := s.dispatcher(c, CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		attempts++
+		return nil, fmt.Errorf("invalid item")
+	}), ConcurrencyRetryOptions{})
+
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(s.streamId, &SomeCommand{}))
+	c.Assert(err, ErrorMatches, "invalid item")
+	c.Assert(attempts, Equals, 1)
+}
+
+func (s *ConcurrencyRetrySuite) TestRetryStopsWhenContextIsDone(c *C) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	attempts := 0
+	dispatcher := s.dispatcher(c, CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		attempts++
+		cancel()
+		return nil, &ErrConcurrencyViolation{StreamName: s.streamId}
+	}), ConcurrencyRetryOptions{Backoff: time.Hour})
+
+	_, err := dispatcher.Dispatch(ctx, NewCommandMessage(s.streamId, &SomeCommand{Count: 1}))
+	c.Assert(err, FitsTypeOf, &ErrConcurrencyViolation{})
+	c.Assert(attempts, Equals, 1)
+}
+
+func (s *ConcurrencyRetrySuite) TestUpdateAggregateReloadsOnConflict(c *C) {
+	attempts := 0
+	err := UpdateAggregate(s.ctx, s.repo, s.streamId, func() AggregateRoot {
+		return newRoutedAggregate(s.streamId)
+	}, func(agg AggregateRoot) error {
+		attempts++
+		if attempts == 1 {
+			s.addConcurrently(c, 100)
+		}
+
+		return agg.(*routedAggregate).Raise(NewTypedEvent(ItemAdded{Count: 1}))
+	}, ConcurrencyRetryOptions{Backoff: time.Millisecond})
+
+	c.Assert(err, IsNil)
+	c.Assert(attempts, Equals, 2)
+	c.Assert(s.count(c), Equals, 101)
+}
+
+func (s *ConcurrencyRetrySuite) TestJitterStaysWithinBackoff(c *C) {
+	for i := 0; i < 100; i++ {
+		d := jitter(10 * time.Millisecond)
+		c.Assert(d >= 5*time.Millisecond && d <= 10*time.Millisecond, Equals, true, Commentf("jitter %s", d))
+	}
+}
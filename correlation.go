@@ -0,0 +1,138 @@
+package ycq
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// HeaderCommandId is the header the dispatcher sets on every command to
+	// identify it, it is the causation id of the events and commands the
+	// command causes.
+	HeaderCommandId = "command_id"
+
+	// HeaderCorrelationId is the header shared by all commands and events that
+	// stem from the same original command.
+	HeaderCorrelationId = "correlation_id"
+
+	// HeaderCausationId is the header that holds the id of the command that
+	// caused a command or event.
+	HeaderCausationId = "causation_id"
+
+	// HeaderActor is the header that holds the user or system on whose behalf a
+	// command was dispatched.
+	HeaderActor = "actor"
+
+	// HeaderTimestamp is the header that holds the time a command was dispatched
+	// or an event was persisted.
+	HeaderTimestamp = "timestamp"
+)
+
+// ContextWithActor returns a copy of ctx carrying the actor, commands
+// dispatched with the returned context are stamped with it.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return ContextWithHeaders(ctx, map[string]interface{}{HeaderActor: actor})
+}
+
+// CorrelationId returns the correlation id in the headers of a command or event.
+func CorrelationId(headers map[string]interface{}) string {
+	s, _ := headers[HeaderCorrelationId].(string)
+	return s
+}
+
+// CausationId returns the causation id in the headers of a command or event.
+func CausationId(headers map[string]interface{}) string {
+	s, _ := headers[HeaderCausationId].(string)
+	return s
+}
+
+// Actor returns the actor in the headers of a command or event.
+func Actor(headers map[string]interface{}) string {
+	s, _ := headers[HeaderActor].(string)
+	return s
+}
+
+// Timestamp returns the timestamp in the headers of a command or event.
+//
+// Timestamps read back from stores that keep headers as strings are parsed
+// from RFC 3339.
+func Timestamp(headers map[string]interface{}) (time.Time, bool) {
+	switch t := headers[HeaderTimestamp].(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// stampCommand sets the standard headers the command does not have yet and
+// returns the context for its handler.
+//
+// The correlation id, causation id and actor are taken from ctx, so commands
+// dispatched by a handler inherit them. A command dispatched without them
+// starts a new correlation, its own id is then the correlation and causation id.
+func stampCommand(ctx context.Context, command CommandMessage) context.Context {
+	fromCtx := HeadersFromContext(ctx)
+
+	generatedId := ""
+	commandId := CommandID(command)
+	if commandId == "" {
+		commandId = NewUUID()
+		generatedId = commandId
+		command.SetHeader(HeaderCommandId, commandId)
+	}
+
+	setMissingHeader(command.Headers(), command.SetHeader, HeaderCorrelationId, fromCtx[HeaderCorrelationId], commandId)
+	setMissingHeader(command.Headers(), command.SetHeader, HeaderCausationId, fromCtx[HeaderCausationId], commandId)
+	setMissingHeader(command.Headers(), command.SetHeader, HeaderActor, fromCtx[HeaderActor])
+	setMissingHeader(command.Headers(), command.SetHeader, HeaderTimestamp, time.Now().UTC())
+
+	stamped := map[string]interface{}{
+		HeaderCorrelationId: command.Headers()[HeaderCorrelationId],
+		HeaderCausationId:   commandId,
+	}
+	if actor, ok := command.Headers()[HeaderActor]; ok {
+		stamped[HeaderActor] = actor
+	}
+
+	return context.WithValue(ContextWithHeaders(ctx, stamped), generatedCommandIdKey{}, generatedId)
+}
+
+// generatedCommandIdKey is the context key of the command id stampCommand
+// generated for a command dispatched without one.
+type generatedCommandIdKey struct{}
+
+// commandIdGenerated tells whether the id of the command was generated by the
+// dispatcher rather than supplied by the caller.
+func commandIdGenerated(ctx context.Context, command CommandMessage) bool {
+	id, _ := ctx.Value(generatedCommandIdKey{}).(string)
+	return id != "" && id == CommandID(command)
+}
+
+// stampEvent copies the correlation id, causation id and actor carried by ctx
+// onto the event and timestamps it, headers the event already has are kept.
+func stampEvent(ctx context.Context, event EventMessage) {
+	fromCtx := HeadersFromContext(ctx)
+	for _, key := range []string{HeaderCorrelationId, HeaderCausationId, HeaderActor} {
+		setMissingHeader(event.GetHeaders(), event.SetHeader, key, fromCtx[key])
+	}
+	setMissingHeader(event.GetHeaders(), event.SetHeader, HeaderTimestamp, time.Now().UTC())
+}
+
+// setMissingHeader sets the header to the first non nil value when headers
+// does not have it.
+func setMissingHeader(headers map[string]interface{}, set func(string, interface{}), key string, values ...interface{}) {
+	if v, ok := headers[key]; ok && v != nil {
+		return
+	}
+
+	for _, v := range values {
+		if v != nil {
+			set(key, v)
+			return
+		}
+	}
+}
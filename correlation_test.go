@@ -0,0 +1,134 @@
+package ycq
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CorrelationSuite{})
+
+type CorrelationSuite struct {
+	dispatcher *InMemoryDispatcher
+	repo       DomainRepository
+	ctx        context.Context
+}
+
+func (s *CorrelationSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	s.dispatcher = NewInMemoryDispatcher()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	s.repo, err = NewSqlDomainRepository(eventRepo, NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	factory.RegisterDelegate("SomeEvent",
+		func() Event { return &SomeEvent{} })
+	s.repo.SetEventFactory(factory)
+}
+
+// handlerRecordingContext returns a handler that records the commands and the
+// contexts it is called with.
+func handlerRecordingContext(commands *[]CommandMessage, contexts *[]context.Context) CommandHandler {
+	return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		*commands = append(*commands, command)
+		*contexts = append(*contexts, ctx)
+		return nil, nil
+	})
+}
+
+func (s *CorrelationSuite) TestDispatchStampsCommand(c *C) {
+	var commands []CommandMessage
+	var contexts []context.Context
+	c.Assert(s.dispatcher.RegisterHandler(handlerRecordingContext(&commands, &contexts), &SomeCommand{}), IsNil)
+
+	_, err := s.dispatcher.Dispatch(ContextWithActor(s.ctx, "alice"), NewCommandMessage(NewUUID(), &SomeCommand{}))
+	c.Assert(err, IsNil)
+
+	headers := commands[0].Headers()
+	commandId := headers[HeaderCommandId].(string)
+	c.Assert(commandId, Not(Equals), "")
+	c.Assert(CorrelationId(headers), Equals, commandId)
+	c.Assert(CausationId(headers), Equals, commandId)
+	c.Assert(Actor(headers), Equals, "alice")
+	_, ok := Timestamp(headers)
+	c.Assert(ok, Equals, true)
+
+	fromCtx := HeadersFromContext(contexts[0])
+	c.Assert(fromCtx[HeaderCorrelationId], Equals, commandId)
+	c.Assert(fromCtx[HeaderCausationId], Equals, commandId)
+	c.Assert(fromCtx[HeaderActor], Equals, "alice")
+}
+
+func (s *CorrelationSuite) TestCommandsDispatchedByHandlersInheritCorrelation(c *C) {
+	var commands []CommandMessage
+	var contexts []context.Context
+	c.Assert(s.dispatcher.RegisterHandler(handlerRecordingContext(&commands, &contexts), &SomeOtherCommand{}), IsNil)
+	c.Assert(s.dispatcher.RegisterHandler(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		return s.dispatcher.Dispatch(ctx, NewCommandMessage(NewUUID(), &SomeOtherCommand{}))
+	}), &SomeCommand{}), IsNil)
+
+	parent := NewCommandMessage(NewUUID(), &SomeCommand{})
+	parent.SetHeader(HeaderCorrelationId, "flow-1")
+	_, err := s.dispatcher.Dispatch(s.ctx, parent)
+	c.Assert(err, IsNil)
+
+	headers := commands[0].Headers()
+	c.Assert(CorrelationId(headers), Equals, "flow-1")
+	c.Assert(CausationId(headers), Equals, parent.Headers()[HeaderCommandId])
+	c.Assert(headers[HeaderCommandId], Not(Equals), parent.Headers()[HeaderCommandId])
+}
+
+func (s *CorrelationSuite) TestSavedEventsCarryCorrelationOfCommand(c *C) {
+	id := NewUUID()
+	c.Assert(s.dispatcher.RegisterHandler(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		agg := NewRebuildableAggregate(id)
+		agg.TrackChange(NewEventMessage(nil, &SomeEvent{}, nil))
+		return nil, s.repo.Save(ctx, id, agg, nil)
+	}), &SomeCommand{}), IsNil)
+
+	command := NewCommandMessage(id, &SomeCommand{})
+	_, err := s.dispatcher.Dispatch(ContextWithActor(s.ctx, "alice"), command)
+	c.Assert(err, IsNil)
+
+	got := NewRebuildableAggregate(id)
+	c.Assert(s.repo.Load(s.ctx, id, got), IsNil)
+	c.Assert(got.events, HasLen, 1)
+
+	headers := got.events[0].GetHeaders()
+	c.Assert(CorrelationId(headers), Equals, CorrelationId(command.Headers()))
+	c.Assert(CausationId(headers), Equals, command.Headers()[HeaderCommandId])
+	c.Assert(Actor(headers), Equals, "alice")
+	_, ok := Timestamp(headers)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *CorrelationSuite) TestInMemoryRepositoryRestoresStandardHeaders(c *C) {
+	repo := NewInMemoryEventRepository()
+	ev := NewEventMessage(nil, &SomeEvent{}, nil)
+	at := time.Date(2022, 12, 3, 9, 0, 0, 0, time.UTC)
+	ev.SetHeader(HeaderCorrelationId, "flow-1")
+	ev.SetHeader(HeaderCausationId, "command-1")
+	ev.SetHeader(HeaderTimestamp, at)
+	c.Assert(repo.Append(s.ctx, "stream", []EventMessage{ev}, nil), IsNil)
+
+	evs, err := repo.Read(s.ctx).Stream("stream").ToList()
+	c.Assert(err, IsNil)
+	c.Assert(evs, HasLen, 1)
+
+	headers := evs[0].GetHeaders()
+	c.Assert(CorrelationId(headers), Equals, "flow-1")
+	c.Assert(CausationId(headers), Equals, "command-1")
+	c.Assert(headers[HeaderTimestamp], Equals, at)
+}
+
+func (s *CorrelationSuite) TestTimestampParsesStrings(c *C) {
+	at := time.Date(2022, 12, 3, 9, 0, 0, 0, time.UTC)
+	got, ok := Timestamp(map[string]interface{}{HeaderTimestamp: at.Format(time.RFC3339Nano)})
+	c.Assert(ok, Equals, true)
+	c.Assert(got.Equal(at), Equals, true)
+}
@@ -0,0 +1,408 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeadLetterKind tells whether a dead letter is an event or a command.
+type DeadLetterKind string
+
+const (
+	DeadLetterKindEvent   DeadLetterKind = "event"
+	DeadLetterKindCommand DeadLetterKind = "command"
+)
+
+// DeadLetterEntry is an event or command a handler failed to handle, parked in
+// a DeadLetterStore to be inspected and replayed later.
+type DeadLetterEntry struct {
+	ID   int64
+	Kind DeadLetterKind
+
+	// Name is the name of the event or command.
+	Name string
+
+	// Handler is the name of the handler that failed.
+	Handler string
+
+	// EventID and Version are set for events only.
+	EventID *string
+	Version *int
+
+	// AggregateID is the id of the aggregate of a command or the stream of
+	// an event.
+	AggregateID string
+
+	// Data is the serialised event or command.
+	Data    string
+	Headers map[string]interface{}
+
+	// Error is the error returned by the last attempt.
+	Error    string
+	Attempts int
+
+	CreatedAt time.Time
+}
+
+// EventMessage rebuilds the parked event. The event is a RawEvent when factory
+// is nil.
+func (d *DeadLetterEntry) EventMessage(factory EventFactory) (EventMessage, error) {
+	if d.Kind != DeadLetterKindEvent {
+		return nil, fmt.Errorf("dead letter %d is a %s, not an event", d.ID, d.Kind)
+	}
+
+	em := NewEventMessage(d.EventID, NewRawEvent(d.Name, d.Data), d.Version)
+	for k, v := range d.Headers {
+		em.SetHeader(k, v)
+	}
+
+	if factory == nil {
+		return em, nil
+	}
+
+	return decodeEvent(factory, nil, em)
+}
+
+// CommandMessage rebuilds the parked command using the factory to instantiate
+// the command.
+func (d *DeadLetterEntry) CommandMessage(factory CommandFactory) (CommandMessage, error) {
+	if d.Kind != DeadLetterKindCommand {
+		return nil, fmt.Errorf("dead letter %d is a %s, not a command", d.ID, d.Kind)
+	}
+
+	command := factory.GetCommand(d.Name)
+	if command == nil {
+		return nil, fmt.Errorf("no command registered with the factory for type: %s", d.Name)
+	}
+
+	if err := json.Unmarshal([]byte(d.Data), command); err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	cm := NewCommandMessage(d.AggregateID, command)
+	for k, v := range d.Headers {
+		cm.SetHeader(k, v)
+	}
+
+	return cm, nil
+}
+
+// CommandFailure describes a command a handler failed to handle.
+type CommandFailure struct {
+	Command CommandMessage
+
+	// HandlerName names the handler of the command, DeadLetterMiddleware
+	// records the name of the command.
+	HandlerName string
+
+	// Err is the error returned by the last attempt.
+	Err error
+
+	// Attempts is the number of times the handler was called with the command.
+	Attempts int
+}
+
+// DeadLetterQuery selects dead letters, zero fields match all dead letters.
+type DeadLetterQuery struct {
+	Kind DeadLetterKind
+	Name string
+
+	// Limit is the maximum number of dead letters returned by List.
+	Limit int
+}
+
+func (q DeadLetterQuery) matches(d *DeadLetterEntry) bool {
+	return (q.Kind == "" || q.Kind == d.Kind) && (q.Name == "" || q.Name == d.Name)
+}
+
+// CommandParker is implemented by stores that park commands that could not be
+// handled, e.g. a dead-letter store.
+type CommandParker interface {
+	ParkCommand(ctx context.Context, failure *CommandFailure) error
+}
+
+// DeadLetterStore stores the events and commands handlers failed to handle.
+//
+// A DeadLetterStore is an EventParker and a CommandParker, it is passed to the
+// DeadLetter error policy to park events and to DeadLetterMiddleware or a
+// CommandScheduler to park commands.
+type DeadLetterStore interface {
+	EventParker
+	CommandParker
+
+	// List returns the dead letters matching the query, oldest first.
+	List(ctx context.Context, query DeadLetterQuery) ([]*DeadLetterEntry, error)
+
+	// Get returns the dead letter with the id, or ErrDeadLetterNotFound.
+	Get(ctx context.Context, id int64) (*DeadLetterEntry, error)
+
+	// Delete removes the dead letter with the id.
+	Delete(ctx context.Context, id int64) error
+
+	// Purge removes the dead letters matching the query and returns how
+	// many were removed. The limit of the query is ignored.
+	Purge(ctx context.Context, query DeadLetterQuery) (int, error)
+}
+
+// newEventDeadLetter serialises a failed event.
+func newEventDeadLetter(failure *HandlerFailure) (*DeadLetterEntry, error) {
+	data, err := failure.Event.Event().Marshal()
+	if err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	streamId, _ := EventStreamId(failure.Event)
+
+	return &DeadLetterEntry{
+		Kind:        DeadLetterKindEvent,
+		Name:        failure.Event.Event().Name(),
+		Handler:     failure.HandlerName,
+		EventID:     failure.Event.EventID(),
+		AggregateID: streamId,
+		Version:     failure.Event.Version(),
+		Data:        data,
+		Headers:     failure.Event.GetHeaders(),
+		Error:       failure.Err.Error(),
+		Attempts:    failure.Attempts,
+	}, nil
+}
+
+// newCommandDeadLetter serialises a failed command.
+func newCommandDeadLetter(failure *CommandFailure) (*DeadLetterEntry, error) {
+	data, err := json.Marshal(failure.Command.Command())
+	if err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	return &DeadLetterEntry{
+		Kind:        DeadLetterKindCommand,
+		Name:        failure.Command.CommandName(),
+		Handler:     failure.HandlerName,
+		AggregateID: failure.Command.AggregateID(),
+		Data:        string(data),
+		Headers:     failure.Command.Headers(),
+		Error:       failure.Err.Error(),
+		Attempts:    failure.Attempts,
+	}, nil
+}
+
+// InMemoryDeadLetterStore is a DeadLetterStore that keeps the dead letters in
+// memory, it is meant for tests and single process applications.
+type InMemoryDeadLetterStore struct {
+	sync.RWMutex
+	lastID  int64
+	letters map[int64]*DeadLetterEntry
+}
+
+// NewInMemoryDeadLetterStore constructs an empty InMemoryDeadLetterStore.
+func NewInMemoryDeadLetterStore() *InMemoryDeadLetterStore {
+	return &InMemoryDeadLetterStore{
+		letters: make(map[int64]*DeadLetterEntry),
+	}
+}
+
+func (s *InMemoryDeadLetterStore) ParkEvent(ctx context.Context, failure *HandlerFailure) error {
+	letter, err := newEventDeadLetter(failure)
+	if err != nil {
+		return err
+	}
+
+	s.park(letter)
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) ParkCommand(ctx context.Context, failure *CommandFailure) error {
+	letter, err := newCommandDeadLetter(failure)
+	if err != nil {
+		return err
+	}
+
+	s.park(letter)
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) park(letter *DeadLetterEntry) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastID++
+	letter.ID = s.lastID
+	letter.CreatedAt = time.Now()
+	letter.Headers = copyHeaders(letter.Headers)
+	s.letters[letter.ID] = letter
+}
+
+func (s *InMemoryDeadLetterStore) List(ctx context.Context, query DeadLetterQuery) ([]*DeadLetterEntry, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var letters []*DeadLetterEntry
+	for _, letter := range s.letters {
+		if query.matches(letter) {
+			letters = append(letters, copyDeadLetter(letter))
+		}
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].ID < letters[j].ID
+	})
+
+	if query.Limit > 0 && len(letters) > query.Limit {
+		letters = letters[:query.Limit]
+	}
+
+	return letters, nil
+}
+
+func (s *InMemoryDeadLetterStore) Get(ctx context.Context, id int64) (*DeadLetterEntry, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil, &ErrDeadLetterNotFound{ID: id}
+	}
+
+	return copyDeadLetter(letter), nil
+}
+
+func (s *InMemoryDeadLetterStore) Delete(ctx context.Context, id int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.letters, id)
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) Purge(ctx context.Context, query DeadLetterQuery) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	purged := 0
+	for id, letter := range s.letters {
+		if query.matches(letter) {
+			delete(s.letters, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func copyDeadLetter(letter *DeadLetterEntry) *DeadLetterEntry {
+	c := *letter
+	c.Headers = copyHeaders(letter.Headers)
+	return &c
+}
+
+func copyHeaders(headers map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(headers))
+	for k, v := range headers {
+		c[k] = v
+	}
+	return c
+}
+
+// ReplayDeadLetterEvent delivers a parked event to the handler that failed to
+// handle it and removes it from the store once the handler succeeded. The
+// other handlers of the event are not called again. The event is delivered as
+// a RawEvent when factory is nil.
+//
+// handler is the handler that was wrapped with WithErrorPolicy, its type must
+// be the Handler recorded in the dead letter.
+func ReplayDeadLetterEvent(ctx context.Context, store DeadLetterStore, id int64, handler EventHandler, factory EventFactory) error {
+	letter, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if name := handlerName(handler); name != letter.Handler {
+		return fmt.Errorf("dead letter %d was parked by handler %s, not %s", id, letter.Handler, name)
+	}
+
+	event, err := letter.EventMessage(factory)
+	if err != nil {
+		return err
+	}
+
+	if h, ok := handler.(ErrorAwareEventHandler); ok {
+		if err := h.HandleEvent(ctx, event); err != nil {
+			return err
+		}
+	} else {
+		handler.Handle(ctx, event)
+	}
+
+	return store.Delete(ctx, id)
+}
+
+// ReplayDeadLetterCommand dispatches a parked command and removes it from the
+// store once it was handled.
+func ReplayDeadLetterCommand(ctx context.Context, store DeadLetterStore, id int64, dispatcher Dispatcher, factory CommandFactory) (any, error) {
+	letter, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	command, err := letter.CommandMessage(factory)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := dispatcher.Dispatch(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, store.Delete(ctx, id)
+}
+
+// DeadLetterMiddleware retries failed commands up to retries times, waiting
+// backoff between attempts, and parks the commands that keep failing in the
+// store. The error of the handler is still returned to the dispatcher.
+//
+// A dispatcher has a single handler per command, the dead letters of commands
+// record the name of the command as their Handler. An ErrPublishFailed or an
+// ErrSnapshotFailed is returned once the events of the command were committed,
+// they are neither retried nor parked.
+func DeadLetterMiddleware(store DeadLetterStore, retries int, backoff time.Duration) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+			result, err := next.Handle(ctx, command)
+			attempts := 1
+			for ; err != nil && !isCommittedError(err) && attempts <= retries; attempts++ {
+				select {
+				case <-ctx.Done():
+					return nil, err
+				case <-time.After(backoff):
+				}
+
+				result, err = next.Handle(ctx, command)
+			}
+
+			if err == nil {
+				return result, nil
+			}
+
+			if isCommittedError(err) {
+				return result, err
+			}
+
+			parkErr := store.ParkCommand(ctx, &CommandFailure{
+				Command:     command,
+				HandlerName: command.CommandName(),
+				Err:         err,
+				Attempts:    attempts,
+			})
+			if parkErr != nil {
+				return nil, fmt.Errorf("parking command failed: %s, handler failed: %w", parkErr, err)
+			}
+
+			return nil, err
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = suiteForEveryRepository(func(fixture repositoryFixture) interface{} {
+	return &DeadLetterStoreSuite{repositoryFixture: fixture}
+})
+
+// DeadLetterStoreSuite runs against every DeadLetterStore implementation.
+type DeadLetterStoreSuite struct {
+	repositoryFixture
+	store DeadLetterStore
+	ctx   context.Context
+}
+
+func (s *DeadLetterStoreSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	repo := s.openRepository(c)
+
+	s.store = NewInMemoryDeadLetterStore()
+	if s.sql {
+		var err error
+		s.store, err = NewSqlDeadLetterStore(repo)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *DeadLetterStoreSuite) parkEvent(c *C, item string) string {
+	streamId := NewUUID()
+	event := NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: item, Count: 3}), Int(2))
+	event.SetHeader(HeaderStreamId, streamId)
+
+	err := s.store.ParkEvent(s.ctx, &HandlerFailure{
+		HandlerName: "ItemProjection",
+		Event:       event,
+		Err:         fmt.Errorf("projection unavailable"),
+		Attempts:    3,
+	})
+	c.Assert(err, IsNil)
+
+	return streamId
+}
+
+func (s *DeadLetterStoreSuite) parkCommand(c *C, item string) string {
+	id := NewUUID()
+	command := NewCommandMessage(id, &SomeCommand{Item: item, Count: 4})
+	command.SetHeader("user", "alice")
+
+	err := s.store.ParkCommand(s.ctx, &CommandFailure{
+		Command:     command,
+		HandlerName: "SomeCommandHandler",
+		Err:         fmt.Errorf("aggregate locked"),
+		Attempts:    1,
+	})
+	c.Assert(err, IsNil)
+
+	return id
+}
+
+func (s *DeadLetterStoreSuite) TestParkedEventCanBeInspected(c *C) {
+	streamId := s.parkEvent(c, "a")
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+
+	letter, err := s.store.Get(s.ctx, letters[0].ID)
+	c.Assert(err, IsNil)
+	c.Assert(letter.Kind, Equals, DeadLetterKindEvent)
+	c.Assert(letter.Name, Equals, "ItemAdded")
+	c.Assert(letter.Handler, Equals, "ItemProjection")
+	c.Assert(letter.AggregateID, Equals, streamId)
+	c.Assert(*letter.Version, Equals, 2)
+	c.Assert(letter.Headers[HeaderStreamId], Equals, streamId)
+	c.Assert(letter.Error, Equals, "projection unavailable")
+	c.Assert(letter.Attempts, Equals, 3)
+	c.Assert(letter.CreatedAt.IsZero(), Equals, false)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+
+	event, err := letter.EventMessage(factory)
+	c.Assert(err, IsNil)
+	c.Assert(event.Event().(*TypedEvent[ItemAdded]).Payload(), Equals, ItemAdded{Item: "a", Count: 3})
+}
+
+func (s *DeadLetterStoreSuite) TestParkedCommandCanBeInspected(c *C) {
+	id := s.parkCommand(c, "b")
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{Kind: DeadLetterKindCommand})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Attempts, Equals, 1)
+
+	factory := NewDelegateCommandFactory()
+	c.Assert(factory.RegisterDelegate(&SomeCommand{}, func() interface{} { return &SomeCommand{} }), IsNil)
+
+	command, err := letters[0].CommandMessage(factory)
+	c.Assert(err, IsNil)
+	c.Assert(command.AggregateID(), Equals, id)
+	c.Assert(command.Command(), DeepEquals, &SomeCommand{Item: "b", Count: 4})
+	c.Assert(command.Headers()["user"], Equals, "alice")
+
+	_, err = letters[0].EventMessage(nil)
+	c.Assert(err, NotNil)
+}
+
+func (s *DeadLetterStoreSuite) TestListFiltersAndLimits(c *C) {
+	s.parkEvent(c, "a")
+	s.parkCommand(c, "b")
+	s.parkEvent(c, "c")
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{Kind: DeadLetterKindEvent})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 2)
+	c.Assert(letters[0].ID < letters[1].ID, Equals, true)
+
+	letters, err = s.store.List(s.ctx, DeadLetterQuery{Name: TypeOf(&SomeCommand{})})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+
+	letters, err = s.store.List(s.ctx, DeadLetterQuery{Limit: 2})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 2)
+}
+
+func (s *DeadLetterStoreSuite) TestGetReturnsNotFound(c *C) {
+	_, err := s.store.Get(s.ctx, 42)
+	c.Assert(err, DeepEquals, &ErrDeadLetterNotFound{ID: 42})
+}
+
+func (s *DeadLetterStoreSuite) TestPurge(c *C) {
+	s.parkEvent(c, "a")
+	s.parkCommand(c, "b")
+	s.parkEvent(c, "c")
+
+	n, err := s.store.Purge(s.ctx, DeadLetterQuery{Kind: DeadLetterKindEvent})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	n, err = s.store.Purge(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 0)
+}
+
+func (s *DeadLetterStoreSuite) TestReplayEventRemovesItOnSuccess(c *C) {
+	bus := NewInternalEventBus()
+	h := &failingEventHandler{failures: 1}
+	bus.AddHandler(WithErrorPolicy(h, DeadLetter(s.store)), "ItemAdded")
+	other := &recordingEventHandler{}
+	bus.AddHandler(other, "ItemAdded")
+
+	c.Assert(bus.PublishEvent(s.ctx, NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "a"}), nil)), IsNil)
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Handler, Equals, "failingEventHandler")
+
+	// Only the handler that failed gets the event again.
+	c.Assert(ReplayDeadLetterEvent(s.ctx, s.store, letters[0].ID, other, nil), ErrorMatches, ".* parked by handler failingEventHandler, not recordingEventHandler")
+	c.Assert(ReplayDeadLetterEvent(s.ctx, s.store, letters[0].ID, h, nil), IsNil)
+	c.Assert(h.calls, Equals, 2)
+	c.Assert(other.handledContexts(), HasLen, 1)
+
+	letters, err = s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 0)
+}
+
+func (s *DeadLetterStoreSuite) TestDeadLetterMiddlewareParksFailedCommands(c *C) {
+	calls := 0
+	failing := true
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		calls++
+		if failing {
+			return nil, fmt.Errorf("aggregate locked")
+		}
+		return command.AggregateID(), nil
+	})
+
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(handler, &SomeCommand{}), IsNil)
+	dispatcher.Use(DeadLetterMiddleware(s.store, 2, 0))
+
+	id := NewUUID()
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(id, &SomeCommand{Item: "a"}))
+	c.Assert(err, ErrorMatches, "aggregate locked")
+	c.Assert(calls, Equals, 3)
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Attempts, Equals, 3)
+	c.Assert(letters[0].Handler, Equals, "SomeCommand")
+
+	factory := NewDelegateCommandFactory()
+	c.Assert(factory.RegisterDelegate(&SomeCommand{}, func() interface{} { return &SomeCommand{} }), IsNil)
+
+	failing = false
+	result, err := ReplayDeadLetterCommand(s.ctx, s.store, letters[0].ID, dispatcher, factory)
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, id)
+
+	_, err = s.store.Get(s.ctx, letters[0].ID)
+	c.Assert(err, FitsTypeOf, &ErrDeadLetterNotFound{})
+}
+
+func (s *DeadLetterStoreSuite) TestDeadLetterMiddlewareDoesNotRetryCommittedCommands(c *C) {
+	calls := 0
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		calls++
+		return nil, &ErrPublishFailed{Event: NewTestEventMessage(NewUUID()), Errors: []error{fmt.Errorf("handler failed")}}
+	})
+
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(handler, &SomeCommand{}), IsNil)
+	dispatcher.Use(DeadLetterMiddleware(s.store, 2, 0))
+
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessage(NewUUID(), &SomeCommand{Item: "a"}))
+	c.Assert(err, FitsTypeOf, &ErrPublishFailed{})
+	c.Assert(calls, Equals, 1)
+
+	letters, err := s.store.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 0)
+}
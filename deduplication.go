@@ -0,0 +1,314 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ProcessedCommand records a command handled successfully and its result, or
+// a command being handled.
+type ProcessedCommand struct {
+	CommandID   string
+	CommandName string
+
+	// Result is the JSON encoded value returned by the handler.
+	Result string
+
+	// Pending is set while the command is claimed and being handled.
+	Pending bool
+
+	// ProcessedAt is the time the command was handled, or claimed while it
+	// is pending.
+	ProcessedAt time.Time
+}
+
+// ProcessedCommandStore stores the commands handled successfully, it is the
+// store behind DeduplicationMiddleware.
+type ProcessedCommandStore interface {
+	// Get returns the processed or pending command with the id, or nil when
+	// no command with the id was recorded.
+	Get(ctx context.Context, commandID string) (*ProcessedCommand, error)
+
+	// Claim records a pending command before it is handled. It returns nil
+	// when the command was claimed, otherwise the command recorded with the
+	// id already. A pending command claimed before staleBefore is claimed
+	// again, its handler is presumed to have died.
+	Claim(ctx context.Context, command *ProcessedCommand, staleBefore time.Time) (*ProcessedCommand, error)
+
+	// Save records a processed command, completing its claim. A command
+	// processed already keeps its first result.
+	Save(ctx context.Context, command *ProcessedCommand) error
+
+	// Release removes the claim of a pending command, so it can be handled
+	// again.
+	Release(ctx context.Context, commandID string) error
+
+	// Purge removes the commands processed before the time and returns how
+	// many were removed.
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// InMemoryProcessedCommandStore is a ProcessedCommandStore that keeps the
+// processed commands in memory, it is meant for tests and single process
+// applications.
+type InMemoryProcessedCommandStore struct {
+	sync.RWMutex
+	commands map[string]*ProcessedCommand
+}
+
+// NewInMemoryProcessedCommandStore constructs an empty InMemoryProcessedCommandStore.
+func NewInMemoryProcessedCommandStore() *InMemoryProcessedCommandStore {
+	return &InMemoryProcessedCommandStore{
+		commands: make(map[string]*ProcessedCommand),
+	}
+}
+
+func (s *InMemoryProcessedCommandStore) Get(ctx context.Context, commandID string) (*ProcessedCommand, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	command, ok := s.commands[commandID]
+	if !ok {
+		return nil, nil
+	}
+
+	c := *command
+	return &c, nil
+}
+
+func (s *InMemoryProcessedCommandStore) Claim(ctx context.Context, command *ProcessedCommand, staleBefore time.Time) (*ProcessedCommand, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if existing, ok := s.commands[command.CommandID]; ok && !(existing.Pending && existing.ProcessedAt.Before(staleBefore)) {
+		c := *existing
+		return &c, nil
+	}
+
+	c := *command
+	c.Result = ""
+	c.Pending = true
+	if c.ProcessedAt.IsZero() {
+		c.ProcessedAt = time.Now()
+	}
+	s.commands[c.CommandID] = &c
+
+	return nil, nil
+}
+
+func (s *InMemoryProcessedCommandStore) Save(ctx context.Context, command *ProcessedCommand) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if existing, ok := s.commands[command.CommandID]; ok && !existing.Pending {
+		return nil
+	}
+
+	c := *command
+	c.Pending = false
+	if c.ProcessedAt.IsZero() {
+		c.ProcessedAt = time.Now()
+	}
+	s.commands[c.CommandID] = &c
+
+	return nil
+}
+
+func (s *InMemoryProcessedCommandStore) Release(ctx context.Context, commandID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if existing, ok := s.commands[commandID]; ok && existing.Pending {
+		delete(s.commands, commandID)
+	}
+
+	return nil
+}
+
+func (s *InMemoryProcessedCommandStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	purged := 0
+	for id, command := range s.commands {
+		if command.ProcessedAt.Before(before) {
+			delete(s.commands, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// deduplicationClaimTimeout is how long a command claimed by a handler that
+// did not complete it blocks its duplicates, e.g. after a crash.
+const deduplicationClaimTimeout = 5 * time.Minute
+
+// DeduplicationMiddleware handles every command id once. A command with the id
+// of a command handled successfully before is not handled again, the result of
+// the first command is returned instead.
+//
+// Results are kept JSON encoded in the store. newResult returns a pointer to a
+// new value of the result type of a command, e.g. new(string), for results to
+// be decoded into. When newResult is nil or returns nil the result of a
+// duplicate is decoded by json.Unmarshal into an interface{}, so it is not of
+// the type the handler returned, e.g. a struct comes back as a
+// map[string]interface{} and an int as a float64.
+//
+// A command is claimed in the store before it is handled. Commands whose
+// handler fails are released, so they can be retried, unless the handler
+// failed with ErrPublishFailed or ErrSnapshotFailed after the events of the
+// command were persisted: the command is then recorded as processed and its
+// duplicates return its result without an error. Duplicates dispatched
+// in this process while the first command is being handled wait for it,
+// duplicates of a command being handled by another process fail with
+// ErrCommandInFlight. A claim that was not completed within five minutes,
+// e.g. because its process died, is taken over by the next duplicate.
+//
+// Only the ids supplied by the caller are deduplicated, see
+// NewCommandMessageWithID. Commands dispatched without an id get a new one
+// from the dispatcher and are handled without being recorded.
+func DeduplicationMiddleware(store ProcessedCommandStore, newResult func(commandName string) interface{}) CommandMiddleware {
+	inflight := newKeyedLocks()
+
+	return func(next CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+			id := CommandID(command)
+			if id == "" || commandIdGenerated(ctx, command) {
+				return next.Handle(ctx, command)
+			}
+
+			release, err := inflight.acquire(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+
+			claim := &ProcessedCommand{
+				CommandID:   id,
+				CommandName: command.CommandName(),
+				ProcessedAt: time.Now(),
+			}
+			existing, err := store.Claim(ctx, claim, claim.ProcessedAt.Add(-deduplicationClaimTimeout))
+			if err != nil {
+				return nil, err
+			}
+
+			if existing != nil {
+				if existing.Pending {
+					return nil, &ErrCommandInFlight{CommandID: id}
+				}
+
+				return decodeCommandResult(existing, newResult)
+			}
+
+			result, err := next.Handle(ctx, command)
+			if err != nil && !isCommittedError(err) {
+				if releaseErr := store.Release(ctx, id); releaseErr != nil {
+					return nil, fmt.Errorf("releasing command failed: %s, handler failed: %w", releaseErr, err)
+				}
+
+				return nil, err
+			}
+
+			// A command failing with ErrPublishFailed or ErrSnapshotFailed
+			// persisted its events, it is recorded as processed so that a
+			// retry does not persist them again.
+			data, encodeErr := json.Marshal(result)
+			if encodeErr != nil && err == nil {
+				if releaseErr := store.Release(ctx, id); releaseErr != nil {
+					return result, fmt.Errorf("releasing command failed: %s, encoding result failed: %w", releaseErr, encodeErr)
+				}
+
+				return result, &ErrUnexpected{Err: encodeErr}
+			}
+
+			processed := &ProcessedCommand{
+				CommandID:   id,
+				CommandName: command.CommandName(),
+				ProcessedAt: time.Now(),
+			}
+			if encodeErr == nil {
+				processed.Result = string(data)
+			}
+
+			if saveErr := store.Save(ctx, processed); saveErr != nil {
+				if err != nil {
+					return result, fmt.Errorf("recording command failed: %s, handler failed: %w", saveErr, err)
+				}
+
+				return result, saveErr
+			}
+
+			return result, err
+		})
+	}
+}
+
+func decodeCommandResult(processed *ProcessedCommand, newResult func(commandName string) interface{}) (any, error) {
+	if processed.Result == "" {
+		return nil, nil
+	}
+
+	if newResult != nil {
+		if p := newResult(processed.CommandName); p != nil {
+			if err := json.Unmarshal([]byte(processed.Result), p); err != nil {
+				return nil, &ErrUnexpected{Err: err}
+			}
+
+			return reflect.ValueOf(p).Elem().Interface(), nil
+		}
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(processed.Result), &result); err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	return result, nil
+}
+
+// keyedLocks serialises the work on the same key, e.g. the handling of
+// commands with the same id.
+type keyedLocks struct {
+	sync.Mutex
+	held map[string]chan struct{}
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{
+		held: make(map[string]chan struct{}),
+	}
+}
+
+// acquire waits until the key is not held and returns the function that
+// releases it.
+func (f *keyedLocks) acquire(ctx context.Context, key string) (func(), error) {
+	for {
+		f.Lock()
+		done, ok := f.held[key]
+		if !ok {
+			done = make(chan struct{})
+			f.held[key] = done
+			f.Unlock()
+
+			return func() {
+				f.Lock()
+				delete(f.held, key)
+				f.Unlock()
+				close(done)
+			}, nil
+		}
+		f.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
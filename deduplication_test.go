@@ -0,0 +1,288 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = suiteForEveryRepository(func(fixture repositoryFixture) interface{} {
+	return &DeduplicationSuite{repositoryFixture: fixture}
+})
+
+// DeduplicationSuite runs against every ProcessedCommandStore implementation.
+type DeduplicationSuite struct {
+	repositoryFixture
+	store ProcessedCommandStore
+	ctx   context.Context
+}
+
+func (s *DeduplicationSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	repo := s.openRepository(c)
+
+	s.store = NewInMemoryProcessedCommandStore()
+	if s.sql {
+		var err error
+		s.store, err = NewSqlProcessedCommandStore(repo)
+		c.Assert(err, IsNil)
+	}
+}
+
+type dedupResult struct {
+	Item  string
+	Count int
+}
+
+func (s *DeduplicationSuite) dispatcher(c *C, handler CommandHandler, newResult func(string) interface{}) *InMemoryDispatcher {
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(handler, &SomeCommand{}), IsNil)
+	dispatcher.UseFor(&SomeCommand{}, DeduplicationMiddleware(s.store, newResult))
+
+	return dispatcher
+}
+
+func (s *DeduplicationSuite) TestStoreKeepsFirstResult(c *C) {
+	processed, err := s.store.Get(s.ctx, "missing")
+	c.Assert(err, IsNil)
+	c.Assert(processed, IsNil)
+
+	c.Assert(s.store.Save(s.ctx, &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand", Result: `"first"`}), IsNil)
+	c.Assert(s.store.Save(s.ctx, &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand", Result: `"second"`}), IsNil)
+
+	processed, err = s.store.Get(s.ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(processed.CommandName, Equals, "SomeCommand")
+	c.Assert(processed.Result, Equals, `"first"`)
+	c.Assert(processed.ProcessedAt.IsZero(), Equals, false)
+}
+
+func (s *DeduplicationSuite) TestStorePurgesOldCommands(c *C) {
+	old := time.Now().Add(-48 * time.Hour)
+	c.Assert(s.store.Save(s.ctx, &ProcessedCommand{CommandID: "old", CommandName: "SomeCommand", ProcessedAt: old}), IsNil)
+	c.Assert(s.store.Save(s.ctx, &ProcessedCommand{CommandID: "new", CommandName: "SomeCommand", ProcessedAt: time.Now()}), IsNil)
+
+	purged, err := s.store.Purge(s.ctx, time.Now().Add(-24*time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(purged, Equals, 1)
+
+	processed, err := s.store.Get(s.ctx, "old")
+	c.Assert(err, IsNil)
+	c.Assert(processed, IsNil)
+
+	processed, err = s.store.Get(s.ctx, "new")
+	c.Assert(err, IsNil)
+	c.Assert(processed, NotNil)
+}
+
+func (s *DeduplicationSuite) TestDuplicateReturnsOriginalResult(c *C) {
+	calls := 0
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		calls++
+		cmd := command.Command().(*SomeCommand)
+		return &dedupResult{Item: cmd.Item, Count: calls}, nil
+	})
+
+	dispatcher := s.dispatcher(c, handler, func(string) interface{} { return new(*dedupResult) })
+
+	commandID := NewUUID()
+	aggregateID := NewUUID()
+	result, err := dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, aggregateID, &SomeCommand{Item: "a"}))
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, &dedupResult{Item: "a", Count: 1})
+
+	result, err = dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, aggregateID, &SomeCommand{Item: "a"}))
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, &dedupResult{Item: "a", Count: 1})
+	c.Assert(calls, Equals, 1)
+
+	_, err = dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(NewUUID(), aggregateID, &SomeCommand{Item: "a"}))
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 2)
+}
+
+func (s *DeduplicationSuite) TestResultDecodedWithoutType(c *C) {
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		return "done", nil
+	})
+
+	dispatcher := s.dispatcher(c, handler, nil)
+
+	commandID := NewUUID()
+	for i := 0; i < 2; i++ {
+		result, err := dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+		c.Assert(err, IsNil)
+		c.Assert(result, Equals, "done")
+	}
+}
+
+func (s *DeduplicationSuite) TestFailedCommandIsNotRecorded(c *C) {
+	calls := 0
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("aggregate locked")
+		}
+		return nil, nil
+	})
+
+	dispatcher := s.dispatcher(c, handler, nil)
+
+	commandID := NewUUID()
+	_, err := dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, ErrorMatches, "aggregate locked")
+
+	result, err := dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, IsNil)
+	c.Assert(result, IsNil)
+
+	result, err = dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, IsNil)
+	c.Assert(result, IsNil)
+	c.Assert(calls, Equals, 2)
+}
+
+func (s *DeduplicationSuite) TestConcurrentDuplicatesAreHandledOnce(c *C) {
+	var mu sync.Mutex
+	calls := 0
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return 42, nil
+	})
+
+	dispatcher := s.dispatcher(c, handler, func(string) interface{} { return new(int) })
+
+	commandID := NewUUID()
+	var wg sync.WaitGroup
+	results := make([]any, 5)
+	errs := make([]error, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		c.Assert(errs[i], IsNil)
+		c.Assert(results[i], Equals, 42)
+	}
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *DeduplicationSuite) TestStoreClaimsCommandOnce(c *C) {
+	claim := &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand"}
+	existing, err := s.store.Claim(s.ctx, claim, time.Now().Add(-time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing, IsNil)
+
+	existing, err = s.store.Claim(s.ctx, claim, time.Now().Add(-time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing.Pending, Equals, true)
+
+	c.Assert(s.store.Release(s.ctx, "a"), IsNil)
+	existing, err = s.store.Claim(s.ctx, claim, time.Now().Add(-time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing, IsNil)
+
+	c.Assert(s.store.Save(s.ctx, &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand", Result: `"done"`}), IsNil)
+	c.Assert(s.store.Release(s.ctx, "a"), IsNil)
+
+	existing, err = s.store.Claim(s.ctx, claim, time.Now().Add(time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing.Pending, Equals, false)
+	c.Assert(existing.Result, Equals, `"done"`)
+}
+
+func (s *DeduplicationSuite) TestStaleClaimIsTakenOver(c *C) {
+	claim := &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand", ProcessedAt: time.Now().Add(-time.Hour)}
+	existing, err := s.store.Claim(s.ctx, claim, time.Now().Add(-2*time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing, IsNil)
+
+	claim = &ProcessedCommand{CommandID: "a", CommandName: "SomeCommand", ProcessedAt: time.Now()}
+	existing, err = s.store.Claim(s.ctx, claim, time.Now().Add(-2*time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(existing, NotNil)
+
+	existing, err = s.store.Claim(s.ctx, claim, time.Now().Add(-time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(existing, IsNil)
+}
+
+func (s *DeduplicationSuite) TestCommandClaimedByAnotherProcessIsInFlight(c *C) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		close(started)
+		<-finish
+		return "done", nil
+	})
+
+	// Each dispatcher has a middleware of its own, as in two processes.
+	first := s.dispatcher(c, handler, nil)
+	second := s.dispatcher(c, handler, nil)
+
+	commandID := NewUUID()
+	done := make(chan error)
+	go func() {
+		_, err := first.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+		done <- err
+	}()
+	<-started
+
+	_, err := second.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, FitsTypeOf, &ErrCommandInFlight{})
+
+	close(finish)
+	c.Assert(<-done, IsNil)
+
+	result, err := second.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, "done")
+}
+
+func (s *DeduplicationSuite) TestGeneratedCommandIdsAreNotRecorded(c *C) {
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		return "done", nil
+	})
+
+	dispatcher := s.dispatcher(c, handler, nil)
+
+	command := NewCommandMessage(NewUUID(), &SomeCommand{})
+	_, err := dispatcher.Dispatch(s.ctx, command)
+	c.Assert(err, IsNil)
+	c.Assert(CommandID(command), Not(Equals), "")
+
+	processed, err := s.store.Get(s.ctx, CommandID(command))
+	c.Assert(err, IsNil)
+	c.Assert(processed, IsNil)
+}
+
+func (s *DeduplicationSuite) TestCommittedFailureIsRecorded(c *C) {
+	calls := 0
+	handler := CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		calls++
+		return "done", &ErrPublishFailed{Event: NewTestEventMessage(command.AggregateID()), Errors: []error{fmt.Errorf("bus down")}}
+	})
+
+	dispatcher := s.dispatcher(c, handler, nil)
+
+	commandID := NewUUID()
+	result, err := dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, FitsTypeOf, &ErrPublishFailed{})
+	c.Assert(result, Equals, "done")
+
+	result, err = dispatcher.Dispatch(s.ctx, NewCommandMessageWithID(commandID, NewUUID(), &SomeCommand{}))
+	c.Assert(err, IsNil)
+	c.Assert(result, Equals, "done")
+	c.Assert(calls, Equals, 1)
+}
@@ -8,6 +8,7 @@ package ycq
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 //Dispatcher is the interface that should be implemented by command dispatcher
@@ -26,25 +27,75 @@ import (
 type Dispatcher interface {
 	Dispatch(context.Context, CommandMessage) (any, error)
 	RegisterHandler(CommandHandler, ...interface{}) error
+	UnregisterHandler(...interface{}) error
 }
 
 //InMemoryDispatcher provides a lightweight and performant in process dispatcher
+//
+//It is safe for concurrent use, handlers and middlewares can be registered while
+//commands are dispatched.
 type InMemoryDispatcher struct {
-	handlers map[string]CommandHandler
+	sync.RWMutex
+	handlers           map[string]CommandHandler
+	middlewares        []CommandMiddleware
+	commandMiddlewares map[string][]CommandMiddleware
 }
 
 //NewInMemoryDispatcher constructs a new in memory dispatcher
 func NewInMemoryDispatcher() *InMemoryDispatcher {
 	b := &InMemoryDispatcher{
-		handlers: make(map[string]CommandHandler),
+		handlers:           make(map[string]CommandHandler),
+		commandMiddlewares: make(map[string][]CommandMiddleware),
 	}
 	return b
 }
 
+//Use registers middlewares that wrap the handlers of all commands.
+//
+//Middlewares run in registration order, global middlewares run before the
+//middlewares registered for a command type with UseFor.
+func (b *InMemoryDispatcher) Use(middlewares ...CommandMiddleware) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+//UseFor registers middlewares that wrap the handler of the command type only.
+func (b *InMemoryDispatcher) UseFor(command interface{}, middlewares ...CommandMiddleware) {
+	b.Lock()
+	defer b.Unlock()
+
+	typeName := TypeOf(command)
+	b.commandMiddlewares[typeName] = append(b.commandMiddlewares[typeName], middlewares...)
+}
+
+//handlerOf returns the handler of the command wrapped in its middlewares.
+func (b *InMemoryDispatcher) handlerOf(commandName string) (CommandHandler, bool) {
+	b.RLock()
+	defer b.RUnlock()
+
+	handler, ok := b.handlers[commandName]
+	if !ok {
+		return nil, false
+	}
+
+	handler = ChainCommandMiddleware(handler, b.commandMiddlewares[commandName]...)
+	return ChainCommandMiddleware(handler, b.middlewares...), true
+}
+
 //Dispatch passes the CommandMessage on to all registered command handlers.
+//
+//The command is stamped with a command id, correlation id, causation id, actor
+//and timestamp before it is handled, see HeaderCorrelationId. The handler gets a
+//context carrying them, so the events it saves and the commands it dispatches
+//are correlated with the command.
+//
+//The handler is called without holding the lock of the dispatcher, so a handler
+//may dispatch further commands or register handlers.
 func (b *InMemoryDispatcher) Dispatch(ctx context.Context, command CommandMessage) (any, error) {
-	if handler, ok := b.handlers[command.CommandName()]; ok {
-		return handler.Handle(ctx, command)
+	if handler, ok := b.handlerOf(command.CommandName()); ok {
+		return handler.Handle(stampCommand(ctx, command), command)
 	}
 	return nil, fmt.Errorf("The command bus does not have a handler for commands of type: %s", command.CommandName())
 }
@@ -52,6 +103,9 @@ func (b *InMemoryDispatcher) Dispatch(ctx context.Context, command CommandMessag
 //RegisterHandler registers a command handler for the command types specified by the
 //variadic commands parameter.
 func (b *InMemoryDispatcher) RegisterHandler(handler CommandHandler, commands ...interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
 	for _, command := range commands {
 		typeName := TypeOf(command)
 		if _, ok := b.handlers[typeName]; ok {
@@ -61,3 +115,24 @@ func (b *InMemoryDispatcher) RegisterHandler(handler CommandHandler, commands ..
 	}
 	return nil
 }
+
+//UnregisterHandler removes the command handlers of the command types specified by
+//the variadic commands parameter.
+//
+//If a command type has no handler an error is returned and no handler is removed.
+func (b *InMemoryDispatcher) UnregisterHandler(commands ...interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, command := range commands {
+		typeName := TypeOf(command)
+		if _, ok := b.handlers[typeName]; !ok {
+			return fmt.Errorf("The command bus does not have a handler for commands of type: %s", typeName)
+		}
+	}
+
+	for _, command := range commands {
+		delete(b.handlers, TypeOf(command))
+	}
+	return nil
+}
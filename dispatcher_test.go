@@ -8,6 +8,7 @@ package ycq
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	. "gopkg.in/check.v1"
 )
@@ -61,3 +62,87 @@ func (s *InternalCommandBusSuite) TestCanRegisterMultipleCommandsForTheSameHandl
 	c.Assert(err, IsNil)
 
 }
+
+func (s *InternalCommandBusSuite) TestMiddlewaresWrapHandlerInOrder(c *C) {
+	var calls []string
+	record := func(name string) CommandMiddleware {
+		return func(next CommandHandler) CommandHandler {
+			return CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+				calls = append(calls, name)
+				return next.Handle(ctx, command)
+			})
+		}
+	}
+
+	err := s.bus.RegisterHandler(s.stubhandler, &SomeCommand{}, &SomeOtherCommand{})
+	c.Assert(err, IsNil)
+	s.bus.UseFor(&SomeCommand{}, record("some"))
+	s.bus.Use(record("first"), record("second"))
+
+	_, err = s.bus.Dispatch(context.TODO(), NewSomeCommandMessage(NewUUID()))
+	c.Assert(err, IsNil)
+	c.Assert(calls, DeepEquals, []string{"first", "second", "some"})
+
+	calls = nil
+	_, err = s.bus.Dispatch(context.TODO(), NewSomeOtherCommandMessage(NewUUID()))
+	c.Assert(err, IsNil)
+	c.Assert(calls, DeepEquals, []string{"first", "second"})
+}
+
+func (s *InternalCommandBusSuite) TestUnregisterHandler(c *C) {
+	err := s.bus.RegisterHandler(s.stubhandler, &SomeCommand{}, &SomeOtherCommand{})
+	c.Assert(err, IsNil)
+
+	err = s.bus.UnregisterHandler(&SomeCommand{})
+	c.Assert(err, IsNil)
+
+	_, err = s.bus.Dispatch(context.TODO(), NewSomeCommandMessage(NewUUID()))
+	c.Assert(err, NotNil)
+	_, err = s.bus.Dispatch(context.TODO(), NewSomeOtherCommandMessage(NewUUID()))
+	c.Assert(err, IsNil)
+
+	// The handler can be registered again once unregistered.
+	err = s.bus.RegisterHandler(s.stubhandler, &SomeCommand{})
+	c.Assert(err, IsNil)
+}
+
+func (s *InternalCommandBusSuite) TestUnregisterUnknownHandlerRemovesNothing(c *C) {
+	err := s.bus.RegisterHandler(s.stubhandler, &SomeCommand{})
+	c.Assert(err, IsNil)
+
+	err = s.bus.UnregisterHandler(&SomeCommand{}, &SomeOtherCommand{})
+	c.Assert(err, DeepEquals, fmt.Errorf("The command bus does not have a handler for commands of type: %s", TypeOf(&SomeOtherCommand{})))
+
+	_, err = s.bus.Dispatch(context.TODO(), NewSomeCommandMessage(NewUUID()))
+	c.Assert(err, IsNil)
+}
+
+// Run with -race to detect unsynchronised access.
+func (s *InternalCommandBusSuite) TestConcurrentRegistrationAndDispatch(c *C) {
+	err := s.bus.RegisterHandler(CommandHandlerFunc(func(ctx context.Context, command CommandMessage) (any, error) {
+		return nil, nil
+	}), &SomeCommand{})
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if s.bus.RegisterHandler(s.stubhandler, &SomeOtherCommand{}) == nil {
+					s.bus.UnregisterHandler(&SomeOtherCommand{})
+				}
+				s.bus.UseFor(&SomeOtherCommand{}, RecoveryMiddleware())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := s.bus.Dispatch(context.TODO(), NewSomeCommandMessage(NewUUID()))
+				c.Check(err, IsNil)
+			}
+		}()
+	}
+	wg.Wait()
+}
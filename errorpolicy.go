@@ -0,0 +1,139 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// HandlerFailure describes an event an ErrorAwareEventHandler failed to handle.
+type HandlerFailure struct {
+	// Handler is the handler that failed.
+	Handler ErrorAwareEventHandler
+
+	// HandlerName is the name of the type of the handler.
+	HandlerName string
+
+	Event EventMessage
+
+	// Err is the error returned by the last attempt.
+	Err error
+
+	// Attempts is the number of times the handler was called with the event.
+	Attempts int
+}
+
+// ErrorPolicy decides what happens when an event handler fails.
+//
+// The returned error is reported to the publisher of the event, a policy
+// returning nil lets the publish continue as if the handler succeeded.
+type ErrorPolicy func(ctx context.Context, failure *HandlerFailure) error
+
+// EventParker is implemented by stores that park events a handler failed to
+// handle, e.g. a dead-letter store.
+type EventParker interface {
+	ParkEvent(ctx context.Context, failure *HandlerFailure) error
+}
+
+// FailPublish returns an ErrorPolicy that reports the error to the publisher.
+// It is the policy of error aware handlers registered without a policy.
+func FailPublish() ErrorPolicy {
+	return func(ctx context.Context, failure *HandlerFailure) error {
+		return failure.Err
+	}
+}
+
+// LogAndContinue returns an ErrorPolicy that logs the error and continues.
+func LogAndContinue(logger Logger) ErrorPolicy {
+	return func(ctx context.Context, failure *HandlerFailure) error {
+		logger.Printf("handler %s failed to handle event %s after %d attempts: %s",
+			failure.HandlerName, failure.Event.Event().Name(), failure.Attempts, failure.Err)
+		return nil
+	}
+}
+
+// Retry returns an ErrorPolicy that calls the handler again up to retries
+// times, waiting backoff between attempts. When the handler keeps failing the
+// failure is passed on to then.
+func Retry(retries int, backoff time.Duration, then ErrorPolicy) ErrorPolicy {
+	return func(ctx context.Context, failure *HandlerFailure) error {
+		for i := 0; i < retries; i++ {
+			select {
+			case <-ctx.Done():
+				return failure.Err
+			case <-time.After(backoff):
+			}
+
+			failure.Attempts++
+			if failure.Err = failure.Handler.HandleEvent(ctx, failure.Event); failure.Err == nil {
+				return nil
+			}
+		}
+
+		return then(ctx, failure)
+	}
+}
+
+// DeadLetter returns an ErrorPolicy that parks the event and continues. The
+// publish only fails when the event could not be parked.
+func DeadLetter(parker EventParker) ErrorPolicy {
+	return func(ctx context.Context, failure *HandlerFailure) error {
+		if err := parker.ParkEvent(ctx, failure); err != nil {
+			return fmt.Errorf("parking event failed: %s, handler failed: %w", err, failure.Err)
+		}
+
+		return nil
+	}
+}
+
+type policyEventHandler struct {
+	handler EventHandler
+	policy  ErrorPolicy
+}
+
+// WithErrorPolicy returns an ErrorAwareEventHandler that applies the policy to
+// the errors of the handler.
+//
+// The returned handler is what must be passed to RemoveHandler.
+func WithErrorPolicy(handler EventHandler, policy ErrorPolicy) ErrorAwareEventHandler {
+	return &policyEventHandler{
+		handler: handler,
+		policy:  policy,
+	}
+}
+
+func (h *policyEventHandler) Handle(ctx context.Context, event EventMessage) {
+	_ = h.HandleEvent(ctx, event)
+}
+
+func (h *policyEventHandler) HandleEvent(ctx context.Context, event EventMessage) error {
+	handler, ok := h.handler.(ErrorAwareEventHandler)
+	if !ok {
+		h.handler.Handle(ctx, event)
+		return nil
+	}
+
+	err := handler.HandleEvent(ctx, event)
+	if err == nil {
+		return nil
+	}
+
+	return h.policy(ctx, &HandlerFailure{
+		Handler:     handler,
+		HandlerName: handlerName(handler),
+		Event:       event,
+		Err:         err,
+		Attempts:    1,
+	})
+}
+
+// handlerName returns the name of the type of a handler.
+func handlerName(handler interface{}) string {
+	t := reflect.TypeOf(handler)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
@@ -0,0 +1,170 @@
+package ycq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ErrorPolicySuite{})
+
+type ErrorPolicySuite struct {
+	bus *InternalEventBus
+}
+
+func (s *ErrorPolicySuite) SetUpTest(c *C) {
+	s.bus = NewInternalEventBus()
+}
+
+// failingEventHandler fails the first failures calls.
+type failingEventHandler struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (h *failingEventHandler) Handle(ctx context.Context, event EventMessage) {
+	_ = h.HandleEvent(ctx, event)
+}
+
+func (h *failingEventHandler) HandleEvent(ctx context.Context, event EventMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls++
+	if h.calls <= h.failures {
+		return fmt.Errorf("attempt %d failed", h.calls)
+	}
+
+	return nil
+}
+
+type recordingEventParker struct {
+	failures []HandlerFailure
+	err      error
+}
+
+func (p *recordingEventParker) ParkEvent(ctx context.Context, failure *HandlerFailure) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.failures = append(p.failures, *failure)
+	return nil
+}
+
+func (s *ErrorPolicySuite) TestErrorAwareHandlerFailsPublish(c *C) {
+	h := &failingEventHandler{failures: 1}
+	plain := &recordingEventHandler{}
+	s.bus.AddHandler(h, "SomeEvent")
+	s.bus.AddHandler(plain, "SomeEvent")
+
+	ev := NewTestEventMessage(NewUUID())
+	err := s.bus.PublishEvent(context.Background(), ev)
+	c.Assert(err, DeepEquals, &ErrPublishFailed{Event: ev, Errors: []error{fmt.Errorf("attempt 1 failed")}})
+
+	// The other handlers are still called.
+	c.Assert(plain.handled(), HasLen, 1)
+}
+
+func (s *ErrorPolicySuite) TestLogAndContinue(c *C) {
+	var buf bytes.Buffer
+	h := &failingEventHandler{failures: 1}
+	s.bus.AddHandler(WithErrorPolicy(h, LogAndContinue(log.New(&buf, "", 0))), "SomeEvent")
+
+	err := s.bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID()))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "handler failingEventHandler failed to handle event SomeEvent after 1 attempts: attempt 1 failed\n")
+}
+
+func (s *ErrorPolicySuite) TestRetrySucceeds(c *C) {
+	h := &failingEventHandler{failures: 2}
+	s.bus.AddHandler(WithErrorPolicy(h, Retry(2, time.Millisecond, FailPublish())), "SomeEvent")
+
+	err := s.bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID()))
+	c.Assert(err, IsNil)
+	c.Assert(h.calls, Equals, 3)
+}
+
+func (s *ErrorPolicySuite) TestRetryThenDeadLetter(c *C) {
+	h := &failingEventHandler{failures: 5}
+	parker := &recordingEventParker{}
+	s.bus.AddHandler(WithErrorPolicy(h, Retry(2, time.Millisecond, DeadLetter(parker))), "SomeEvent")
+
+	ev := NewTestEventMessage(NewUUID())
+	err := s.bus.PublishEvent(context.Background(), ev)
+	c.Assert(err, IsNil)
+	c.Assert(h.calls, Equals, 3)
+	c.Assert(parker.failures, HasLen, 1)
+	c.Assert(parker.failures[0].Event, Equals, ev)
+	c.Assert(parker.failures[0].Attempts, Equals, 3)
+	c.Assert(parker.failures[0].HandlerName, Equals, "failingEventHandler")
+	c.Assert(parker.failures[0].Err, ErrorMatches, "attempt 3 failed")
+}
+
+func (s *ErrorPolicySuite) TestDeadLetterFailsPublishWhenParkingFails(c *C) {
+	h := &failingEventHandler{failures: 1}
+	parker := &recordingEventParker{err: fmt.Errorf("store down")}
+	s.bus.AddHandler(WithErrorPolicy(h, DeadLetter(parker)), "SomeEvent")
+
+	err := s.bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID()))
+	c.Assert(err, FitsTypeOf, &ErrPublishFailed{})
+	c.Assert(strings.Contains(err.Error(), "store down"), Equals, true)
+}
+
+func (s *ErrorPolicySuite) TestRemovePolicyHandler(c *C) {
+	h := WithErrorPolicy(&failingEventHandler{failures: 1}, FailPublish())
+	s.bus.AddHandler(h, "SomeEvent")
+	s.bus.RemoveHandler(h)
+
+	c.Assert(s.bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID())), IsNil)
+}
+
+func (s *ErrorPolicySuite) TestAsyncEventBusCollectsErrors(c *C) {
+	var mu sync.Mutex
+	var errs []error
+	bus := NewAsyncEventBus(AsyncEventBusOptions{OnError: func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}})
+	bus.AddHandler(&failingEventHandler{failures: 1}, "SomeEvent")
+
+	c.Assert(bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID())), IsNil)
+	c.Assert(bus.PublishEvent(context.Background(), NewTestEventMessage(NewUUID())), IsNil)
+	c.Assert(bus.Shutdown(context.Background()), IsNil)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], FitsTypeOf, &ErrPublishFailed{})
+	c.Assert(bus.Metrics().Failed, Equals, uint64(1))
+	c.Assert(bus.Metrics().Delivered, Equals, uint64(1))
+}
+
+func (s *ErrorPolicySuite) TestSaveReturnsPublishErrorAfterPersisting(c *C) {
+	h := &failingEventHandler{failures: 1}
+	s.bus.AddHandler(h, "SomeEvent")
+
+	eventRepo := NewInMemoryEventRepository()
+	repo, err := NewSqlDomainRepository(eventRepo, s.bus)
+	c.Assert(err, IsNil)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+	agg.TrackChange(NewTestEventMessage(id))
+
+	err = repo.Save(context.Background(), id, agg, Int(0))
+	c.Assert(err, FitsTypeOf, &ErrPublishFailed{})
+	c.Assert(h.calls, Equals, 2)
+	c.Assert(agg.OriginalVersion(), Equals, 2)
+
+	count, err := eventRepo.Read(context.Background()).Stream(id).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 2)
+}
@@ -1,6 +1,10 @@
 package ycq
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // ErrCommandExecution is the error returned in response to a failed command.
 type ErrCommandExecution struct {
@@ -16,14 +20,37 @@ func (e *ErrCommandExecution) Error() string {
 // ErrConcurrencyViolation is returned when a concurrency error is raised by the event store
 // when events are persisted to a stream and the version of the stream does not match
 // the expected version.
+//
+// Aggregate is only known when the error is raised through a DomainRepository and
+// ActualVersion is nil when the event store could not tell the current version of the
+// stream, e.g. when it could not be read again after a concurrent writer won the race
+// for the same stream version.
 type ErrConcurrencyViolation struct {
 	Aggregate       AggregateRoot
 	ExpectedVersion *int
+	ActualVersion   *int
 	StreamName      string
 }
 
 func (e *ErrConcurrencyViolation) Error() string {
-	return fmt.Sprintf("ConcurrencyError: AggregateID: %s ExpectedVersion: %d StreamName: %s", e.Aggregate.AggregateID(), *e.ExpectedVersion, e.StreamName)
+	aggregateID := ""
+	if e.Aggregate != nil {
+		aggregateID = e.Aggregate.AggregateID()
+	}
+
+	return fmt.Sprintf("ConcurrencyError: AggregateID: %s ExpectedVersion: %s ActualVersion: %s StreamName: %s",
+		aggregateID,
+		formatVersion(e.ExpectedVersion),
+		formatVersion(e.ActualVersion),
+		e.StreamName)
+}
+
+func formatVersion(version *int) string {
+	if version == nil {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%d", *version)
 }
 
 // ErrUnauthorized is returned when a request to the repository is not authorized
@@ -84,3 +111,107 @@ func (e *ErrEventNotFound) Error() string {
 	return fmt.Sprintf("Could not find any event of name %s",
 		e.EventName)
 }
+
+// ErrSnapshotFailed is reported to the OnSnapshotError handler of a repository
+// when the events of an aggregate were saved but the snapshot of the aggregate
+// could not be taken.
+//
+// The aggregate is persisted, the command that produced the events should not be retried.
+type ErrSnapshotFailed struct {
+	StreamName string
+	Err        error
+}
+
+func (e *ErrSnapshotFailed) Error() string {
+	return fmt.Sprintf("Snapshot of stream %s failed. %s", e.StreamName, e.Err)
+}
+
+// ErrUpcastFailed is returned when an upcaster fails to transform the payload of
+// an event.
+type ErrUpcastFailed struct {
+	EventName     string
+	SchemaVersion int
+	Err           error
+}
+
+func (e *ErrUpcastFailed) Error() string {
+	return fmt.Sprintf("Upcasting event %s from version %d failed. %s", e.EventName, e.SchemaVersion, e.Err)
+}
+
+// ErrCommandPanicked is returned by RecoveryMiddleware when a command handler panics.
+type ErrCommandPanicked struct {
+	Command CommandMessage
+	Value   interface{}
+	Stack   string
+}
+
+func (e *ErrCommandPanicked) Error() string {
+	return fmt.Sprintf("Command handler panicked. Command: %s Panic: %v", e.Command.CommandName(), e.Value)
+}
+
+// ErrPublishFailed is returned by an EventBus when event handlers failed to
+// handle an event.
+//
+// When returned by the Save method of a DomainRepository the events were
+// persisted, the command that produced them should not be retried.
+type ErrPublishFailed struct {
+	Event  EventMessage
+	Errors []error
+}
+
+func (e *ErrPublishFailed) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		reasons[i] = err.Error()
+	}
+
+	return fmt.Sprintf("Publishing event %s failed. %s", e.Event.Event().Name(), strings.Join(reasons, "; "))
+}
+
+// isCommittedError reports whether the error was returned after the events of
+// a command were persisted, the command must not be handled again.
+func isCommittedError(err error) bool {
+	var publishErr *ErrPublishFailed
+	var snapshotErr *ErrSnapshotFailed
+	return errors.As(err, &publishErr) || errors.As(err, &snapshotErr)
+}
+
+// ErrDeadLetterNotFound is returned when a dead letter does not exist.
+type ErrDeadLetterNotFound struct {
+	ID int64
+}
+
+func (e *ErrDeadLetterNotFound) Error() string {
+	return fmt.Sprintf("Dead letter not found. ID: %d", e.ID)
+}
+
+// ErrScheduledCommandNotFound is returned when a scheduled command does not
+// exist, e.g. because it was dispatched or cancelled already.
+type ErrScheduledCommandNotFound struct {
+	ID string
+}
+
+func (e *ErrScheduledCommandNotFound) Error() string {
+	return fmt.Sprintf("Scheduled command not found. ID: %s", e.ID)
+}
+
+// ErrUnhandledEvent is returned when an event is applied to an aggregate that
+// has no handler registered for it with On.
+type ErrUnhandledEvent struct {
+	AggregateID string
+	EventName   string
+}
+
+func (e *ErrUnhandledEvent) Error() string {
+	return fmt.Sprintf("Aggregate %s has no handler for event %s", e.AggregateID, e.EventName)
+}
+
+// ErrCommandInFlight is returned by DeduplicationMiddleware when a command
+// with the same id is being handled by another process.
+type ErrCommandInFlight struct {
+	CommandID string
+}
+
+func (e *ErrCommandInFlight) Error() string {
+	return fmt.Sprintf("Command is being handled. ID: %s", e.CommandID)
+}
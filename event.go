@@ -12,6 +12,25 @@ type Event interface {
 	Marshal() (string, error)
 }
 
+// SchemaVersioner is implemented by events whose payload has more than one
+// schema version.
+//
+// The schema version is persisted with the event, events read back with an
+// older version are brought to the current shape by an UpcasterRegistry.
+// Events that do not implement SchemaVersioner are at version 1.
+type SchemaVersioner interface {
+	SchemaVersion() int
+}
+
+// EventSchemaVersion returns the schema version of the event.
+func EventSchemaVersion(event Event) int {
+	if v, ok := event.(SchemaVersioner); ok && v.SchemaVersion() > 0 {
+		return v.SchemaVersion()
+	}
+
+	return 1
+}
+
 // EventMessage is the interface that a command must implement.
 type EventMessage interface {
 	setID(ID *string)
@@ -37,27 +56,61 @@ type EventMessage interface {
 
 var _ Event = new(RawEvent)
 
+// RawEvent is an event whose payload has not been decoded, it is what an
+// EventRepository returns when reading events.
+//
+// The data of a raw event is the serialised payload, marshalling a raw event
+// returns it unchanged so raw events can be appended to another stream as is.
 type RawEvent struct {
-	name string
-	data interface{}
+	name          string
+	data          interface{}
+	schemaVersion int
+}
+
+// NewRawEvent returns a RawEvent with the given name and serialised payload.
+func NewRawEvent(name string, data string) *RawEvent {
+	return &RawEvent{
+		name: name,
+		data: data,
+	}
 }
 
 func (r *RawEvent) Name() string {
 	return r.name
 }
 
+// Unmarshal replaces the data of the event with rawString.
 func (r *RawEvent) Unmarshal(rawString string) error {
-	panic("implement me")
+	r.data = rawString
+	return nil
 }
 
+// Marshal returns the serialised payload. Data that is not a string is
+// encoded as JSON.
 func (r *RawEvent) Marshal() (string, error) {
-	panic("implement me")
+	switch d := r.data.(type) {
+	case string:
+		return d, nil
+	case nil:
+		return "", nil
+	}
+
+	return JSONCodec.Marshal(r.data)
 }
 
 func (r *RawEvent) Data() interface{} {
 	return r.data
 }
 
+// SchemaVersion returns the schema version the event was persisted with.
+func (r *RawEvent) SchemaVersion() int {
+	if r.schemaVersion <= 0 {
+		return 1
+	}
+
+	return r.schemaVersion
+}
+
 // EventDescriptor is an implementation of the event message interface.
 type EventDescriptor struct {
 	id      *string
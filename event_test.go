@@ -146,3 +146,23 @@ func (s *EventSuite) TestAddHeaderStruct(c *C) {
 
 	c.Assert(em.headers["a"], DeepEquals, ev)
 }
+
+func (s *EventSuite) TestRawEventMarshalRoundTrip(c *C) {
+	ev := NewRawEvent("SomeEvent", `{"item":"a","count":1}`)
+
+	data, err := ev.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, `{"item":"a","count":1}`)
+
+	err = ev.Unmarshal(`{"item":"b"}`)
+	c.Assert(err, IsNil)
+	c.Assert(ev.Data(), Equals, `{"item":"b"}`)
+}
+
+func (s *EventSuite) TestRawEventMarshalsNonStringDataAsJson(c *C) {
+	ev := &RawEvent{name: "SomeEvent", data: map[string]int{"count": 1}}
+
+	data, err := ev.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, `{"count":1}`)
+}
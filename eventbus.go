@@ -5,16 +5,28 @@
 
 package ycq
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 // EventBus is the inteface that an event bus must implement.
+//
+// PublishEvent passes ctx on to the handlers, so the values, deadline and
+// cancellation of the publisher reach them. It returns an ErrPublishFailed when
+// error aware handlers failed to handle the event, see ErrorAwareEventHandler.
 type EventBus interface {
-	PublishEvent(EventMessage)
+	PublishEvent(context.Context, EventMessage) error
 	AddHandler(EventHandler, ...string)
+	RemoveHandler(EventHandler, ...string)
 }
 
 // InternalEventBus provides a lightweight in process event bus
+//
+// It is safe for concurrent use, handlers can be added and removed while events
+// are published.
 type InternalEventBus struct {
+	sync.RWMutex
 	eventHandlers map[string]map[EventHandler]struct{}
 }
 
@@ -27,29 +39,72 @@ func NewInternalEventBus() *InternalEventBus {
 }
 
 // PublishEvent publishes events to all registered event handlers
-func (b *InternalEventBus) PublishEvent(event EventMessage) {
-	// Use context for concurrency safe
-	ctx := context.TODO()
-	if handlers, ok := b.eventHandlers[event.Event().Name()]; ok {
-		for handler := range handlers {
-			handler.Handle(ctx, event)
-		}
-	}
+//
+// The handlers are called without holding the lock of the bus, so a handler
+// may add or remove handlers. All handlers are called even when one fails, the
+// errors of the error aware handlers are returned in an ErrPublishFailed.
+func (b *InternalEventBus) PublishEvent(ctx context.Context, event EventMessage) error {
+	return deliverEvent(ctx, handlersOf(&b.RWMutex, b.eventHandlers, event.Event().Name()), event)
 }
 
 // AddHandler registers an event handler for all of the events specified in the
 // variadic events parameter.
 func (b *InternalEventBus) AddHandler(handler EventHandler, events ...string) {
+	b.Lock()
+	defer b.Unlock()
+
+	addHandler(b.eventHandlers, handler, events...)
+}
+
+// RemoveHandler unregisters an event handler from the events specified in the
+// variadic events parameter, or from all events when none are specified.
+func (b *InternalEventBus) RemoveHandler(handler EventHandler, events ...string) {
+	b.Lock()
+	defer b.Unlock()
+
+	removeHandler(b.eventHandlers, handler, events...)
+}
+
+// handlersOf returns a copy of the handlers registered for the event.
+func handlersOf(mu *sync.RWMutex, eventHandlers map[string]map[EventHandler]struct{}, eventName string) []EventHandler {
+	mu.RLock()
+	defer mu.RUnlock()
 
+	handlers := make([]EventHandler, 0, len(eventHandlers[eventName]))
+	for handler := range eventHandlers[eventName] {
+		handlers = append(handlers, handler)
+	}
+
+	return handlers
+}
+
+// addHandler adds the handler to eventHandlers, callers must hold the lock.
+func addHandler(eventHandlers map[string]map[EventHandler]struct{}, handler EventHandler, events ...string) {
 	for _, eventName := range events {
 		// There can be multiple handlers for any event.
 		// Here we check that a map is initialized to hold these handlers
 		// for a given type. If not we create one.
-		if _, ok := b.eventHandlers[eventName]; !ok {
-			b.eventHandlers[eventName] = make(map[EventHandler]struct{})
+		if _, ok := eventHandlers[eventName]; !ok {
+			eventHandlers[eventName] = make(map[EventHandler]struct{})
 		}
 
 		// Add this handler to the collection of handlers for the type.
-		b.eventHandlers[eventName][handler] = struct{}{}
+		eventHandlers[eventName][handler] = struct{}{}
+	}
+}
+
+// removeHandler removes the handler from eventHandlers, callers must hold the lock.
+func removeHandler(eventHandlers map[string]map[EventHandler]struct{}, handler EventHandler, events ...string) {
+	if len(events) == 0 {
+		for eventName := range eventHandlers {
+			events = append(events, eventName)
+		}
+	}
+
+	for _, eventName := range events {
+		delete(eventHandlers[eventName], handler)
+		if len(eventHandlers[eventName]) == 0 {
+			delete(eventHandlers, eventName)
+		}
 	}
 }
@@ -6,6 +6,9 @@
 package ycq
 
 import (
+	"context"
+	"sync"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -29,11 +32,22 @@ func (s *InternalEventBusSuite) TestEventBusPublishesEventsToHandlers(c *C) {
 	ev := NewTestEventMessage(NewUUID())
 	s.bus.AddHandler(h, "SomeEvent")
 
-	s.bus.PublishEvent(ev)
+	s.bus.PublishEvent(context.Background(), ev)
 
 	c.Assert(h.events[0], Equals, ev)
 }
 
+func (s *InternalEventBusSuite) TestEventBusPassesContextToHandlers(c *C) {
+	h := &recordingEventHandler{}
+	s.bus.AddHandler(h, "SomeEvent")
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "trace")
+	c.Assert(s.bus.PublishEvent(ctx, NewTestEventMessage(NewUUID())), IsNil)
+
+	c.Assert(h.handledContexts(), HasLen, 1)
+	c.Assert(h.handledContexts()[0].Value(testContextKey{}), Equals, "trace")
+}
+
 func (s *InternalEventBusSuite) TestRegisterMultipleEventsForHandler(c *C) {
 	h := NewMockEventHandler()
 	ev1 := NewEventMessage(nil, &SomeEvent{Item: "Some Item", Count: 3456}, nil)
@@ -41,20 +55,100 @@ func (s *InternalEventBusSuite) TestRegisterMultipleEventsForHandler(c *C) {
 
 	s.bus.AddHandler(h, "SomeEvent", "SomeOtherEvent")
 
-	s.bus.PublishEvent(ev1)
-	s.bus.PublishEvent(ev2)
+	s.bus.PublishEvent(context.Background(), ev1)
+	s.bus.PublishEvent(context.Background(), ev2)
 
 	c.Assert(h.events[0], Equals, ev1)
 	c.Assert(h.events[1], Equals, ev2)
 }
 
+func (s *InternalEventBusSuite) TestRemoveHandlerFromEvent(c *C) {
+	h := &recordingEventHandler{}
+	s.bus.AddHandler(h, "SomeEvent", "SomeOtherEvent")
+
+	s.bus.RemoveHandler(h, "SomeEvent")
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeOtherEvent{}, nil))
+
+	c.Assert(h.handled(), HasLen, 1)
+	c.Assert(h.handled()[0].Event().Name(), Equals, "SomeOtherEvent")
+}
+
+func (s *InternalEventBusSuite) TestRemoveHandlerFromAllEvents(c *C) {
+	h := &recordingEventHandler{}
+	other := &recordingEventHandler{}
+	s.bus.AddHandler(h, "SomeEvent", "SomeOtherEvent")
+	s.bus.AddHandler(other, "SomeEvent")
+
+	s.bus.RemoveHandler(h)
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeOtherEvent{}, nil))
+
+	c.Assert(h.handled(), HasLen, 0)
+	c.Assert(other.handled(), HasLen, 1)
+}
+
+func (s *InternalEventBusSuite) TestHandlerCanRemoveItself(c *C) {
+	h := &selfRemovingEventHandler{bus: s.bus}
+	s.bus.AddHandler(h, "SomeEvent")
+
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+	s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+
+	c.Assert(h.calls, Equals, 1)
+}
+
+// Run with -race to detect unsynchronised access.
+func (s *InternalEventBusSuite) TestConcurrentRegistrationAndPublishing(c *C) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h := &recordingEventHandler{}
+				s.bus.AddHandler(h, "SomeEvent")
+				s.bus.RemoveHandler(h, "SomeEvent")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *InternalEventBusSuite) TestAsyncEventBusRemoveHandler(c *C) {
+	bus := NewAsyncEventBus(AsyncEventBusOptions{})
+	h := &recordingEventHandler{}
+	bus.AddHandler(h, "SomeEvent")
+	bus.RemoveHandler(h, "SomeEvent")
+
+	bus.PublishEvent(context.Background(), NewEventMessage(nil, &SomeEvent{}, nil))
+	c.Assert(bus.Shutdown(context.Background()), IsNil)
+	c.Assert(h.handled(), HasLen, 0)
+}
+
 // Stubs
 
+type selfRemovingEventHandler struct {
+	bus   EventBus
+	calls int
+}
+
+func (h *selfRemovingEventHandler) Handle(ctx context.Context, event EventMessage) {
+	h.calls++
+	h.bus.RemoveHandler(h)
+}
+
 type MockEventBus struct {
 	events []EventMessage
 }
 
-func (m *MockEventBus) PublishEvent(event EventMessage) {
+func (m *MockEventBus) PublishEvent(ctx context.Context, event EventMessage) {
 	m.events = append(m.events, event)
 }
 
@@ -60,3 +60,42 @@ func (t *DelegateEventFactory) GetEvent(typeName string) Event {
 	}
 	return nil
 }
+
+// decodeEvent returns a copy of an event message read from an EventRepository
+// with its raw event replaced by the event type registered in the factory.
+//
+// When upcasters are given the raw event is upcast to its latest schema version
+// first.
+func decodeEvent(factory EventFactory, upcasters *UpcasterRegistry, em EventMessage) (EventMessage, error) {
+	raw := em.Event()
+	if r, ok := raw.(*RawEvent); ok && upcasters != nil {
+		upcasted, err := upcasters.Upcast(r)
+		if err != nil {
+			return nil, err
+		}
+		raw = upcasted
+	}
+
+	event := factory.GetEvent(raw.Name())
+	if event == nil {
+		return nil, &ErrEventNotFound{
+			EventName: raw.Name(),
+		}
+	}
+
+	data, err := raw.Marshal()
+	if err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	if err := event.Unmarshal(data); err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	decoded := NewEventMessage(em.EventID(), event, em.Version())
+	for k, v := range em.GetHeaders() {
+		decoded.SetHeader(k, v)
+	}
+
+	return decoded, nil
+}
@@ -10,3 +10,54 @@ import "context"
 type EventHandler interface {
 	Handle(context.Context, EventMessage)
 }
+
+// ErrorAwareEventHandler is an EventHandler that reports failures.
+//
+// Event buses call HandleEvent instead of Handle and return the errors to the
+// publisher, WithErrorPolicy changes what happens with the errors of a handler.
+type ErrorAwareEventHandler interface {
+	EventHandler
+	HandleEvent(context.Context, EventMessage) error
+}
+
+type errorAwareEventHandlerFunc struct {
+	fn func(context.Context, EventMessage) error
+}
+
+// NewErrorAwareEventHandler returns an ErrorAwareEventHandler that calls fn.
+func NewErrorAwareEventHandler(fn func(context.Context, EventMessage) error) ErrorAwareEventHandler {
+	return &errorAwareEventHandlerFunc{fn: fn}
+}
+
+func (h *errorAwareEventHandlerFunc) Handle(ctx context.Context, event EventMessage) {
+	_ = h.fn(ctx, event)
+}
+
+func (h *errorAwareEventHandlerFunc) HandleEvent(ctx context.Context, event EventMessage) error {
+	return h.fn(ctx, event)
+}
+
+// deliverEvent calls every handler with the event and collects the errors of
+// the error aware handlers.
+func deliverEvent(ctx context.Context, handlers []EventHandler, event EventMessage) error {
+	var errs []error
+	for _, handler := range handlers {
+		if h, ok := handler.(ErrorAwareEventHandler); ok {
+			if err := h.HandleEvent(ctx, event); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		handler.Handle(ctx, event)
+	}
+
+	if len(errs) > 0 {
+		return &ErrPublishFailed{
+			Event:  event,
+			Errors: errs,
+		}
+	}
+
+	return nil
+}
@@ -14,17 +14,20 @@ type EventRepository interface {
 	GetStreamIdOf(ctx context.Context, eventId string) (string, error)
 	GetVersionInStream(ctx context.Context, streamId, eventId string) (*int, error)
 	IsEventInStream(ctx context.Context, streamId, eventId string) (bool, error)
+	Subscribe(ctx context.Context, options SubscriptionOptions) (Subscription, error)
 }
 
 type EventRepositoryReader interface {
 	Stream(streamId string) EventRepositoryReader
 	FromTime(date time.Time) EventRepositoryReader
 	FromId(id int) EventRepositoryReader
+	FromVersion(version int) EventRepositoryReader
 	ToTime(date time.Time) EventRepositoryReader
 	ToId(id int) EventRepositoryReader
 	Forward() EventRepositoryReader
 	Backward() EventRepositoryReader
 	Limit(count int) EventRepositoryReader
+	Metadata(key string, value string) EventRepositoryReader
 	Event(id string) (EventMessage, error)
 	Events(ids []string) ([]EventMessage, error)
 	Count() (int, error)
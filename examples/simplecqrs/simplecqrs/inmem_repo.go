@@ -43,7 +43,7 @@ func (r *InMemoryRepo) Save(ctx context.Context, aggregate ycq.AggregateRoot, _
 	//TODO: Look at the expected version
 	for _, v := range aggregate.GetChanges() {
 		r.current[aggregate.AggregateID()] = append(r.current[aggregate.AggregateID()], v)
-		r.publisher.PublishEvent(v)
+		r.publisher.PublishEvent(ctx, v)
 	}
 
 	return nil
@@ -6,7 +6,10 @@ require (
 	github.com/alfarih31/nb-go-env v1.0.4
 	github.com/alfarih31/nb-go-logger v1.0.2
 	github.com/alfarih31/nb-go-parser v1.0.10
+	github.com/glebarez/go-sqlite v1.19.1
+	github.com/glebarez/sqlite v1.5.0
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/jackc/pgconn v1.13.0
 	github.com/jetbasrawi/go.geteventstore v1.0.0
 	github.com/jetbasrawi/go.geteventstore.testfeed v0.0.0-20160808110805-4e3be493c211
 	github.com/lib/pq v1.10.7
@@ -21,8 +24,8 @@ require (
 )
 
 require (
+	github.com/google/uuid v1.3.0 // indirect
 	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
-	github.com/jackc/pgconn v1.13.0 // indirect
 	github.com/jackc/pgio v1.0.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgproto3/v2 v2.3.1 // indirect
@@ -34,7 +37,9 @@ require (
 	github.com/joho/godotenv v1.4.0 // indirect
 	github.com/kr/pretty v0.2.1 // indirect
 	github.com/kr/text v0.1.0 // indirect
+	github.com/mattn/go-isatty v0.0.16 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20200410134404-eec4a21b6bb0 // indirect
 	golang.org/x/crypto v0.0.0-20221005025214-4161e89ecf1b // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
 	golang.org/x/sys v0.0.0-20221006211917-84dc82d7e875 // indirect
@@ -42,4 +47,8 @@ require (
 	golang.org/x/tools v0.1.12 // indirect
 	gorm.io/datatypes v1.0.7 // indirect
 	gorm.io/hints v1.1.0 // indirect
+	modernc.org/libc v1.19.0 // indirect
+	modernc.org/mathutil v1.5.0 // indirect
+	modernc.org/memory v1.4.0 // indirect
+	modernc.org/sqlite v1.19.1 // indirect
 )
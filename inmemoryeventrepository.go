@@ -0,0 +1,510 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type inMemoryStoredEvent struct {
+	eventId   string
+	eventName string
+	eventData string
+	metadata  eventMetadata
+	createdAt time.Time
+}
+
+type inMemoryStreamEntry struct {
+	id            int
+	streamId      string
+	streamVersion int
+	event         *inMemoryStoredEvent
+	createdAt     time.Time
+}
+
+// inMemoryEventRepository is an EventRepository that keeps the event store and
+// event streams in process memory.
+//
+// It mirrors the layout of the sql event repository: every event is stored
+// once and referenced by one or more stream entries, each carrying a global
+// sequence id and a version within its stream.
+type inMemoryEventRepository struct {
+	sync.RWMutex
+	events   map[string]*inMemoryStoredEvent
+	entries  []*inMemoryStreamEntry
+	lastId   int
+	notifier *appendNotifier
+}
+
+type inMemoryEventRepositoryReader struct {
+	repo        *inMemoryEventRepository
+	ctx         context.Context
+	streamId    *string
+	fromTime    *time.Time
+	toTime      *time.Time
+	fromId      *int
+	toId        *int
+	fromVersion *int
+	direction   readDirection
+	limit       *int
+	metadata    []metadataFilter
+}
+
+// NewInMemoryEventRepository constructs an EventRepository that holds all events
+// in memory.
+//
+// It is safe for concurrent use and is intended for tests and small embedded
+// deployments where durability is not required.
+func NewInMemoryEventRepository() EventRepository {
+	return &inMemoryEventRepository{
+		events:   make(map[string]*inMemoryStoredEvent),
+		entries:  []*inMemoryStreamEntry{},
+		notifier: newAppendNotifier(),
+	}
+}
+
+// lastVersion returns the highest version in the stream, callers must hold the lock.
+func (r *inMemoryEventRepository) lastVersion(streamId string) int {
+	lastVersion := 0
+	for _, e := range r.entries {
+		if e.streamId == streamId && e.streamVersion > lastVersion {
+			lastVersion = e.streamVersion
+		}
+	}
+
+	return lastVersion
+}
+
+// checkExpectedVersion validates the expected version of the stream, callers must hold the lock.
+func (r *inMemoryEventRepository) checkExpectedVersion(streamId string, expectedVersion *int) error {
+	if expectedVersion == nil {
+		return nil
+	}
+
+	if lastVersion := r.lastVersion(streamId); *expectedVersion != lastVersion {
+		return &ErrConcurrencyViolation{
+			ExpectedVersion: expectedVersion,
+			ActualVersion:   Int(lastVersion),
+			StreamName:      streamId,
+		}
+	}
+
+	return nil
+}
+
+// appendEntries appends the events to the stream, callers must hold the lock.
+func (r *inMemoryEventRepository) appendEntries(streamId string, events []*inMemoryStoredEvent) {
+	now := time.Now()
+	version := r.lastVersion(streamId)
+	for _, ev := range events {
+		r.lastId++
+		version++
+		r.entries = append(r.entries, &inMemoryStreamEntry{
+			id:            r.lastId,
+			streamId:      streamId,
+			streamVersion: version,
+			event:         ev,
+			createdAt:     now,
+		})
+	}
+
+	r.notifier.notify()
+}
+
+func (r *inMemoryEventRepository) Append(ctx context.Context, streamId string, events []EventMessage, expectedVersion *int) error {
+	if streamId == "" {
+		return &ErrRepositoryExecution{
+			Err: fmt.Errorf("streamId can't be empty"),
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	now := time.Now()
+	stored := make([]*inMemoryStoredEvent, len(events))
+	for i, ev := range events {
+		ds, err := ev.Event().Marshal()
+		if err != nil {
+			return err
+		}
+
+		stored[i] = &inMemoryStoredEvent{
+			eventId:   NewUUID(),
+			eventName: ev.Event().Name(),
+			eventData: ds,
+			metadata:  newEventMetadata(ev),
+			createdAt: now,
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if err := r.checkExpectedVersion(streamId, expectedVersion); err != nil {
+		return err
+	}
+
+	for i, ev := range stored {
+		r.events[ev.eventId] = ev
+		events[i].setID(&stored[i].eventId)
+	}
+	r.appendEntries(streamId, stored)
+
+	return nil
+}
+
+func (r *inMemoryEventRepository) Link(ctx context.Context, streamId string, eventIds []string, expectedVersion *int) error {
+	if streamId == "" {
+		return &ErrRepositoryExecution{
+			Err: fmt.Errorf("streamId can't be empty"),
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	stored := make([]*inMemoryStoredEvent, len(eventIds))
+	for i, id := range eventIds {
+		ev, ok := r.events[id]
+		if !ok {
+			return &ErrRepositoryExecution{
+				Err: fmt.Errorf("An event not exist"),
+			}
+		}
+		stored[i] = ev
+	}
+
+	if err := r.checkExpectedVersion(streamId, expectedVersion); err != nil {
+		return err
+	}
+
+	r.appendEntries(streamId, stored)
+
+	return nil
+}
+
+func (r *inMemoryEventRepository) DeleteStream(ctx context.Context, streamId string) error {
+	if streamId == "" {
+		return &ErrRepositoryExecution{
+			Err: fmt.Errorf("streamId can't be empty"),
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	entries := make([]*inMemoryStreamEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.streamId != streamId {
+			entries = append(entries, e)
+		}
+	}
+	r.entries = entries
+
+	return nil
+}
+
+func (r *inMemoryEventRepository) Read(ctx context.Context) EventRepositoryReader {
+	return &inMemoryEventRepositoryReader{
+		repo: r,
+		ctx:  ctx,
+	}
+}
+
+func (r *inMemoryEventRepository) HasEvent(ctx context.Context, id string) (bool, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	_, ok := r.events[id]
+	return ok, nil
+}
+
+func (r *inMemoryEventRepository) GetStreamIdOf(ctx context.Context, eventId string) (string, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, e := range r.entries {
+		if e.event.eventId == eventId {
+			return e.streamId, nil
+		}
+	}
+
+	return "", &ErrRepositoryExecution{
+		Err: fmt.Errorf("event %s is not in any stream", eventId),
+	}
+}
+
+func (r *inMemoryEventRepository) GetVersionInStream(ctx context.Context, streamId, eventId string) (*int, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	var version *int
+	for _, e := range r.entries {
+		if e.streamId == streamId && e.event.eventId == eventId {
+			if version == nil || e.streamVersion > *version {
+				version = Int(e.streamVersion)
+			}
+		}
+	}
+
+	if version == nil {
+		return nil, &ErrRepositoryExecution{
+			Err: fmt.Errorf("event %s is not in stream %s", eventId, streamId),
+		}
+	}
+
+	return version, nil
+}
+
+func (r *inMemoryEventRepository) IsEventInStream(ctx context.Context, streamId, eventId string) (bool, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, e := range r.entries {
+		if e.streamId == streamId && e.event.eventId == eventId {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *inMemoryEventRepository) Subscribe(ctx context.Context, options SubscriptionOptions) (Subscription, error) {
+	return newSubscription(ctx, r, r.notifier, options)
+}
+
+// defaultGapTimeout is zero, appends are serialised and visible at once so a
+// gap is always left by a deleted stream.
+func (r *inMemoryEventRepository) defaultGapTimeout() time.Duration {
+	return 0
+}
+
+func (s *inMemoryEventRepositoryReader) buildEvent(e *inMemoryStreamEntry) EventMessage {
+	eventId := e.event.eventId
+	em := NewEventMessage(&eventId, &RawEvent{
+		name:          e.event.eventName,
+		data:          e.event.eventData,
+		schemaVersion: e.event.metadata.SchemaVersion,
+	}, Int(e.streamVersion))
+	e.event.metadata.setHeaders(em)
+	em.SetHeader(HeaderPosition, e.id)
+	em.SetHeader(HeaderStreamId, e.streamId)
+
+	return em
+}
+
+func (s *inMemoryEventRepositoryReader) matches(e *inMemoryStreamEntry) bool {
+	if s.streamId != nil && e.streamId != *s.streamId {
+		return false
+	}
+
+	if s.fromTime != nil && e.createdAt.Before(*s.fromTime) {
+		return false
+	}
+
+	if s.toTime != nil && e.createdAt.After(*s.toTime) {
+		return false
+	}
+
+	if s.fromId != nil && e.id < *s.fromId {
+		return false
+	}
+
+	if s.toId != nil && e.id > *s.toId {
+		return false
+	}
+
+	if s.fromVersion != nil && e.streamVersion < *s.fromVersion {
+		return false
+	}
+
+	for _, f := range s.metadata {
+		if v, ok := e.event.metadata.Headers[f.key].(string); !ok || v != f.value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// query returns the stream entries selected by the reader in read order.
+func (s *inMemoryEventRepositoryReader) query(filter func(e *inMemoryStreamEntry) bool) ([]*inMemoryStreamEntry, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	s.repo.RLock()
+	defer s.repo.RUnlock()
+
+	entries := []*inMemoryStreamEntry{}
+	for _, e := range s.repo.entries {
+		if s.matches(e) && (filter == nil || filter(e)) {
+			entries = append(entries, e)
+		}
+	}
+
+	// Entries are kept in id order, only a backward read has to be resorted.
+	if s.direction == readDirectionBackward {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].id > entries[j].id
+		})
+	}
+
+	if s.limit != nil && *s.limit < len(entries) {
+		entries = entries[:*s.limit]
+	}
+
+	return entries, nil
+}
+
+func (s *inMemoryEventRepositoryReader) toMessages(entries []*inMemoryStreamEntry) []EventMessage {
+	ems := make([]EventMessage, len(entries))
+	for i, e := range entries {
+		ems[i] = s.buildEvent(e)
+	}
+
+	return ems
+}
+
+func (s *inMemoryEventRepositoryReader) Stream(streamId string) EventRepositoryReader {
+	s.streamId = &streamId
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) FromTime(date time.Time) EventRepositoryReader {
+	s.fromTime = &date
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) FromId(id int) EventRepositoryReader {
+	s.fromId = &id
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) FromVersion(version int) EventRepositoryReader {
+	s.fromVersion = &version
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) ToTime(date time.Time) EventRepositoryReader {
+	s.toTime = &date
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) ToId(id int) EventRepositoryReader {
+	s.toId = &id
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) Forward() EventRepositoryReader {
+	s.direction = readDirectionForward
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) Backward() EventRepositoryReader {
+	s.direction = readDirectionBackward
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) Limit(count int) EventRepositoryReader {
+	s.limit = &count
+	return s
+}
+
+// Metadata selects the events persisted with the header key set to the string value.
+func (s *inMemoryEventRepositoryReader) Metadata(key string, value string) EventRepositoryReader {
+	s.metadata = append(s.metadata, metadataFilter{key: key, value: value})
+	return s
+}
+
+func (s *inMemoryEventRepositoryReader) Event(id string) (EventMessage, error) {
+	entries, err := s.query(func(e *inMemoryStreamEntry) bool {
+		return e.event.eventId == id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, &ErrRepositoryExecution{
+			Err: fmt.Errorf("event %s not found", id),
+		}
+	}
+
+	return s.buildEvent(entries[0]), nil
+}
+
+func (s *inMemoryEventRepositoryReader) Events(ids []string) ([]EventMessage, error) {
+	idSet := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		idSet[id] = struct{}{}
+	}
+
+	entries, err := s.query(func(e *inMemoryStreamEntry) bool {
+		_, ok := idSet[e.event.eventId]
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toMessages(entries), nil
+}
+
+func (s *inMemoryEventRepositoryReader) Count() (int, error) {
+	entries, err := s.query(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+func (s *inMemoryEventRepositoryReader) ToList() ([]EventMessage, error) {
+	entries, err := s.query(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toMessages(entries), nil
+}
+
+func (s *inMemoryEventRepositoryReader) Last(streamId string) (EventMessage, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	s.repo.RLock()
+	defer s.repo.RUnlock()
+
+	var last *inMemoryStreamEntry
+	for _, e := range s.repo.entries {
+		if e.streamId == streamId && (last == nil || e.streamVersion > last.streamVersion) {
+			last = e
+		}
+	}
+
+	if last == nil {
+		return nil, &ErrRepositoryExecution{
+			Err: fmt.Errorf("stream %s has no events", streamId),
+		}
+	}
+
+	return s.buildEvent(last), nil
+}
@@ -0,0 +1,235 @@
+package ycq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&InMemoryEventRepositorySuite{})
+
+type InMemoryEventRepositorySuite struct {
+	repo EventRepository
+	ctx  context.Context
+}
+
+func (s *InMemoryEventRepositorySuite) SetUpTest(c *C) {
+	s.repo = NewInMemoryEventRepository()
+	s.ctx = context.Background()
+}
+
+func (s *InMemoryEventRepositorySuite) appendEvents(c *C, streamId string, n int) []EventMessage {
+	evs := make([]EventMessage, n)
+	for i := range evs {
+		evs[i] = NewTestEventMessage(NewUUID())
+	}
+
+	err := s.repo.Append(s.ctx, streamId, evs, nil)
+	c.Assert(err, IsNil)
+
+	return evs
+}
+
+func (s *InMemoryEventRepositorySuite) TestAppendAndReadStream(c *C) {
+	evs := []EventMessage{
+		NewEventMessage(nil, &SomeEvent{Item: "a", Count: 1}, nil),
+		NewEventMessage(nil, &SomeOtherEvent{OrderID: "b"}, nil),
+	}
+
+	err := s.repo.Append(s.ctx, "stream", evs, Int(0))
+	c.Assert(err, IsNil)
+
+	got, err := s.repo.Read(s.ctx).Stream("stream").Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(*got[0].EventID(), Equals, *evs[0].EventID())
+	c.Assert(got[0].Event().Name(), Equals, "SomeEvent")
+	c.Assert(got[0].Event().Data(), Equals, `{"item":"a","count":1}`)
+	c.Assert(*got[0].Version(), Equals, 1)
+	c.Assert(*got[1].EventID(), Equals, *evs[1].EventID())
+	c.Assert(*got[1].Version(), Equals, 2)
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadFiltersByMetadata(c *C) {
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		ev := NewEventMessage(nil, &SomeEvent{Item: tenant}, nil)
+		ev.SetHeader("tenant", tenant)
+		c.Assert(s.repo.Append(s.ctx, "stream", []EventMessage{ev}, nil), IsNil)
+	}
+
+	got, err := s.repo.Read(s.ctx).Metadata("tenant", "acme").Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(got[0].GetHeaders()["tenant"], Equals, "acme")
+	c.Assert(*got[1].Version(), Equals, 3)
+}
+
+func (s *InMemoryEventRepositorySuite) TestAppendWithWrongExpectedVersionFails(c *C) {
+	s.appendEvents(c, "stream", 2)
+
+	err := s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, Int(1))
+	c.Assert(err, DeepEquals, &ErrConcurrencyViolation{
+		ExpectedVersion: Int(1),
+		ActualVersion:   Int(2),
+		StreamName:      "stream",
+	})
+
+	err = s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, Int(2))
+	c.Assert(err, IsNil)
+}
+
+func (s *InMemoryEventRepositorySuite) TestAppendToEmptyStreamIdFails(c *C) {
+	err := s.repo.Append(s.ctx, "", []EventMessage{NewTestEventMessage(NewUUID())}, nil)
+	c.Assert(err, FitsTypeOf, &ErrRepositoryExecution{})
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadBackwardWithLimit(c *C) {
+	evs := s.appendEvents(c, "stream", 3)
+
+	got, err := s.repo.Read(s.ctx).Stream("stream").Backward().Limit(2).ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(*got[0].EventID(), Equals, *evs[2].EventID())
+	c.Assert(*got[1].EventID(), Equals, *evs[1].EventID())
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadIdRange(c *C) {
+	s.appendEvents(c, "a", 2)
+	b := s.appendEvents(c, "b", 2)
+
+	got, err := s.repo.Read(s.ctx).FromId(2).ToId(3).Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(*got[1].EventID(), Equals, *b[0].EventID())
+
+	count, err := s.repo.Read(s.ctx).FromId(3).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 2)
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadTimeRange(c *C) {
+	s.appendEvents(c, "stream", 2)
+	from := time.Now()
+	s.appendEvents(c, "stream", 1)
+
+	count, err := s.repo.Read(s.ctx).FromTime(from).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 1)
+
+	count, err = s.repo.Read(s.ctx).ToTime(from).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 2)
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadEventAndEvents(c *C) {
+	evs := s.appendEvents(c, "stream", 3)
+
+	got, err := s.repo.Read(s.ctx).Event(*evs[1].EventID())
+	c.Assert(err, IsNil)
+	c.Assert(*got.Version(), Equals, 2)
+
+	list, err := s.repo.Read(s.ctx).Events([]string{*evs[0].EventID(), *evs[2].EventID()})
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 2)
+
+	_, err = s.repo.Read(s.ctx).Event(NewUUID())
+	c.Assert(err, FitsTypeOf, &ErrRepositoryExecution{})
+}
+
+func (s *InMemoryEventRepositorySuite) TestLast(c *C) {
+	evs := s.appendEvents(c, "stream", 3)
+	s.appendEvents(c, "other", 1)
+
+	last, err := s.repo.Read(s.ctx).Last("stream")
+	c.Assert(err, IsNil)
+	c.Assert(*last.EventID(), Equals, *evs[2].EventID())
+	c.Assert(*last.Version(), Equals, 3)
+
+	_, err = s.repo.Read(s.ctx).Last("missing")
+	c.Assert(err, FitsTypeOf, &ErrRepositoryExecution{})
+}
+
+func (s *InMemoryEventRepositorySuite) TestLinkAndDeleteStream(c *C) {
+	evs := s.appendEvents(c, "source", 2)
+
+	err := s.repo.Link(s.ctx, "linked", []string{*evs[1].EventID()}, Int(0))
+	c.Assert(err, IsNil)
+
+	err = s.repo.Link(s.ctx, "linked", []string{NewUUID()}, nil)
+	c.Assert(err, FitsTypeOf, &ErrRepositoryExecution{})
+
+	version, err := s.repo.GetVersionInStream(s.ctx, "linked", *evs[1].EventID())
+	c.Assert(err, IsNil)
+	c.Assert(*version, Equals, 1)
+
+	streamId, err := s.repo.GetStreamIdOf(s.ctx, *evs[1].EventID())
+	c.Assert(err, IsNil)
+	c.Assert(streamId, Equals, "source")
+
+	err = s.repo.DeleteStream(s.ctx, "linked")
+	c.Assert(err, IsNil)
+
+	in, err := s.repo.IsEventInStream(s.ctx, "linked", *evs[1].EventID())
+	c.Assert(err, IsNil)
+	c.Assert(in, Equals, false)
+
+	has, err := s.repo.HasEvent(s.ctx, *evs[1].EventID())
+	c.Assert(err, IsNil)
+	c.Assert(has, Equals, true)
+}
+
+func (s *InMemoryEventRepositorySuite) TestReadHonoursCancelledContext(c *C) {
+	s.appendEvents(c, "stream", 1)
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	_, err := s.repo.Read(ctx).ToList()
+	c.Assert(err, FitsTypeOf, &ErrRepositoryExecution{})
+}
+
+func (s *InMemoryEventRepositorySuite) TestConcurrentAppendsWithExpectedVersion(c *C) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, Int(0))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	c.Assert(succeeded, Equals, 1)
+
+	count, err := s.repo.Read(s.ctx).Stream("stream").Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 1)
+}
+
+func (s *InMemoryEventRepositorySuite) TestSqlDomainRepoOverInMemoryRepository(c *C) {
+	repo, err := NewSqlDomainRepository(s.repo, NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	eventFactory := NewDelegateEventFactory()
+	eventFactory.RegisterDelegate("SomeEvent",
+		func() Event { return &SomeEvent{} })
+	repo.SetEventFactory(eventFactory)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+	c.Assert(repo.Save(s.ctx, id, agg, Int(0)), IsNil)
+
+	got := NewRebuildableAggregate(id)
+	c.Assert(repo.Load(s.ctx, id, got), IsNil)
+	c.Assert(got.CurrentVersion(), Equals, 1)
+}
@@ -17,16 +17,23 @@ type OrmDriver uint
 const (
 	OrmDriverPostgres OrmDriver = iota + 1
 	OrmDriverMysql
+	OrmDriverSqlite
 )
 
 type DB interface {
 	GetQuery() *models.Query
 	GetDB() *gorm.DB
+	Driver() OrmDriver
 }
 
 type conn struct {
-	db *gorm.DB
-	q  *models.Query
+	db     *gorm.DB
+	q      *models.Query
+	driver OrmDriver
+}
+
+func (c *conn) Driver() OrmDriver {
+	return c.driver
 }
 
 func (c *conn) GetDB() *gorm.DB {
@@ -59,6 +66,8 @@ func New(driver OrmDriver, dsn string, debug ...bool) (DB, error) {
 		d = mysql.New(mysql.Config{
 			DSN: dsn,
 		})
+	case OrmDriverSqlite:
+		d = newSqliteDialector(dsn)
 	default:
 		return nil, fmt.Errorf("unknown driver")
 	}
@@ -71,9 +80,25 @@ func New(driver OrmDriver, dsn string, debug ...bool) (DB, error) {
 		return nil, err
 	}
 
+	if driver == OrmDriverSqlite {
+		// SQLite allows a single writer only, and every connection to ":memory:"
+		// opens its own private database. Pin the pool to one connection so
+		// all queries see the same data and writers never contend.
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+
+		if err := migrateSqlite(db); err != nil {
+			return nil, err
+		}
+	}
+
 	c := &conn{
-		db: db,
-		q:  models.Use(db),
+		db:     db,
+		q:      models.Use(db),
+		driver: driver,
 	}
 	models.SetDefault(db)
 
@@ -16,39 +16,74 @@ import (
 )
 
 var (
-	Q           = new(Query)
-	EventStore  *eventStore
-	EventStream *eventStream
+	Q                    = new(Query)
+	DeadLetter           *deadLetter
+	EventOutbox          *eventOutbox
+	EventOutboxRelay     *eventOutboxRelay
+	EventStore           *eventStore
+	EventStream          *eventStream
+	ProcessedCommand     *processedCommand
+	ProjectionCheckpoint *projectionCheckpoint
+	ScheduledCommand     *scheduledCommand
+	SnapshotStore        *snapshotStore
 )
 
 func SetDefault(db *gorm.DB, opts ...gen.DOOption) {
 	*Q = *Use(db, opts...)
+	DeadLetter = &Q.DeadLetter
+	EventOutbox = &Q.EventOutbox
+	EventOutboxRelay = &Q.EventOutboxRelay
 	EventStore = &Q.EventStore
 	EventStream = &Q.EventStream
+	ProcessedCommand = &Q.ProcessedCommand
+	ProjectionCheckpoint = &Q.ProjectionCheckpoint
+	ScheduledCommand = &Q.ScheduledCommand
+	SnapshotStore = &Q.SnapshotStore
 }
 
 func Use(db *gorm.DB, opts ...gen.DOOption) *Query {
 	return &Query{
-		db:          db,
-		EventStore:  newEventStore(db, opts...),
-		EventStream: newEventStream(db, opts...),
+		db:                   db,
+		DeadLetter:           newDeadLetter(db, opts...),
+		EventOutbox:          newEventOutbox(db, opts...),
+		EventOutboxRelay:     newEventOutboxRelay(db, opts...),
+		EventStore:           newEventStore(db, opts...),
+		EventStream:          newEventStream(db, opts...),
+		ProcessedCommand:     newProcessedCommand(db, opts...),
+		ProjectionCheckpoint: newProjectionCheckpoint(db, opts...),
+		ScheduledCommand:     newScheduledCommand(db, opts...),
+		SnapshotStore:        newSnapshotStore(db, opts...),
 	}
 }
 
 type Query struct {
 	db *gorm.DB
 
-	EventStore  eventStore
-	EventStream eventStream
+	DeadLetter           deadLetter
+	EventOutbox          eventOutbox
+	EventOutboxRelay     eventOutboxRelay
+	EventStore           eventStore
+	EventStream          eventStream
+	ProcessedCommand     processedCommand
+	ProjectionCheckpoint projectionCheckpoint
+	ScheduledCommand     scheduledCommand
+	SnapshotStore        snapshotStore
 }
 
 func (q *Query) Available() bool { return q.db != nil }
 
 func (q *Query) clone(db *gorm.DB) *Query {
 	return &Query{
-		db:          db,
-		EventStore:  q.EventStore.clone(db),
-		EventStream: q.EventStream.clone(db),
+		db:                   db,
+		DeadLetter:           q.DeadLetter.clone(db),
+		EventOutbox:          q.EventOutbox.clone(db),
+		EventOutboxRelay:     q.EventOutboxRelay.clone(db),
+		EventStore:           q.EventStore.clone(db),
+		EventStream:          q.EventStream.clone(db),
+		ProcessedCommand:     q.ProcessedCommand.clone(db),
+		ProjectionCheckpoint: q.ProjectionCheckpoint.clone(db),
+		ScheduledCommand:     q.ScheduledCommand.clone(db),
+		SnapshotStore:        q.SnapshotStore.clone(db),
 	}
 }
 
@@ -62,21 +97,42 @@ func (q *Query) WriteDB() *Query {
 
 func (q *Query) ReplaceDB(db *gorm.DB) *Query {
 	return &Query{
-		db:          db,
-		EventStore:  q.EventStore.replaceDB(db),
-		EventStream: q.EventStream.replaceDB(db),
+		db:                   db,
+		DeadLetter:           q.DeadLetter.replaceDB(db),
+		EventOutbox:          q.EventOutbox.replaceDB(db),
+		EventOutboxRelay:     q.EventOutboxRelay.replaceDB(db),
+		EventStore:           q.EventStore.replaceDB(db),
+		EventStream:          q.EventStream.replaceDB(db),
+		ProcessedCommand:     q.ProcessedCommand.replaceDB(db),
+		ProjectionCheckpoint: q.ProjectionCheckpoint.replaceDB(db),
+		ScheduledCommand:     q.ScheduledCommand.replaceDB(db),
+		SnapshotStore:        q.SnapshotStore.replaceDB(db),
 	}
 }
 
 type queryCtx struct {
-	EventStore  IEventStoreDo
-	EventStream IEventStreamDo
+	DeadLetter           IDeadLetterDo
+	EventOutbox          IEventOutboxDo
+	EventOutboxRelay     IEventOutboxRelayDo
+	EventStore           IEventStoreDo
+	EventStream          IEventStreamDo
+	ProcessedCommand     IProcessedCommandDo
+	ProjectionCheckpoint IProjectionCheckpointDo
+	ScheduledCommand     IScheduledCommandDo
+	SnapshotStore        ISnapshotStoreDo
 }
 
 func (q *Query) WithContext(ctx context.Context) *queryCtx {
 	return &queryCtx{
-		EventStore:  q.EventStore.WithContext(ctx),
-		EventStream: q.EventStream.WithContext(ctx),
+		DeadLetter:           q.DeadLetter.WithContext(ctx),
+		EventOutbox:          q.EventOutbox.WithContext(ctx),
+		EventOutboxRelay:     q.EventOutboxRelay.WithContext(ctx),
+		EventStore:           q.EventStore.WithContext(ctx),
+		EventStream:          q.EventStream.WithContext(ctx),
+		ProcessedCommand:     q.ProcessedCommand.WithContext(ctx),
+		ProjectionCheckpoint: q.ProjectionCheckpoint.WithContext(ctx),
+		ScheduledCommand:     q.ScheduledCommand.WithContext(ctx),
+		SnapshotStore:        q.SnapshotStore.WithContext(ctx),
 	}
 }
 
@@ -0,0 +1,91 @@
+package orm
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	migrationSql "github.com/jetbasrawi/go.cqrs/migration/sql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	gooseUpMarker   = "-- +goose Up"
+	gooseDownMarker = "-- +goose Down"
+	gooseAnnotation = "-- +goose"
+)
+
+// sqliteDialector wraps the pure-Go SQLite dialector to quote identifiers
+// that are already quoted.
+//
+// gorm/gen hands over column names such as "`event_stream`.`id`" when a
+// qualified field is selected, the upstream dialector would quote them again.
+type sqliteDialector struct {
+	gorm.Dialector
+}
+
+func newSqliteDialector(dsn string) gorm.Dialector {
+	return sqliteDialector{
+		Dialector: sqlite.Open(dsn),
+	}
+}
+
+func (d sqliteDialector) QuoteTo(writer clause.Writer, str string) {
+	for i, part := range strings.Split(str, ".") {
+		if i > 0 {
+			writer.WriteByte('.')
+		}
+		writer.WriteByte('`')
+		writer.WriteString(strings.Trim(part, "`"))
+		writer.WriteByte('`')
+	}
+}
+
+// migrateSqlite applies the Up section of every bundled SQLite migration.
+//
+// SQLite databases are usually private to the process (a file on disk or
+// ":memory:"), so there is no external migrator that can prepare the schema
+// before the repository opens it. All migrations are idempotent.
+func migrateSqlite(db *gorm.DB) error {
+	files, err := fs.Glob(migrationSql.Sqlite, "sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		b, err := fs.ReadFile(migrationSql.Sqlite, f)
+		if err != nil {
+			return err
+		}
+
+		if err := db.Exec(gooseUpSection(string(b))).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gooseUpSection returns the statements of the Up section of a goose migration
+// with the goose annotations stripped.
+func gooseUpSection(migration string) string {
+	if i := strings.Index(migration, gooseUpMarker); i >= 0 {
+		migration = migration[i+len(gooseUpMarker):]
+	}
+	if i := strings.Index(migration, gooseDownMarker); i >= 0 {
+		migration = migration[:i]
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(migration, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), gooseAnnotation) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
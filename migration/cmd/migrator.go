@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	_env "github.com/alfarih31/nb-go-env"
+	_ "github.com/glebarez/go-sqlite"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jetbasrawi/go.cqrs/migration/pkg"
 	_ "github.com/lib/pq"
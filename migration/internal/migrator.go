@@ -16,12 +16,16 @@ type Migrator struct {
 }
 
 // NewMigrator creates a database migrator
-func NewMigrator(driver *sql.DB, dir string, out io.Writer) *Migrator {
+func NewMigrator(driver *sql.DB, dialect string, dir string, out io.Writer) (*Migrator, error) {
 	goose.SetLogger(log.New(out, "migrator ", log.LstdFlags))
+	if err := goose.SetDialect(dialect); err != nil {
+		return nil, err
+	}
+
 	return &Migrator{
 		driver: driver,
 		dir:    dir,
-	}
+	}, nil
 }
 
 // Up runs migration up
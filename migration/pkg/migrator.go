@@ -25,7 +25,17 @@ func Create(driver, dsn string, migrationDir ...string) (Migrator, error) {
 		return nil, err
 	}
 
-	mg := internal.NewMigrator(db, mDir, os.Stdout)
+	// SQLite is served by a pure-Go driver registered as "sqlite",
+	// goose knows the dialect as "sqlite3".
+	dialect := driver
+	if driver == "sqlite" {
+		dialect = "sqlite3"
+	}
+
+	mg, err := internal.NewMigrator(db, dialect, mDir, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
 
 	return &migrator{
 		Migrator: mg,
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_outbox
+(
+    id         BIGSERIAL primary key,
+    event_id uuid not null ,
+    stream_id varchar(255) not null ,
+    stream_version INTEGER not null ,
+    event_name varchar(255) not null ,
+    event_data text not null ,
+    metadata text ,
+    created_at timestamp without time zone not null default now()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_outbox;
+-- +goose StatementEnd
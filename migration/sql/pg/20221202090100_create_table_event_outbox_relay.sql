@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_outbox_relay
+(
+    name varchar(255) primary key ,
+    last_relayed_id BIGINT not null DEFAULT 0,
+    updated_at timestamp without time zone not null default now()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_outbox_relay;
+-- +goose StatementEnd
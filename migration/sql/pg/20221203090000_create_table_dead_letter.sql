@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS dead_letter
+(
+    id         BIGSERIAL primary key,
+    kind varchar(16) not null ,
+    name varchar(255) not null ,
+    handler varchar(255) not null ,
+    event_id varchar(255) ,
+    aggregate_id varchar(255) ,
+    version INTEGER ,
+    data text not null ,
+    headers text ,
+    error text not null ,
+    attempts INTEGER not null DEFAULT 1,
+    created_at timestamp without time zone not null default now()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS dead_letter;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS projection_checkpoints
+(
+    name varchar(255) primary key ,
+    position BIGINT not null DEFAULT 0,
+    updated_at timestamp without time zone not null default now()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS projection_checkpoints;
+-- +goose StatementEnd
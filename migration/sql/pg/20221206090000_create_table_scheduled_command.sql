@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS scheduled_command
+(
+    id varchar(255) primary key ,
+    command_name varchar(255) not null ,
+    aggregate_id varchar(255) not null ,
+    data text not null ,
+    headers text ,
+    due_at timestamp without time zone not null ,
+    attempts INTEGER not null DEFAULT 0,
+    last_error text ,
+    created_at timestamp without time zone not null default now()
+);
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS scheduled_command_due_at_idx ON scheduled_command (due_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS scheduled_command;
+-- +goose StatementEnd
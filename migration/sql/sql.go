@@ -0,0 +1,10 @@
+// Package sql bundles the migration scripts so they can be applied without
+// access to the source tree.
+package sql
+
+import "embed"
+
+// Sqlite holds the goose migrations for the SQLite driver.
+//
+//go:embed sqlite/*.sql
+var Sqlite embed.FS
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_store
+(
+    id         INTEGER primary key AUTOINCREMENT,
+    event_id varchar(36) not null unique ,
+    event_name varchar(255) not null ,
+    event_data text not null ,
+    metadata text ,
+    created_at datetime not null default CURRENT_TIMESTAMP
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_store;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_stream
+(
+    id         INTEGER primary key AUTOINCREMENT,
+    stream_id varchar(255) not null ,
+    stream_version INTEGER not null DEFAULT 1,
+    event_id varchar(36) not null ,
+    created_at datetime not null default CURRENT_TIMESTAMP,
+    UNIQUE (stream_id, stream_version),
+    CONSTRAINT fk_event_stream_event_id FOREIGN KEY (event_id) REFERENCES event_store(event_id)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_stream;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS snapshot_store
+(
+    id         INTEGER primary key AUTOINCREMENT,
+    stream_id varchar(255) not null ,
+    stream_version INTEGER not null ,
+    snapshot_data text not null ,
+    created_at datetime not null default CURRENT_TIMESTAMP,
+    UNIQUE (stream_id, stream_version)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS snapshot_store;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_outbox
+(
+    id         INTEGER primary key AUTOINCREMENT,
+    event_id varchar(36) not null ,
+    stream_id varchar(255) not null ,
+    stream_version INTEGER not null ,
+    event_name varchar(255) not null ,
+    event_data text not null ,
+    metadata text ,
+    created_at datetime not null default CURRENT_TIMESTAMP
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_outbox;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS processed_command
+(
+    command_id   varchar(255) primary key,
+    command_name varchar(255) not null ,
+    result text ,
+    pending boolean not null default false,
+    processed_at datetime not null default CURRENT_TIMESTAMP
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS processed_command;
+-- +goose StatementEnd
@@ -69,7 +69,21 @@ func main() {
 		GORMTag:       "foreignKey:event_id;references:event_id",
 	}))
 
-	g.ApplyBasic(EventStoreModel, EventStreamModel)
+	SnapshotStoreModel := g.GenerateModel("snapshot_store")
+
+	EventOutboxModel := g.GenerateModel("event_outbox")
+
+	EventOutboxRelayModel := g.GenerateModel("event_outbox_relay")
+
+	DeadLetterModel := g.GenerateModel("dead_letter")
+
+	ProcessedCommandModel := g.GenerateModel("processed_command")
+
+	ProjectionCheckpointModel := g.GenerateModel("projection_checkpoints")
+
+	ScheduledCommandModel := g.GenerateModel("scheduled_command")
+
+	g.ApplyBasic(EventStoreModel, EventStreamModel, SnapshotStoreModel, EventOutboxModel, EventOutboxRelayModel, DeadLetterModel, ProcessedCommandModel, ProjectionCheckpointModel, ScheduledCommandModel)
 
 	g.Execute()
 }
@@ -0,0 +1,338 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/uuid"
+)
+
+// HeaderProcessManager is the header set on the events of a process manager
+// stream that holds the name of the process manager.
+const HeaderProcessManager = "process_manager"
+
+// ProcessManager is a long running workflow that reacts to events by
+// dispatching commands, also known as a saga.
+//
+// The state of a process manager is event sourced like the state of an
+// aggregate: the events it raises are appended to its own stream and applied
+// with Apply when it is loaded. The commands it dispatches, the timeouts it
+// schedules and its completion are recorded in the stream as well. Process
+// managers embed a ProcessManagerBase and are run by a ProcessManagerRunner.
+// The state of a process is rebuilt with the handlers registered with On:
+//
+//	type Checkout struct {
+//		*ycq.ProcessManagerBase
+//		orderID string
+//	}
+//
+//	func NewCheckout(key string) ycq.ProcessManager {
+//		p := &Checkout{ProcessManagerBase: ycq.NewProcessManagerBase(key)}
+//		ycq.On(p.AggregateBase, func(e CheckoutStarted) { p.orderID = e.OrderID })
+//		return p
+//	}
+//
+//	func (p *Checkout) Handle(ctx context.Context, event ycq.EventMessage) error {
+//		switch e := event.Event().(type) {
+//		case *OrderPlaced:
+//			if err := p.Raise(ycq.NewTypedEvent(CheckoutStarted{OrderID: e.OrderID})); err != nil {
+//				return err
+//			}
+//			if _, err := p.ScheduleTimeout("payment", time.Hour); err != nil {
+//				return err
+//			}
+//			return p.Dispatch(ycq.NewCommandMessage(e.OrderID, &RequestPayment{}))
+//		case *ycq.TypedEvent[ycq.ProcessTimeoutFired]:
+//			return p.Dispatch(ycq.NewCommandMessage(p.orderID, &CancelOrder{}))
+//		}
+//		return nil
+//	}
+type ProcessManager interface {
+	AggregateRoot
+
+	// Handle reacts to an event the process is correlated with, or to a
+	// ProcessTimeoutFired event when one of its timeouts is due.
+	Handle(ctx context.Context, event EventMessage) error
+
+	processManagerBase() *ProcessManagerBase
+}
+
+// ProcessCommandIssued is recorded in the stream of a process manager for every
+// command it dispatches, before the command is dispatched.
+type ProcessCommandIssued struct {
+	CommandID   string                 `json:"command_id"`
+	CommandName string                 `json:"command_name"`
+	AggregateID string                 `json:"aggregate_id"`
+	Command     json.RawMessage        `json:"command"`
+	Headers     map[string]interface{} `json:"headers,omitempty"`
+}
+
+// ProcessCommandsDispatched is recorded in the stream of a process manager once
+// the issued commands were dispatched.
+type ProcessCommandsDispatched struct {
+	CommandIDs []string `json:"command_ids"`
+}
+
+// ProcessTimeoutScheduled is recorded in the stream of a process manager when it
+// schedules a timeout.
+type ProcessTimeoutScheduled struct {
+	TimeoutID     string    `json:"timeout_id"`
+	Name          string    `json:"name"`
+	Due           time.Time `json:"due"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+}
+
+// ProcessTimeoutFired is recorded in the stream of a process manager when one of
+// its timeouts is due, the process manager handles it like any other event.
+type ProcessTimeoutFired struct {
+	TimeoutID string    `json:"timeout_id"`
+	Name      string    `json:"name"`
+	Due       time.Time `json:"due"`
+}
+
+// ProcessCompleted is recorded in the stream of a process manager when it
+// completes, a completed process ignores further events and timeouts.
+type ProcessCompleted struct{}
+
+// processEventFactory decodes the events recorded by ProcessManagerBase.
+var processEventFactory = newProcessEventFactory()
+
+func newProcessEventFactory() *DelegateEventFactory {
+	factory := NewDelegateEventFactory()
+	_ = RegisterTypedEvent[ProcessCommandIssued](factory)
+	_ = RegisterTypedEvent[ProcessCommandsDispatched](factory)
+	_ = RegisterTypedEvent[ProcessTimeoutScheduled](factory)
+	_ = RegisterTypedEvent[ProcessTimeoutFired](factory)
+	_ = RegisterTypedEvent[ProcessCompleted](factory)
+	return factory
+}
+
+// issuedCommand is a command recorded by a process manager that was not
+// dispatched yet.
+type issuedCommand struct {
+	ProcessCommandIssued
+
+	// message is the command passed to Dispatch, it is nil for commands
+	// loaded from the stream.
+	message CommandMessage
+}
+
+// ProcessManagerBase is embedded by process managers, it extends AggregateBase
+// with the dispatch of commands, timeouts and completion.
+type ProcessManagerBase struct {
+	*AggregateBase
+
+	// handled holds the ids of the events and timeouts the process handled,
+	// taken from the causation id of the events in its stream.
+	handled   map[string]bool
+	pending   []*issuedCommand
+	timeouts  map[string]ProcessTimeoutScheduled
+	completed bool
+
+	// streamId is the stream the process is persisted in, the ids of its
+	// commands are derived from it.
+	streamId string
+
+	// cause is the event being handled, it is the causation of the commands
+	// and timeouts recorded while it is handled.
+	cause    EventMessage
+	now      func() time.Time
+	commands int
+
+	// rebuildErr is the error RebuildFromEvents stopped at.
+	rebuildErr error
+}
+
+// NewProcessManagerBase constructs a new ProcessManagerBase.
+func NewProcessManagerBase(id string) *ProcessManagerBase {
+	return &ProcessManagerBase{
+		AggregateBase: NewAggregateBase(id),
+		streamId:      id,
+		handled:       make(map[string]bool),
+		timeouts:      make(map[string]ProcessTimeoutScheduled),
+		now:           time.Now,
+	}
+}
+
+func (p *ProcessManagerBase) processManagerBase() *ProcessManagerBase {
+	return p
+}
+
+// Apply does nothing. The runner applies the events of a process with the
+// handlers registered with On, a process manager that keeps its state without
+// them overrides Apply.
+func (p *ProcessManagerBase) Apply(event EventMessage) {}
+
+// Rebuild applies the events recorded by ProcessManagerBase and the events
+// raised by the process with the handlers registered with On, and increments
+// the version for each of them.
+//
+// It stops at the first event without a handler and returns ErrUnhandledEvent.
+func (p *ProcessManagerBase) Rebuild(events []EventMessage) error {
+	for _, event := range events {
+		if !p.applyProcessEvent(event) && p.routesEvents() {
+			if err := p.ApplyEvent(event); err != nil {
+				return err
+			}
+		}
+		p.IncrementVersion()
+	}
+
+	return nil
+}
+
+// RebuildFromEvents rebuilds the process like Rebuild. It stops at the first
+// event the process fails to apply and records the error, RebuildAggregate
+// returns it.
+func (p *ProcessManagerBase) RebuildFromEvents(events []EventMessage) {
+	p.rebuildErr = p.Rebuild(events)
+}
+
+func (p *ProcessManagerBase) rebuildError() error {
+	return p.rebuildErr
+}
+
+// Dispatch records the command, it is dispatched by the runner once the process
+// was saved.
+//
+// The command is given an id derived from the process and the event being
+// handled, so that the command dispatched again after a failure has the same
+// id and can be dropped by DeduplicationMiddleware. Its correlation id is the
+// one of the event and its causation id the id of the event.
+func (p *ProcessManagerBase) Dispatch(command CommandMessage) error {
+	if p.cause == nil {
+		return fmt.Errorf("process manager %s can only dispatch while handling an event", p.AggregateID())
+	}
+
+	data, err := json.Marshal(command.Command())
+	if err != nil {
+		return &ErrUnexpected{Err: err}
+	}
+
+	causationId := eventCausationId(p.cause)
+	p.commands++
+	commandId := uuid.NewV5(uuid.NamespaceOID, p.streamId+"/"+causationId+"/"+strconv.Itoa(p.commands)).String()
+
+	command.SetHeader(HeaderCommandId, commandId)
+	command.SetHeader(HeaderCausationId, causationId)
+	for _, key := range []string{HeaderCorrelationId, HeaderActor} {
+		setMissingHeader(command.Headers(), command.SetHeader, key, p.cause.GetHeaders()[key])
+	}
+
+	p.record(NewTypedEvent(ProcessCommandIssued{
+		CommandID:   commandId,
+		CommandName: command.CommandName(),
+		AggregateID: command.AggregateID(),
+		Command:     data,
+		Headers:     copyHeaders(command.Headers()),
+	}))
+	p.pending[len(p.pending)-1].message = command
+
+	return nil
+}
+
+// ScheduleTimeout schedules a timeout with the name due after the duration and
+// returns its id. The runner calls Handle with a ProcessTimeoutFired event once
+// the timeout is due, unless the process completed before.
+func (p *ProcessManagerBase) ScheduleTimeout(name string, after time.Duration) (string, error) {
+	if p.cause == nil {
+		return "", fmt.Errorf("process manager %s can only schedule a timeout while handling an event", p.AggregateID())
+	}
+
+	timeoutId := NewUUID()
+	p.record(NewTypedEvent(ProcessTimeoutScheduled{
+		TimeoutID:     timeoutId,
+		Name:          name,
+		Due:           p.now().Add(after).UTC(),
+		CorrelationID: CorrelationId(p.cause.GetHeaders()),
+	}))
+
+	return timeoutId, nil
+}
+
+// Complete ends the process. Its pending timeouts are dropped and further
+// events are ignored, the commands it dispatched are still delivered.
+func (p *ProcessManagerBase) Complete() {
+	if !p.completed {
+		p.record(NewTypedEvent(ProcessCompleted{}))
+	}
+}
+
+// Completed reports whether the process completed.
+func (p *ProcessManagerBase) Completed() bool {
+	return p.completed
+}
+
+// Timeouts returns the timeouts of the process that did not fire yet, by due
+// time.
+func (p *ProcessManagerBase) Timeouts() []ProcessTimeoutScheduled {
+	timeouts := make([]ProcessTimeoutScheduled, 0, len(p.timeouts))
+	for _, t := range p.timeouts {
+		timeouts = append(timeouts, t)
+	}
+
+	sort.Slice(timeouts, func(i, j int) bool {
+		return timeouts[i].Due.Before(timeouts[j].Due)
+	})
+
+	return timeouts
+}
+
+// record applies an event of the process manager to the base and tracks it as
+// a change.
+func (p *ProcessManagerBase) record(event Event) {
+	em := NewEventMessage(nil, event, Int(p.CurrentVersion()+1))
+	p.applyProcessEvent(em)
+	p.TrackChange(em)
+}
+
+// applyProcessEvent applies the events recorded by the base and reports whether
+// the event was one of them.
+func (p *ProcessManagerBase) applyProcessEvent(em EventMessage) bool {
+	switch e := em.Event().(type) {
+	case *TypedEvent[ProcessCommandIssued]:
+		p.pending = append(p.pending, &issuedCommand{ProcessCommandIssued: e.Payload()})
+	case *TypedEvent[ProcessCommandsDispatched]:
+		dispatched := make(map[string]bool)
+		for _, id := range e.Payload().CommandIDs {
+			dispatched[id] = true
+		}
+
+		pending := p.pending[:0]
+		for _, c := range p.pending {
+			if !dispatched[c.CommandID] {
+				pending = append(pending, c)
+			}
+		}
+		p.pending = pending
+	case *TypedEvent[ProcessTimeoutScheduled]:
+		p.timeouts[e.Payload().TimeoutID] = e.Payload()
+	case *TypedEvent[ProcessTimeoutFired]:
+		delete(p.timeouts, e.Payload().TimeoutID)
+	case *TypedEvent[ProcessCompleted]:
+		p.completed = true
+		p.timeouts = make(map[string]ProcessTimeoutScheduled)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// eventCausationId returns the id an event is referred to by as the causation
+// of what the process does while handling it.
+func eventCausationId(em EventMessage) string {
+	if id := em.EventID(); id != nil {
+		return *id
+	}
+
+	if fired, ok := em.Event().(*TypedEvent[ProcessTimeoutFired]); ok {
+		return fired.Payload().TimeoutID
+	}
+
+	return ""
+}
@@ -0,0 +1,477 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = suiteForEveryRepository(func(fixture repositoryFixture) interface{} {
+	return &ProcessManagerSuite{repositoryFixture: fixture}
+})
+
+// ProcessManagerSuite runs against every EventRepository implementation.
+type ProcessManagerSuite struct {
+	repositoryFixture
+	repo       EventRepository
+	commands   *recordingCommandHandler
+	clock      *ManualClock
+	gapTimeout time.Duration
+	ctx        context.Context
+}
+
+type OrderPlaced struct {
+	OrderID string `json:"order_id"`
+}
+
+type PaymentReceived struct {
+	OrderID string `json:"order_id"`
+}
+
+type CheckoutStarted struct {
+	OrderID string `json:"order_id"`
+}
+
+type RequestPayment struct {
+	OrderID string
+}
+
+type ShipOrder struct {
+	OrderID string
+}
+
+type CancelOrder struct {
+	OrderID string
+}
+
+// checkoutProcess requests the payment of an order and ships it once paid, or
+// cancels it when it is not paid within an hour.
+type checkoutProcess struct {
+	*ProcessManagerBase
+	orderID string
+}
+
+func newCheckoutProcess(key string) ProcessManager {
+	p := &checkoutProcess{ProcessManagerBase: NewProcessManagerBase(key)}
+	On(p.AggregateBase, func(e CheckoutStarted) { p.orderID = e.OrderID })
+	return p
+}
+
+func (p *checkoutProcess) Handle(ctx context.Context, event EventMessage) error {
+	switch e := event.Event().(type) {
+	case *TypedEvent[OrderPlaced]:
+		if err := p.Raise(NewTypedEvent(CheckoutStarted{OrderID: e.Payload().OrderID})); err != nil {
+			return err
+		}
+		if _, err := p.ScheduleTimeout("payment", time.Hour); err != nil {
+			return err
+		}
+		return p.Dispatch(NewCommandMessage(p.orderID, &RequestPayment{OrderID: p.orderID}))
+	case *TypedEvent[PaymentReceived]:
+		p.Complete()
+		return p.Dispatch(NewCommandMessage(p.orderID, &ShipOrder{OrderID: p.orderID}))
+	case *TypedEvent[ProcessTimeoutFired]:
+		p.Complete()
+		return p.Dispatch(NewCommandMessage(p.orderID, &CancelOrder{OrderID: p.orderID}))
+	}
+
+	return nil
+}
+
+// recordingCommandHandler records the commands it handles, it fails while
+// failures is positive.
+type recordingCommandHandler struct {
+	mu       sync.Mutex
+	failures int
+	commands []CommandMessage
+
+	// committed makes the failures ErrPublishFailed, returned once the
+	// command was handled.
+	committed bool
+}
+
+func (h *recordingCommandHandler) Handle(ctx context.Context, command CommandMessage) (any, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failures > 0 {
+		h.failures--
+		if h.committed {
+			h.commands = append(h.commands, command)
+			return nil, &ErrPublishFailed{Event: NewTestEventMessage(command.AggregateID()), Errors: []error{fmt.Errorf("dispatch failed")}}
+		}
+		return nil, fmt.Errorf("dispatch failed")
+	}
+
+	h.commands = append(h.commands, command)
+	return nil, nil
+}
+
+func (h *recordingCommandHandler) names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := make([]string, len(h.commands))
+	for i, command := range h.commands {
+		names[i] = command.CommandName()
+	}
+
+	return names
+}
+
+func (s *ProcessManagerSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	s.repo = s.openRepository(c)
+	s.commands = &recordingCommandHandler{}
+	s.clock = NewManualClock(time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC))
+	s.gapTimeout = 0
+}
+
+func (s *ProcessManagerSuite) runner(c *C, middlewares ...CommandMiddleware) *ProcessManagerRunner {
+	dispatcher := NewInMemoryDispatcher()
+	c.Assert(dispatcher.RegisterHandler(s.commands, &RequestPayment{}, &ShipOrder{}, &CancelOrder{}), IsNil)
+	dispatcher.Use(middlewares...)
+
+	events := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[CheckoutStarted](events), IsNil)
+
+	commands := NewDelegateCommandFactory()
+	c.Assert(commands.RegisterDelegate(&RequestPayment{}, func() interface{} { return &RequestPayment{} }), IsNil)
+	c.Assert(commands.RegisterDelegate(&ShipOrder{}, func() interface{} { return &ShipOrder{} }), IsNil)
+	c.Assert(commands.RegisterDelegate(&CancelOrder{}, func() interface{} { return &CancelOrder{} }), IsNil)
+
+	runner, err := NewProcessManagerRunner("checkout", s.repo, dispatcher, newCheckoutProcess, ProcessManagerOptions{
+		EventFactory:   events,
+		CommandFactory: commands,
+		Clock:          s.clock,
+		GapTimeout:     s.gapTimeout,
+	})
+	c.Assert(err, IsNil)
+
+	orderID := func(em EventMessage) string {
+		switch e := em.Event().(type) {
+		case *TypedEvent[OrderPlaced]:
+			return e.Payload().OrderID
+		case *TypedEvent[PaymentReceived]:
+			return e.Payload().OrderID
+		}
+		return ""
+	}
+	c.Assert(runner.StartedBy("OrderPlaced", orderID), IsNil)
+	c.Assert(runner.HandledBy("PaymentReceived", orderID), IsNil)
+
+	return runner
+}
+
+func newOrderEvent(payload interface{}) EventMessage {
+	id := NewUUID()
+
+	var event Event
+	switch p := payload.(type) {
+	case OrderPlaced:
+		event = NewTypedEvent(p)
+	case PaymentReceived:
+		event = NewTypedEvent(p)
+	}
+
+	em := NewEventMessage(&id, event, nil)
+	em.SetHeader(HeaderCorrelationId, "correlation")
+	return em
+}
+
+func (s *ProcessManagerSuite) TestStartingEventDispatchesCommands(c *C) {
+	runner := s.runner(c)
+
+	placed := newOrderEvent(OrderPlaced{OrderID: "order-1"})
+	c.Assert(runner.HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+
+	command := s.commands.commands[0]
+	c.Assert(command.Command(), DeepEquals, &RequestPayment{OrderID: "order-1"})
+	c.Assert(CorrelationId(command.Headers()), Equals, "correlation")
+	c.Assert(CausationId(command.Headers()), Equals, *placed.EventID())
+	c.Assert(CommandID(command), Not(Equals), "")
+
+	pm, err := runner.Load(s.ctx, "order-1")
+	c.Assert(err, IsNil)
+	c.Assert(pm.(*checkoutProcess).orderID, Equals, "order-1")
+	c.Assert(pm.(*checkoutProcess).Timeouts(), HasLen, 1)
+	c.Assert(pm.(*checkoutProcess).Completed(), Equals, false)
+
+	evs, err := s.repo.Read(s.ctx).Stream(runner.StreamId("order-1")).Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(evs, HasLen, 4)
+	for _, ev := range evs {
+		c.Assert(ev.GetHeaders()[HeaderProcessManager], Equals, "checkout")
+		c.Assert(CorrelationId(ev.GetHeaders()), Equals, "correlation")
+	}
+}
+
+func (s *ProcessManagerSuite) TestDuplicateEventIsHandledOnce(c *C) {
+	runner := s.runner(c)
+
+	placed := newOrderEvent(OrderPlaced{OrderID: "order-1"})
+	c.Assert(runner.HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(runner.HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+}
+
+func (s *ProcessManagerSuite) TestEventWithoutProcessIsIgnored(c *C) {
+	runner := s.runner(c)
+
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(PaymentReceived{OrderID: "order-1"})), IsNil)
+	c.Assert(runner.HandleEvent(s.ctx, NewEventMessage(nil, NewTypedEvent(ItemAdded{}), nil)), IsNil)
+	c.Assert(s.commands.names(), HasLen, 0)
+
+	evs, err := s.repo.Read(s.ctx).ToList()
+	c.Assert(err, IsNil)
+	c.Assert(evs, HasLen, 0)
+}
+
+func (s *ProcessManagerSuite) TestCompletedProcessIgnoresEventsAndTimeouts(c *C) {
+	runner := s.runner(c)
+
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(PaymentReceived{OrderID: "order-1"})), IsNil)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(PaymentReceived{OrderID: "order-1"})), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "ShipOrder"})
+
+	s.clock.Advance(2 * time.Hour)
+	fired, err := runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+
+	pm, err := runner.Load(s.ctx, "order-1")
+	c.Assert(err, IsNil)
+	c.Assert(pm.(*checkoutProcess).Completed(), Equals, true)
+}
+
+func (s *ProcessManagerSuite) TestDueTimeoutIsFired(c *C) {
+	runner := s.runner(c)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+
+	s.clock.Advance(59 * time.Minute)
+	fired, err := runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+
+	s.clock.Advance(time.Minute)
+	fired, err = runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 1)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "CancelOrder"})
+	c.Assert(CorrelationId(s.commands.commands[1].Headers()), Equals, "correlation")
+
+	fired, err = runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+}
+
+func (s *ProcessManagerSuite) TestTimeoutsAreFoundAfterRestart(c *C) {
+	c.Assert(s.runner(c).HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+	c.Assert(s.runner(c).HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-2"})), IsNil)
+
+	s.clock.Advance(time.Hour)
+	fired, err := s.runner(c).FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 2)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "RequestPayment", "CancelOrder", "CancelOrder"})
+}
+
+func (s *ProcessManagerSuite) TestFailingProcessDoesNotHoldUpTimeouts(c *C) {
+	runner := s.runner(c)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+	s.clock.Advance(time.Minute)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-2"})), IsNil)
+
+	// The cancellation of order-1 fails, order-2 is cancelled nonetheless.
+	s.commands.failures = 1
+	s.clock.Advance(time.Hour)
+	fired, err := runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, ErrorMatches, "dispatch failed")
+	c.Assert(fired, Equals, 1)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "RequestPayment", "CancelOrder"})
+	c.Assert(s.commands.commands[2].Command(), DeepEquals, &CancelOrder{OrderID: "order-2"})
+
+	// The next tick dispatches the cancellation of order-1 again.
+	fired, err = runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "RequestPayment", "CancelOrder", "CancelOrder"})
+	c.Assert(s.commands.commands[3].Command(), DeepEquals, &CancelOrder{OrderID: "order-1"})
+}
+
+func (s *ProcessManagerSuite) TestTimeoutsScheduledByOtherRunnersAreFired(c *C) {
+	runner := s.runner(c)
+	fired, err := runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+
+	c.Assert(s.runner(c).HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+
+	s.clock.Advance(time.Hour)
+	fired, err = runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 1)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment", "CancelOrder"})
+}
+
+func (s *ProcessManagerSuite) TestTimeoutScheduledOutOfOrderIsFired(c *C) {
+	if !s.sql {
+		c.Skip("appends to the in memory repository commit in position order")
+	}
+
+	s.gapTimeout = time.Hour
+	runner := s.runner(c)
+	c.Assert(s.runner(c).HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+	c.Assert(s.runner(c).HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-2"})), IsNil)
+
+	// The timeout of order-1 commits after the events of order-2.
+	evs, err := s.repo.Read(s.ctx).Stream(runner.StreamId("order-1")).Forward().ToList()
+	c.Assert(err, IsNil)
+	position := 0
+	for _, ev := range evs {
+		if ev.Event().Name() == NewTypedEvent(ProcessTimeoutScheduled{}).Name() {
+			position, _ = EventPosition(ev)
+		}
+	}
+	c.Assert(position, Not(Equals), 0)
+	commit := uncommitStreamEntry(c, s.repo, position)
+
+	s.clock.Advance(time.Hour)
+	fired, err := runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 0)
+
+	commit()
+
+	fired, err = runner.FireDueTimeouts(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(fired, Equals, 2)
+}
+
+func (s *ProcessManagerSuite) TestRebuildFailsOnUnhandledEvent(c *C) {
+	runner := s.runner(c)
+	c.Assert(runner.HandleEvent(s.ctx, newOrderEvent(OrderPlaced{OrderID: "order-1"})), IsNil)
+
+	evs, err := s.repo.Read(s.ctx).Stream(runner.StreamId("order-1")).Forward().ToList()
+	c.Assert(err, IsNil)
+	for i, ev := range evs {
+		evs[i], err = runner.decode(ev)
+		c.Assert(err, IsNil)
+	}
+
+	pm := newCheckoutProcess("order-1")
+	c.Assert(RebuildAggregate(pm, evs), IsNil)
+	c.Assert(pm.CurrentVersion(), Equals, len(evs))
+
+	unhandled := NewEventMessage(nil, NewTypedEvent(PaymentReceived{OrderID: "order-1"}), nil)
+	pm = newCheckoutProcess("order-1")
+	c.Assert(RebuildAggregate(pm, append(evs, unhandled)), FitsTypeOf, &ErrUnhandledEvent{})
+
+	pm.RebuildFromEvents([]EventMessage{unhandled})
+	c.Assert(pm.processManagerBase().rebuildError(), FitsTypeOf, &ErrUnhandledEvent{})
+}
+
+func (s *ProcessManagerSuite) TestNowIsUsedWithoutClock(c *C) {
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	runner, err := NewProcessManagerRunner("checkout", s.repo, NewInMemoryDispatcher(), newCheckoutProcess, ProcessManagerOptions{
+		Now: func() time.Time { return now },
+	})
+	c.Assert(err, IsNil)
+	c.Assert(runner.options.Clock.Now(), Equals, now)
+}
+
+func (s *ProcessManagerSuite) TestFailedDispatchIsRetriedWithSameCommandId(c *C) {
+	s.commands.failures = 1
+	placed := newOrderEvent(OrderPlaced{OrderID: "order-1"})
+
+	c.Assert(s.runner(c).HandleEvent(s.ctx, placed), ErrorMatches, "dispatch failed")
+	c.Assert(s.commands.names(), HasLen, 0)
+
+	// The event is delivered again to a restarted runner, the command is
+	// decoded from the stream and dispatched without handling the event again.
+	c.Assert(s.runner(c).HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+	c.Assert(s.commands.commands[0].Command(), DeepEquals, &RequestPayment{OrderID: "order-1"})
+
+	c.Assert(s.runner(c).HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+
+	pm, err := s.runner(c).Load(s.ctx, "order-1")
+	c.Assert(err, IsNil)
+	c.Assert(pm.(*checkoutProcess).Timeouts(), HasLen, 1)
+}
+
+func (s *ProcessManagerSuite) TestCommittedDispatchFailureIsNotDispatchedAgain(c *C) {
+	s.commands.failures = 1
+	s.commands.committed = true
+	placed := newOrderEvent(OrderPlaced{OrderID: "order-1"})
+
+	c.Assert(s.runner(c).HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+
+	c.Assert(s.runner(c).HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+
+	pm, err := s.runner(c).Load(s.ctx, "order-1")
+	c.Assert(err, IsNil)
+	c.Assert(pm.processManagerBase().pending, HasLen, 0)
+}
+
+func (s *ProcessManagerSuite) TestCommandsAreDeduplicatedDownstream(c *C) {
+	processed := NewInMemoryProcessedCommandStore()
+	placed := newOrderEvent(OrderPlaced{OrderID: "order-1"})
+
+	c.Assert(s.runner(c, DeduplicationMiddleware(processed, nil)).HandleEvent(s.ctx, placed), IsNil)
+
+	// The process is lost, as if the dispatch was not recorded, the same event
+	// issues the command with the same id and the command is dropped.
+	s.repo = s.openRepository(c)
+	c.Assert(s.runner(c, DeduplicationMiddleware(processed, nil)).HandleEvent(s.ctx, placed), IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+}
+
+func (s *ProcessManagerSuite) TestRunnerIsFedByProjectionRunner(c *C) {
+	runner := s.runner(c)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[OrderPlaced](factory), IsNil)
+	c.Assert(RegisterTypedEvent[PaymentReceived](factory), IsNil)
+	c.Assert(RegisterTypedEvent[CheckoutStarted](factory), IsNil)
+	c.Assert(RegisterTypedEvent[ProcessCommandIssued](factory), IsNil)
+	c.Assert(RegisterTypedEvent[ProcessCommandsDispatched](factory), IsNil)
+	c.Assert(RegisterTypedEvent[ProcessTimeoutScheduled](factory), IsNil)
+
+	projections, err := NewProjectionRunner(s.repo, NewInMemoryCheckpointStore(), runner, ProjectionRunnerOptions{EventFactory: factory})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.repo.Append(s.ctx, "order-1", []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(OrderPlaced{OrderID: "order-1"}), nil),
+	}, nil), IsNil)
+
+	_, err = projections.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+
+	// Running again projects the events of the process, which are ignored.
+	_, err = projections.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(s.commands.names(), DeepEquals, []string{"RequestPayment"})
+}
+
+func (s *ProcessManagerSuite) TestCorrelationMustBeUnique(c *C) {
+	runner := s.runner(c)
+	c.Assert(runner.StartedBy("OrderPlaced", func(EventMessage) string { return "" }), NotNil)
+}
+
+func (s *ProcessManagerSuite) TestDispatchOutsideOfHandle(c *C) {
+	p := newCheckoutProcess("order-1").(*checkoutProcess)
+	c.Assert(p.Dispatch(NewCommandMessage("order-1", &ShipOrder{})), NotNil)
+
+	_, err := p.ScheduleTimeout("payment", time.Hour)
+	c.Assert(err, NotNil)
+}
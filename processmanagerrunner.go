@@ -0,0 +1,627 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProcessTimeoutInterval = time.Second
+
+	// processTimeoutIndexPage is the number of events read at once when the
+	// events are scanned for the timeouts of the process managers.
+	processTimeoutIndexPage = 100
+)
+
+// ProcessManagerOptions configures a ProcessManagerRunner.
+type ProcessManagerOptions struct {
+	// EventFactory decodes the events raised by the process managers when they
+	// are loaded. The events recorded by ProcessManagerBase are decoded by the
+	// runner.
+	EventFactory EventFactory
+
+	// Upcasters bring the events raised by the process managers to their latest
+	// schema version before they are decoded by EventFactory.
+	Upcasters *UpcasterRegistry
+
+	// CommandFactory decodes the commands a process manager issued but did not
+	// dispatch before the process stopped, they are dispatched when the process
+	// is loaded again.
+	CommandFactory CommandFactory
+
+	// TimeoutInterval is the interval at which RunTimeouts fires the due
+	// timeouts. Defaults to one second.
+	TimeoutInterval time.Duration
+
+	// Clock tells the time timeouts are scheduled and fired against. Defaults
+	// to Now when it is set and to the SystemClock otherwise.
+	Clock Clock
+
+	// Now returns the current time timeouts are scheduled and fired against.
+	//
+	// Deprecated: Use Clock, Now is only used when Clock is nil.
+	Now func() time.Time
+
+	// GapTimeout is how long the timeout index waits for a missing position
+	// before it moves past it, see SubscriptionOptions.GapTimeout.
+	GapTimeout time.Duration
+
+	// Logger logs the timeouts RunTimeouts failed to fire and the commands
+	// that failed after their events were committed.
+	Logger Logger
+}
+
+// processRoute correlates the events with a name to process managers.
+type processRoute struct {
+	key    func(EventMessage) string
+	starts bool
+}
+
+// ProcessManagerRunner feeds events to the process managers they are correlated
+// with and dispatches the commands the process managers issue.
+//
+// Every process lives in the stream named after the runner and its
+// correlation key. The runner is an ErrorAwareEventHandler to be registered
+// with an EventBus, and a Projection to be fed by a ProjectionRunner from a
+// durable checkpoint.
+//
+// Commands are dispatched once the process that issued them was saved and are
+// dispatched again, with the same command id, until their dispatch was
+// recorded. An event that was handled already is not handled again, so with a
+// DeduplicationMiddleware in front of the command handlers every command of a
+// process is handled exactly once.
+//
+// Timeouts are fired by every runner that calls FireDueTimeouts or
+// RunTimeouts, from an index of the timeouts scheduled in the streams of the
+// process managers. A timeout fired by two runners at once is fired by one of
+// them only, the other fails to save the process with an
+// ErrConcurrencyViolation and leaves the timeout to the next tick.
+type ProcessManagerRunner struct {
+	name       string
+	repo       EventRepository
+	dispatcher Dispatcher
+	newProcess func(key string) ProcessManager
+	options    ProcessManagerOptions
+
+	mu     sync.RWMutex
+	routes map[string]processRoute
+
+	// locks serialises the handling of the events of a process.
+	locks *keyedLocks
+
+	// due holds the earliest due timeout of every process with pending
+	// timeouts, as far as the streams were scanned for them.
+	dueMu sync.Mutex
+	due   map[string]time.Time
+
+	// indexed is the position of the last event scanned for timeouts.
+	indexMu sync.Mutex
+	indexed int
+	reader  *positionReader
+}
+
+// NewProcessManagerRunner constructs a ProcessManagerRunner of the process
+// managers with the name, newProcess constructs a process manager from its
+// correlation key.
+func NewProcessManagerRunner(name string, repo EventRepository, dispatcher Dispatcher, newProcess func(key string) ProcessManager, options ProcessManagerOptions) (*ProcessManagerRunner, error) {
+	if name == "" {
+		return nil, fmt.Errorf("process manager requires a name")
+	}
+
+	if repo == nil {
+		return nil, fmt.Errorf("nil EventRepository injected into process manager")
+	}
+
+	if dispatcher == nil {
+		return nil, fmt.Errorf("nil Dispatcher injected into process manager")
+	}
+
+	if newProcess == nil {
+		return nil, fmt.Errorf("nil process constructor injected into process manager")
+	}
+
+	if options.TimeoutInterval <= 0 {
+		options.TimeoutInterval = defaultProcessTimeoutInterval
+	}
+
+	if options.Clock == nil && options.Now != nil {
+		options.Clock = clockFunc(options.Now)
+	}
+
+	if options.Clock == nil {
+		options.Clock = SystemClock()
+	}
+
+	return &ProcessManagerRunner{
+		name:       name,
+		repo:       repo,
+		dispatcher: dispatcher,
+		newProcess: newProcess,
+		options:    options,
+		routes:     make(map[string]processRoute),
+		locks:      newKeyedLocks(),
+		due:        make(map[string]time.Time),
+		reader:     newPositionReader(repo, options.GapTimeout),
+	}, nil
+}
+
+// StartedBy correlates the events with the name to the process with the key
+// returned by key, a process is started when none exists for the key. Events
+// for which key returns an empty string are ignored.
+func (r *ProcessManagerRunner) StartedBy(eventName string, key func(EventMessage) string) error {
+	return r.route(eventName, processRoute{key: key, starts: true})
+}
+
+// HandledBy correlates the events with the name to the process with the key
+// returned by key, events without a started process are ignored. Events for
+// which key returns an empty string are ignored.
+func (r *ProcessManagerRunner) HandledBy(eventName string, key func(EventMessage) string) error {
+	return r.route(eventName, processRoute{key: key})
+}
+
+func (r *ProcessManagerRunner) route(eventName string, route processRoute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.routes[eventName]; ok {
+		return fmt.Errorf("process manager %s already correlates event: %s", r.name, eventName)
+	}
+
+	r.routes[eventName] = route
+	return nil
+}
+
+// StreamId returns the id of the stream of the process with the key.
+func (r *ProcessManagerRunner) StreamId(key string) string {
+	return r.name + "-" + key
+}
+
+// Load returns the process with the key as it is persisted, a process that was
+// not started is at version 0.
+func (r *ProcessManagerRunner) Load(ctx context.Context, key string) (ProcessManager, error) {
+	return r.load(ctx, key)
+}
+
+// Handle handles the event, errors are dropped. See HandleEvent.
+func (r *ProcessManagerRunner) Handle(ctx context.Context, event EventMessage) {
+	_ = r.HandleEvent(ctx, event)
+}
+
+// HandleEvent feeds the event to the process it is correlated with and
+// dispatches the commands the process issued.
+//
+// Events that are not correlated, that were handled already or whose process
+// completed are ignored. The error of the process or of a dispatch is
+// returned, the event is meant to be delivered again then.
+func (r *ProcessManagerRunner) HandleEvent(ctx context.Context, event EventMessage) error {
+	r.mu.RLock()
+	route, ok := r.routes[event.Event().Name()]
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	key := route.key(event)
+	if key == "" {
+		return nil
+	}
+
+	release, err := r.locks.acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	pm, err := r.load(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if pm.OriginalVersion() == 0 && !route.starts {
+		return nil
+	}
+
+	// Commands left over by a failed dispatch go first.
+	if err := r.dispatchPending(ctx, pm); err != nil {
+		return err
+	}
+
+	base := pm.processManagerBase()
+	if base.completed {
+		return nil
+	}
+
+	if id := eventCausationId(event); id != "" && base.handled[id] {
+		return nil
+	}
+
+	return r.handle(ctx, pm, event)
+}
+
+// ProjectionName is the name of the checkpoint of the runner when it is fed by
+// a ProjectionRunner.
+func (r *ProcessManagerRunner) ProjectionName() string {
+	return "process_manager:" + r.name
+}
+
+// Project handles the event, see HandleEvent.
+func (r *ProcessManagerRunner) Project(ctx context.Context, event EventMessage) error {
+	return r.HandleEvent(ctx, event)
+}
+
+// FireDueTimeouts feeds the timeouts that are due to their processes and
+// returns how many were fired.
+//
+// The streams of the process managers are scanned for the timeouts scheduled
+// since the last call first. A process that fails to handle its timeouts does
+// not hold up the others, its timeouts stay due and are fired again by the
+// next call. The first error is returned once every due process was tried.
+func (r *ProcessManagerRunner) FireDueTimeouts(ctx context.Context) (int, error) {
+	if err := r.indexTimeouts(ctx); err != nil {
+		return 0, err
+	}
+
+	now := r.options.Clock.Now()
+
+	r.dueMu.Lock()
+	var keys []string
+	for key, due := range r.due {
+		if !due.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return r.due[keys[i]].Before(r.due[keys[j]])
+	})
+	r.dueMu.Unlock()
+
+	fired := 0
+	var firstErr error
+	for _, key := range keys {
+		n, err := r.fireTimeouts(ctx, key, now)
+		fired += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return fired, err
+			}
+
+			r.logf("process manager %s failed to fire the timeouts of process %s: %s", r.name, key, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return fired, firstErr
+}
+
+// RunTimeouts fires the due timeouts every TimeoutInterval until ctx is
+// cancelled.
+//
+// Errors are logged with the Logger and the timeouts are tried again on the
+// next tick. RunTimeouts returns nil once ctx is cancelled.
+func (r *ProcessManagerRunner) RunTimeouts(ctx context.Context) error {
+	for {
+		if _, err := r.FireDueTimeouts(ctx); err != nil && ctx.Err() == nil {
+			r.logf("process manager %s failed to fire timeouts: %s", r.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.options.TimeoutInterval):
+		}
+	}
+}
+
+func (r *ProcessManagerRunner) logf(format string, args ...interface{}) {
+	if r.options.Logger != nil {
+		r.options.Logger.Printf(format, args...)
+	}
+}
+
+func (r *ProcessManagerRunner) fireTimeouts(ctx context.Context, key string, now time.Time) (int, error) {
+	release, err := r.locks.acquire(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	pm, err := r.load(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.dispatchPending(ctx, pm); err != nil {
+		return 0, err
+	}
+
+	base := pm.processManagerBase()
+	fired := 0
+	for _, t := range base.Timeouts() {
+		if t.Due.After(now) || base.completed {
+			break
+		}
+
+		base.record(NewTypedEvent(ProcessTimeoutFired{
+			TimeoutID: t.TimeoutID,
+			Name:      t.Name,
+			Due:       t.Due,
+		}))
+
+		changes := pm.GetChanges()
+		event := changes[len(changes)-1]
+		if t.CorrelationID != "" {
+			event.SetHeader(HeaderCorrelationId, t.CorrelationID)
+		}
+
+		if err := r.handle(ctx, pm, event); err != nil {
+			return fired, err
+		}
+		fired++
+	}
+
+	r.track(key, base)
+	return fired, nil
+}
+
+// handle calls the process with the event, saves it and dispatches the commands
+// it issued.
+func (r *ProcessManagerRunner) handle(ctx context.Context, pm ProcessManager, event EventMessage) error {
+	base := pm.processManagerBase()
+	base.cause, base.commands = event, 0
+	err := pm.Handle(ctx, event)
+	base.cause = nil
+	if err != nil {
+		return err
+	}
+
+	if err := r.save(ctx, pm, event); err != nil {
+		return err
+	}
+
+	return r.dispatchPending(ctx, pm)
+}
+
+// load rebuilds the process with the key from its stream.
+func (r *ProcessManagerRunner) load(ctx context.Context, key string) (ProcessManager, error) {
+	pm := r.newProcess(key)
+	base := pm.processManagerBase()
+	base.streamId = r.StreamId(key)
+	base.now = r.options.Clock.Now
+
+	msgs, err := r.repo.Read(ctx).Stream(base.streamId).Forward().ToList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, em := range msgs {
+		event, err := r.decode(em)
+		if err != nil {
+			return nil, err
+		}
+
+		if !base.applyProcessEvent(event) {
+			if base.routesEvents() {
+				if err := base.ApplyEvent(event); err != nil {
+					return nil, err
+				}
+			} else {
+				pm.Apply(event)
+			}
+		}
+
+		if id := CausationId(event.GetHeaders()); id != "" {
+			base.handled[id] = true
+		}
+		pm.IncrementVersion()
+	}
+
+	return pm, nil
+}
+
+func (r *ProcessManagerRunner) decode(em EventMessage) (EventMessage, error) {
+	if processEventFactory.GetEvent(em.Event().Name()) != nil {
+		return decodeEvent(processEventFactory, nil, em)
+	}
+
+	if r.options.EventFactory == nil {
+		return em, nil
+	}
+
+	return decodeEvent(r.options.EventFactory, r.options.Upcasters, em)
+}
+
+// save appends the changes of the process to its stream, cause is the event
+// they were caused by, if any.
+func (r *ProcessManagerRunner) save(ctx context.Context, pm ProcessManager, cause EventMessage) error {
+	changes := pm.GetChanges()
+	if len(changes) == 0 {
+		return nil
+	}
+
+	base := pm.processManagerBase()
+	causationId := ""
+	if cause != nil {
+		causationId = eventCausationId(cause)
+	}
+
+	for _, change := range changes {
+		change.SetHeader(HeaderProcessManager, r.name)
+		if causationId != "" {
+			change.SetHeader(HeaderCausationId, causationId)
+		}
+		if cause != nil {
+			for _, key := range []string{HeaderCorrelationId, HeaderActor} {
+				setMissingHeader(change.GetHeaders(), change.SetHeader, key, cause.GetHeaders()[key])
+			}
+		}
+		stampEvent(ctx, change)
+		stampSchemaVersion(r.options.EventFactory, change.Event())
+	}
+
+	if err := r.repo.Append(ctx, base.streamId, changes, Int(pm.OriginalVersion())); err != nil {
+		if e, ok := err.(*ErrConcurrencyViolation); ok {
+			e.Aggregate = pm
+		}
+
+		return err
+	}
+
+	pm.setVersion(pm.CurrentVersion())
+	pm.ClearChanges()
+	if causationId != "" {
+		base.handled[causationId] = true
+	}
+	r.track(strings.TrimPrefix(base.streamId, r.StreamId("")), base)
+
+	return nil
+}
+
+// dispatchPending dispatches the commands the process issued that were not
+// dispatched yet and records their dispatch. A command failing with
+// ErrPublishFailed or ErrSnapshotFailed is recorded as dispatched, its events
+// were persisted.
+func (r *ProcessManagerRunner) dispatchPending(ctx context.Context, pm ProcessManager) error {
+	base := pm.processManagerBase()
+	if len(base.pending) == 0 {
+		return nil
+	}
+
+	// The dispatch is recorded with the correlation of the commands.
+	headers := base.pending[0].Headers
+
+	var dispatched []string
+	var dispatchErr error
+	for _, c := range base.pending {
+		command := c.message
+		if command == nil {
+			var err error
+			if command, err = r.commandMessage(c.ProcessCommandIssued); err != nil {
+				dispatchErr = err
+				break
+			}
+		}
+
+		if _, err := r.dispatcher.Dispatch(ctx, command); err != nil {
+			if !isCommittedError(err) {
+				dispatchErr = err
+				break
+			}
+
+			// The events of the command were persisted, dispatching it
+			// again would persist them twice.
+			r.logf("process manager %s command %s failed after its events were committed: %s", r.name, c.CommandID, err)
+		}
+		dispatched = append(dispatched, c.CommandID)
+	}
+
+	if len(dispatched) > 0 {
+		base.record(NewTypedEvent(ProcessCommandsDispatched{CommandIDs: dispatched}))
+
+		changes := pm.GetChanges()
+		marker := changes[len(changes)-1]
+		for _, key := range []string{HeaderCorrelationId, HeaderCausationId, HeaderActor} {
+			setMissingHeader(marker.GetHeaders(), marker.SetHeader, key, headers[key])
+		}
+
+		if err := r.save(ctx, pm, nil); err != nil && dispatchErr == nil {
+			dispatchErr = err
+		}
+	}
+
+	return dispatchErr
+}
+
+// commandMessage decodes a command issued by a process with the CommandFactory.
+func (r *ProcessManagerRunner) commandMessage(issued ProcessCommandIssued) (CommandMessage, error) {
+	if r.options.CommandFactory == nil {
+		return nil, fmt.Errorf("process manager %s requires a CommandFactory to dispatch command: %s", r.name, issued.CommandName)
+	}
+
+	command := r.options.CommandFactory.GetCommand(issued.CommandName)
+	if command == nil {
+		return nil, fmt.Errorf("no command registered with the factory for type: %s", issued.CommandName)
+	}
+
+	if err := json.Unmarshal(issued.Command, command); err != nil {
+		return nil, &ErrUnexpected{Err: err}
+	}
+
+	cm := NewCommandMessage(issued.AggregateID, command)
+	for k, v := range issued.Headers {
+		cm.SetHeader(k, v)
+	}
+
+	return cm, nil
+}
+
+// indexTimeouts scans the events appended since the last scan for the timeouts
+// scheduled by the process managers, one page at a time.
+//
+// The events are read in position order without moving past the positions of
+// appends that may still commit, see GapTimeout, so a timeout scheduled by a
+// transaction that commits late is not missed.
+func (r *ProcessManagerRunner) indexTimeouts(ctx context.Context) error {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	scheduled := NewTypedEvent(ProcessTimeoutScheduled{}).Name()
+	for {
+		evs, more, _, err := r.reader.read(ctx, r.indexed, processTimeoutIndexPage)
+		if err != nil {
+			return err
+		}
+
+		keys := make(map[string]bool)
+		position := r.indexed
+		for _, ev := range evs {
+			if name, _ := ev.GetHeaders()[HeaderProcessManager].(string); name == r.name && ev.Event().Name() == scheduled {
+				streamId, _ := EventStreamId(ev)
+				keys[strings.TrimPrefix(streamId, r.StreamId(""))] = true
+			}
+			position, _ = EventPosition(ev)
+		}
+
+		for key := range keys {
+			pm, err := r.load(ctx, key)
+			if err != nil {
+				return err
+			}
+			r.track(key, pm.processManagerBase())
+		}
+
+		// The page is indexed once its processes were tracked, a failed page is
+		// scanned again by the next call.
+		r.indexed = position
+		if !more {
+			return nil
+		}
+	}
+}
+
+// track records the earliest due timeout of the process. A process with
+// commands that were not dispatched is due at once, so that FireDueTimeouts
+// dispatches them again.
+func (r *ProcessManagerRunner) track(key string, base *ProcessManagerBase) {
+	r.dueMu.Lock()
+	defer r.dueMu.Unlock()
+
+	if len(base.pending) > 0 {
+		r.due[key] = time.Time{}
+		return
+	}
+
+	timeouts := base.Timeouts()
+	if len(timeouts) == 0 {
+		delete(r.due, key)
+		return
+	}
+
+	r.due[key] = timeouts[0].Due
+}
@@ -0,0 +1,317 @@
+package ycq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultProjectionBatchSize = 100
+
+// Projection builds a read model from the events of an EventRepository.
+//
+// A ProjectionRunner calls Project with every event of the global $all stream
+// in position order, the events already projected are remembered by the
+// checkpoint of the projection.
+type Projection interface {
+	// ProjectionName identifies the projection, it is the name of its checkpoint.
+	ProjectionName() string
+
+	// Project applies an event to the read model.
+	Project(ctx context.Context, event EventMessage) error
+}
+
+// SqlTx is the part of *sql.Tx a TransactionalProjection writes its read model
+// with.
+type SqlTx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TransactionalProjection is a Projection whose read model lives in the database
+// of the event store.
+//
+// When the checkpoints are stored in the same database, see
+// NewSqlCheckpointStore, the runner calls ProjectTx instead of Project and
+// commits the writes of the projection together with its checkpoint, so every
+// event is projected exactly once. Queries are written in the dialect and with
+// the placeholders of the database.
+type TransactionalProjection interface {
+	Projection
+
+	// ProjectTx applies an event to the read model within tx.
+	ProjectTx(ctx context.Context, tx SqlTx, event EventMessage) error
+}
+
+// CheckpointStore stores the position of the last event applied by every
+// projection.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the checkpoint of the projection, 0 when it has not
+	// projected any event yet.
+	LoadCheckpoint(ctx context.Context, name string) (int, error)
+
+	// SaveCheckpoint stores the checkpoint of the projection.
+	SaveCheckpoint(ctx context.Context, name string, position int) error
+}
+
+// transactionalCheckpointStore is implemented by checkpoint stores that can
+// save a checkpoint in the same transaction as the writes of a projection.
+type transactionalCheckpointStore interface {
+	saveCheckpointWith(ctx context.Context, name string, position int, write func(tx SqlTx) error) error
+}
+
+// InMemoryCheckpointStore is a CheckpointStore that keeps the checkpoints in
+// memory, it is meant for tests and read models that are rebuilt on start.
+type InMemoryCheckpointStore struct {
+	sync.RWMutex
+	checkpoints map[string]int
+}
+
+// NewInMemoryCheckpointStore constructs an empty InMemoryCheckpointStore.
+func NewInMemoryCheckpointStore() *InMemoryCheckpointStore {
+	return &InMemoryCheckpointStore{
+		checkpoints: make(map[string]int),
+	}
+}
+
+func (s *InMemoryCheckpointStore) LoadCheckpoint(ctx context.Context, name string) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.checkpoints[name], nil
+}
+
+func (s *InMemoryCheckpointStore) SaveCheckpoint(ctx context.Context, name string, position int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.checkpoints[name] = position
+	return nil
+}
+
+// ProjectionRunnerOptions configures a ProjectionRunner.
+type ProjectionRunnerOptions struct {
+	// BatchSize is the number of events read from the repository at once.
+	// Defaults to 100.
+	BatchSize int
+
+	// PollInterval is the interval at which Run polls the repository for events
+	// appended by other processes, see SubscriptionOptions. Defaults to one
+	// second.
+	PollInterval time.Duration
+
+	// GapTimeout is how long the runner waits for a missing position before
+	// it moves past it, see SubscriptionOptions.GapTimeout.
+	GapTimeout time.Duration
+
+	// EventFactory decodes the events into their registered types before they
+	// are projected. Without a factory events are projected as raw events.
+	EventFactory EventFactory
+
+	// Upcasters bring events to their latest schema version before they are
+	// decoded by EventFactory.
+	Upcasters *UpcasterRegistry
+}
+
+// ProjectionRunner feeds a Projection with the events of an EventRepository,
+// starting after its checkpoint.
+//
+// The checkpoint is saved after every projected event, a runner that restarts
+// resumes after the last saved checkpoint. A Projection whose event fails is
+// not saved past that event, so the event is projected again when the runner
+// restarts; projections that are not a TransactionalProjection should
+// therefore be idempotent.
+type ProjectionRunner struct {
+	repo        EventRepository
+	reader      *positionReader
+	checkpoints CheckpointStore
+	options     ProjectionRunnerOptions
+
+	// mu serialises the events projected by Run and RunPending with the swap
+	// of a rebuilt projection.
+	mu         sync.Mutex
+	projection Projection
+
+	// position is the checkpoint of the projection once loaded, events at or
+	// before it are skipped.
+	position int
+	loaded   bool
+}
+
+// NewProjectionRunner constructs a ProjectionRunner of the projection over the
+// events of repo.
+func NewProjectionRunner(repo EventRepository, checkpoints CheckpointStore, projection Projection, options ProjectionRunnerOptions) (*ProjectionRunner, error) {
+	if repo == nil {
+		return nil, fmt.Errorf("nil EventRepository injected into projection runner")
+	}
+
+	if checkpoints == nil {
+		return nil, fmt.Errorf("nil CheckpointStore injected into projection runner")
+	}
+
+	if projection == nil {
+		return nil, fmt.Errorf("nil Projection injected into projection runner")
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultProjectionBatchSize
+	}
+
+	return &ProjectionRunner{
+		repo:        repo,
+		reader:      newPositionReader(repo, options.GapTimeout),
+		checkpoints: checkpoints,
+		projection:  projection,
+		options:     options,
+	}, nil
+}
+
+// Projection returns the projection fed by the runner, it is the rebuilt
+// projection once a Rebuild swapped it in.
+func (r *ProjectionRunner) Projection() Projection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.projection
+}
+
+// Position returns the checkpoint of the projection, the position of the last
+// projected event.
+func (r *ProjectionRunner) Position(ctx context.Context) (int, error) {
+	return r.checkpoints.LoadCheckpoint(ctx, r.Projection().ProjectionName())
+}
+
+// RunPending projects the events appended after the checkpoint and returns how
+// many were projected.
+//
+// Events after a position that may still commit are left for a later call,
+// see GapTimeout.
+func (r *ProjectionRunner) RunPending(ctx context.Context) (int, error) {
+	position, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	projected := 0
+	for {
+		evs, more, _, err := r.reader.read(ctx, position, r.options.BatchSize)
+		if err != nil {
+			return projected, err
+		}
+
+		for _, ev := range evs {
+			ok, err := r.project(ctx, ev)
+			if err != nil {
+				return projected, err
+			}
+
+			if ok {
+				projected++
+			}
+			position, _ = EventPosition(ev)
+		}
+
+		if !more {
+			return projected, nil
+		}
+	}
+}
+
+// Run projects the events after the checkpoint, then keeps projecting events as
+// they are appended until ctx is cancelled or the projection fails.
+//
+// Run returns nil when ctx is cancelled and the error otherwise.
+func (r *ProjectionRunner) Run(ctx context.Context) error {
+	position, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	options := SubscriptionOptions{
+		FromPosition: position,
+		PageSize:     r.options.BatchSize,
+		PollInterval: r.options.PollInterval,
+		GapTimeout:   r.options.GapTimeout,
+	}
+
+	err = SubscribeFunc(ctx, r.repo, options, func(ctx context.Context, ev EventMessage) error {
+		_, err := r.project(ctx, ev)
+		return err
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// load reads the checkpoint of the projection the first time it is needed.
+func (r *ProjectionRunner) load(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loaded {
+		return r.position, nil
+	}
+
+	position, err := r.checkpoints.LoadCheckpoint(ctx, r.projection.ProjectionName())
+	if err != nil {
+		return 0, err
+	}
+
+	r.position, r.loaded = position, true
+	return position, nil
+}
+
+// project applies the event to the projection of the runner unless it was
+// projected already, and reports whether it was applied.
+func (r *ProjectionRunner) project(ctx context.Context, ev EventMessage) (bool, error) {
+	position, ok := EventPosition(ev)
+	if !ok {
+		return false, fmt.Errorf("projected event %s has no position", ev.Event().Name())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if position <= r.position {
+		return false, nil
+	}
+
+	if err := r.projectInto(ctx, r.projection, r.projection.ProjectionName(), position, ev); err != nil {
+		return false, err
+	}
+
+	r.position = position
+	return true, nil
+}
+
+// projectInto applies the event to the projection and saves its position as
+// the checkpoint with the name, in one transaction when the projection and the
+// checkpoint store support it.
+func (r *ProjectionRunner) projectInto(ctx context.Context, projection Projection, name string, position int, ev EventMessage) error {
+	if r.options.EventFactory != nil {
+		decoded, err := decodeEvent(r.options.EventFactory, r.options.Upcasters, ev)
+		if err != nil {
+			return err
+		}
+		ev = decoded
+	}
+
+	if tp, ok := projection.(TransactionalProjection); ok {
+		if store, ok := r.checkpoints.(transactionalCheckpointStore); ok {
+			return store.saveCheckpointWith(ctx, name, position, func(tx SqlTx) error {
+				return tp.ProjectTx(ctx, tx, ev)
+			})
+		}
+	}
+
+	if err := projection.Project(ctx, ev); err != nil {
+		return err
+	}
+
+	return r.checkpoints.SaveCheckpoint(ctx, name, position)
+}
@@ -0,0 +1,319 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = suiteForEveryRepository(func(fixture repositoryFixture) interface{} {
+	return &ProjectionRunnerSuite{repositoryFixture: fixture}
+})
+
+// ProjectionRunnerSuite runs against every EventRepository and CheckpointStore
+// implementation.
+type ProjectionRunnerSuite struct {
+	repositoryFixture
+	eventRepo   EventRepository
+	checkpoints CheckpointStore
+	factory     *DelegateEventFactory
+	ctx         context.Context
+}
+
+func (s *ProjectionRunnerSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	s.eventRepo = s.openRepository(c)
+
+	s.checkpoints = NewInMemoryCheckpointStore()
+	if s.sql {
+		var err error
+		s.checkpoints, err = NewSqlCheckpointStore(s.eventRepo)
+		c.Assert(err, IsNil)
+	}
+
+	s.factory = NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](s.factory), IsNil)
+}
+
+func (s *ProjectionRunnerSuite) runner(c *C, projection Projection) *ProjectionRunner {
+	runner, err := NewProjectionRunner(s.eventRepo, s.checkpoints, projection, ProjectionRunnerOptions{
+		BatchSize:    2,
+		PollInterval: time.Hour,
+		EventFactory: s.factory,
+	})
+	c.Assert(err, IsNil)
+
+	return runner
+}
+
+func (s *ProjectionRunnerSuite) append(c *C, items ...string) {
+	evs := make([]EventMessage, len(items))
+	for i, item := range items {
+		evs[i] = NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: item, Count: 1}), nil)
+	}
+
+	c.Assert(s.eventRepo.Append(s.ctx, NewUUID(), evs, nil), IsNil)
+}
+
+func (s *ProjectionRunnerSuite) TestRunPendingProjectsEventsInOrder(c *C) {
+	s.append(c, "a", "b", "a")
+	s.append(c, "c")
+
+	projection := newItemCountProjection()
+	runner := s.runner(c, projection)
+
+	n, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 4)
+	c.Assert(projection.items(), DeepEquals, []string{"a", "b", "a", "c"})
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 4)
+}
+
+func (s *ProjectionRunnerSuite) TestRunnerResumesAfterCheckpoint(c *C) {
+	s.append(c, "a", "b")
+
+	n, err := s.runner(c, newItemCountProjection()).RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	s.append(c, "c")
+
+	// A new runner over the same checkpoints, as after a restart.
+	projection := newItemCountProjection()
+	n, err = s.runner(c, projection).RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(projection.items(), DeepEquals, []string{"c"})
+}
+
+func (s *ProjectionRunnerSuite) TestFailedEventIsProjectedAgain(c *C) {
+	s.append(c, "a", "b", "c")
+
+	projection := newItemCountProjection()
+	projection.failOn = "b"
+	runner := s.runner(c, projection)
+
+	n, err := runner.RunPending(s.ctx)
+	c.Assert(err, ErrorMatches, "b failed")
+	c.Assert(n, Equals, 1)
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 1)
+
+	projection.failOn = ""
+	n, err = runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(projection.items(), DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *ProjectionRunnerSuite) TestEventsCommittedOutOfOrderAreNotSkipped(c *C) {
+	if _, ok := s.eventRepo.(*sqlEventRepository); !ok {
+		c.Skip("appends to the in memory repository commit in position order")
+	}
+
+	s.append(c, "a")
+	s.append(c, "b")
+	commit := uncommitStreamEntry(c, s.eventRepo, 1)
+
+	projection := newItemCountProjection()
+	runner, err := NewProjectionRunner(s.eventRepo, s.checkpoints, projection, ProjectionRunnerOptions{
+		EventFactory: s.factory,
+		GapTimeout:   time.Hour,
+	})
+	c.Assert(err, IsNil)
+
+	n, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 0)
+
+	commit()
+
+	n, err = runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(projection.items(), DeepEquals, []string{"a", "b"})
+}
+
+func (s *ProjectionRunnerSuite) TestRunProjectsNewEvents(c *C) {
+	s.append(c, "a")
+
+	projection := newItemCountProjection()
+	runner := s.runner(c, projection)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	s.append(c, "b", "c")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(projection.items()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(projection.items(), DeepEquals, []string{"a", "b", "c"})
+
+	cancel()
+	c.Assert(<-done, IsNil)
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 3)
+}
+
+func (s *ProjectionRunnerSuite) TestRunReturnsProjectionError(c *C) {
+	s.append(c, "a")
+
+	projection := newItemCountProjection()
+	projection.failOn = "a"
+
+	c.Assert(s.runner(c, projection).Run(s.ctx), ErrorMatches, "a failed")
+}
+
+// itemCountProjection records the items of the projected ItemAdded events.
+type itemCountProjection struct {
+	mu        sync.Mutex
+	projected []string
+	failOn    string
+}
+
+func newItemCountProjection() *itemCountProjection {
+	return &itemCountProjection{}
+}
+
+func (p *itemCountProjection) ProjectionName() string {
+	return "item_counts"
+}
+
+func (p *itemCountProjection) Project(ctx context.Context, event EventMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item := event.Event().(*TypedEvent[ItemAdded]).Payload().Item
+	if item == p.failOn {
+		return fmt.Errorf("%s failed", item)
+	}
+
+	p.projected = append(p.projected, item)
+	return nil
+}
+
+func (p *itemCountProjection) items() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.projected...)
+}
+
+var _ = Suite(&TransactionalProjectionSuite{})
+
+type TransactionalProjectionSuite struct {
+	eventRepo   EventRepository
+	checkpoints CheckpointStore
+	ctx         context.Context
+}
+
+func (s *TransactionalProjectionSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+
+	var err error
+	s.eventRepo, err = NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	s.checkpoints, err = NewSqlCheckpointStore(s.eventRepo)
+	c.Assert(err, IsNil)
+
+	err = s.eventRepo.(*sqlEventRepository).db.GetDB().Exec("CREATE TABLE item_counts (item varchar(255) primary key, count integer not null)").Error
+	c.Assert(err, IsNil)
+}
+
+func (s *TransactionalProjectionSuite) count(c *C, item string) int {
+	var count int
+	err := s.eventRepo.(*sqlEventRepository).db.GetDB().Raw("SELECT count FROM item_counts WHERE item = ?", item).Scan(&count).Error
+	c.Assert(err, IsNil)
+
+	return count
+}
+
+func (s *TransactionalProjectionSuite) TestReadModelAndCheckpointAreCommittedTogether(c *C) {
+	evs := []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "a", Count: 2}), nil),
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "b", Count: 1}), nil),
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "a", Count: 3}), nil),
+	}
+	c.Assert(s.eventRepo.Append(s.ctx, NewUUID(), evs, nil), IsNil)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+
+	projection := &sqlItemCountProjection{failOn: "b"}
+	runner, err := NewProjectionRunner(s.eventRepo, s.checkpoints, projection, ProjectionRunnerOptions{EventFactory: factory})
+	c.Assert(err, IsNil)
+
+	// The failed event rolls back its writes and leaves the checkpoint on the
+	// last projected event.
+	_, err = runner.RunPending(s.ctx)
+	c.Assert(err, ErrorMatches, "b failed")
+	c.Assert(s.count(c, "a"), Equals, 2)
+	c.Assert(s.count(c, "b"), Equals, 0)
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 1)
+
+	projection.failOn = ""
+	n, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(s.count(c, "a"), Equals, 5)
+	c.Assert(s.count(c, "b"), Equals, 1)
+
+	position, err = runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 3)
+}
+
+func (s *TransactionalProjectionSuite) TestCheckpointStoreRequiresSqlRepository(c *C) {
+	_, err := NewSqlCheckpointStore(NewInMemoryEventRepository())
+	c.Assert(err, NotNil)
+}
+
+// sqlItemCountProjection counts the items of the ItemAdded events in the
+// item_counts table.
+type sqlItemCountProjection struct {
+	failOn string
+}
+
+func (p *sqlItemCountProjection) ProjectionName() string {
+	return "sql_item_counts"
+}
+
+func (p *sqlItemCountProjection) Project(ctx context.Context, event EventMessage) error {
+	return fmt.Errorf("projected outside of a transaction")
+}
+
+func (p *sqlItemCountProjection) ProjectTx(ctx context.Context, tx SqlTx, event EventMessage) error {
+	added := event.Event().(*TypedEvent[ItemAdded]).Payload()
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO item_counts (item, count) VALUES (?, ?) ON CONFLICT (item) DO UPDATE SET count = count + excluded.count", added.Item, added.Count)
+	if err != nil {
+		return err
+	}
+
+	if added.Item == p.failOn {
+		return fmt.Errorf("%s failed", added.Item)
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package ycq
+
+import (
+	"context"
+	"strings"
+)
+
+// rebuildCheckpointSuffix is appended to the name of a projection to name the
+// checkpoint of its rebuild.
+const rebuildCheckpointSuffix = ":rebuild"
+
+// ProjectionResetter is implemented by projections that can clear their read
+// model, Rebuild resets them before the history is replayed.
+type ProjectionResetter interface {
+	Reset(ctx context.Context) error
+}
+
+// RebuildProgress reports the progress of a Rebuild after every batch.
+type RebuildProgress struct {
+	// Position is the position of the last replayed event.
+	Position int
+
+	// Head is the position of the last event in the repository.
+	Head int
+
+	// Replayed is the number of events applied to the projection, events
+	// skipped by the filters of the rebuild are not counted.
+	Replayed int
+
+	// Swapped is set on the last report, once the rebuilt projection replaced
+	// the live one.
+	Swapped bool
+}
+
+// RebuildOptions configures a Rebuild.
+type RebuildOptions struct {
+	// BatchSize is the number of events read from the repository at once.
+	// Defaults to the batch size of the runner.
+	BatchSize int
+
+	// EventNames restricts the replay to the events with these names.
+	EventNames []string
+
+	// StreamPrefix restricts the replay to the events of the streams whose id
+	// starts with the prefix.
+	StreamPrefix string
+
+	// Progress is called after every replayed batch.
+	Progress func(RebuildProgress)
+
+	// OnSwap is called when the rebuilt projection caught up, right before it
+	// replaces the live projection. No event is projected while OnSwap runs,
+	// it is where queries are switched to the rebuilt read model. An error
+	// aborts the swap.
+	OnSwap func(ctx context.Context) error
+}
+
+// Rebuild replays the whole history of the repository into projection and
+// swaps it in for the projection of the runner once it caught up.
+//
+// The projection is reset first when it is a ProjectionResetter. The live
+// projection keeps being fed by Run while the history is replayed, so
+// projection should write to its own read model, e.g. a new table, to keep the
+// live read model serving. Once the replay reached the head of the repository
+// the runner stops projecting, the events appended meanwhile are replayed, the
+// checkpoint of projection is saved and the runner continues with projection.
+//
+// The filters of the options only apply to the replay, the runner feeds every
+// event to the projection once it is swapped in. A failed rebuild leaves the
+// live projection in place.
+func (r *ProjectionRunner) Rebuild(ctx context.Context, projection Projection, options RebuildOptions) error {
+	if options.BatchSize <= 0 {
+		options.BatchSize = r.options.BatchSize
+	}
+
+	if resetter, ok := projection.(ProjectionResetter); ok {
+		if err := resetter.Reset(ctx); err != nil {
+			return err
+		}
+	}
+
+	name := projection.ProjectionName() + rebuildCheckpointSuffix
+	if err := r.checkpoints.SaveCheckpoint(ctx, name, 0); err != nil {
+		return err
+	}
+
+	progress := RebuildProgress{}
+	reader := newPositionReader(r.repo, r.options.GapTimeout)
+
+	// Catch up without holding up the live projection.
+	if err := r.replay(ctx, reader, projection, name, &progress, options); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Replay what was appended since, the live projection waits. Events
+	// held back behind a gap are left to the live runner.
+	if err := r.replay(ctx, reader, projection, name, &progress, options); err != nil {
+		return err
+	}
+
+	if options.OnSwap != nil {
+		if err := options.OnSwap(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := r.checkpoints.SaveCheckpoint(ctx, projection.ProjectionName(), progress.Position); err != nil {
+		return err
+	}
+
+	r.projection = projection
+	r.position, r.loaded = progress.Position, true
+
+	if options.Progress != nil {
+		progress.Swapped = true
+		options.Progress(progress)
+	}
+
+	return nil
+}
+
+// replay applies the events after the position of the progress to the
+// projection until the head of the repository, or a gap, is reached.
+func (r *ProjectionRunner) replay(ctx context.Context, reader *positionReader, projection Projection, name string, progress *RebuildProgress, options RebuildOptions) error {
+	for {
+		evs, more, _, err := reader.read(ctx, progress.Position, options.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range evs {
+			position, _ := EventPosition(ev)
+			if rebuildIncludes(ev, options) {
+				if err := r.projectInto(ctx, projection, name, position, ev); err != nil {
+					return err
+				}
+				progress.Replayed++
+			}
+			progress.Position = position
+		}
+
+		if options.Progress != nil && len(evs) > 0 {
+			progress.Head = progress.Position
+			if head, err := r.head(ctx); err == nil && head > progress.Head {
+				progress.Head = head
+			}
+			options.Progress(*progress)
+		}
+
+		if !more {
+			return nil
+		}
+	}
+}
+
+// head returns the position of the last event in the repository.
+func (r *ProjectionRunner) head(ctx context.Context) (int, error) {
+	evs, err := r.repo.Read(ctx).Backward().Limit(1).ToList()
+	if err != nil || len(evs) == 0 {
+		return 0, err
+	}
+
+	position, _ := EventPosition(evs[0])
+	return position, nil
+}
+
+// rebuildIncludes reports whether the event passes the filters of the rebuild.
+func rebuildIncludes(ev EventMessage, options RebuildOptions) bool {
+	if options.StreamPrefix != "" {
+		streamId, _ := EventStreamId(ev)
+		if !strings.HasPrefix(streamId, options.StreamPrefix) {
+			return false
+		}
+	}
+
+	if len(options.EventNames) == 0 {
+		return true
+	}
+
+	for _, name := range options.EventNames {
+		if ev.Event().Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
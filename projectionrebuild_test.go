@@ -0,0 +1,166 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// resettableItemProjection is an itemCountProjection that clears its items on
+// Reset.
+type resettableItemProjection struct {
+	*itemCountProjection
+	resets int
+}
+
+func newResettableItemProjection() *resettableItemProjection {
+	p := &resettableItemProjection{itemCountProjection: newItemCountProjection()}
+	p.projected = []string{"stale"}
+	return p
+}
+
+func (p *resettableItemProjection) Reset(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resets++
+	p.projected = nil
+	return nil
+}
+
+func (s *ProjectionRunnerSuite) TestRebuildReplaysHistoryAndSwaps(c *C) {
+	s.append(c, "a", "b", "c")
+
+	live := newItemCountProjection()
+	runner := s.runner(c, live)
+	_, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+
+	rebuilt := newResettableItemProjection()
+	c.Assert(runner.Rebuild(s.ctx, rebuilt, RebuildOptions{}), IsNil)
+	c.Assert(rebuilt.resets, Equals, 1)
+	c.Assert(rebuilt.items(), DeepEquals, []string{"a", "b", "c"})
+	c.Assert(runner.Projection(), Equals, rebuilt)
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 3)
+
+	s.append(c, "d")
+	n, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(rebuilt.items(), DeepEquals, []string{"a", "b", "c", "d"})
+	c.Assert(live.items(), DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *ProjectionRunnerSuite) TestRebuildFiltersEvents(c *C) {
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](s.factory, "ItemRemoved"), IsNil)
+
+	evs := []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "a"}), nil),
+		NewEventMessage(nil, NewNamedTypedEvent("ItemRemoved", ItemAdded{Item: "b"}), nil),
+	}
+	c.Assert(s.eventRepo.Append(s.ctx, "items-1", evs, nil), IsNil)
+	c.Assert(s.eventRepo.Append(s.ctx, "orders-1", []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "c"}), nil),
+	}, nil), IsNil)
+	c.Assert(s.eventRepo.Append(s.ctx, "items-2", []EventMessage{
+		NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "d"}), nil),
+	}, nil), IsNil)
+
+	runner := s.runner(c, newItemCountProjection())
+	rebuilt := newItemCountProjection()
+	err := runner.Rebuild(s.ctx, rebuilt, RebuildOptions{
+		EventNames:   []string{"ItemAdded"},
+		StreamPrefix: "items-",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(rebuilt.items(), DeepEquals, []string{"a", "d"})
+
+	position, err := runner.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 4)
+}
+
+func (s *ProjectionRunnerSuite) TestRebuildReportsProgress(c *C) {
+	s.append(c, "a", "b", "c", "d", "e")
+
+	var reports []RebuildProgress
+	runner := s.runner(c, newItemCountProjection())
+	err := runner.Rebuild(s.ctx, newItemCountProjection(), RebuildOptions{
+		Progress: func(p RebuildProgress) { reports = append(reports, p) },
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(reports, DeepEquals, []RebuildProgress{
+		{Position: 2, Head: 5, Replayed: 2},
+		{Position: 4, Head: 5, Replayed: 4},
+		{Position: 5, Head: 5, Replayed: 5},
+		{Position: 5, Head: 5, Replayed: 5, Swapped: true},
+	})
+}
+
+func (s *ProjectionRunnerSuite) TestFailedRebuildKeepsLiveProjection(c *C) {
+	s.append(c, "a", "b")
+
+	live := newItemCountProjection()
+	runner := s.runner(c, live)
+	_, err := runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+
+	rebuilt := newItemCountProjection()
+	rebuilt.failOn = "b"
+	c.Assert(runner.Rebuild(s.ctx, rebuilt, RebuildOptions{}), ErrorMatches, "b failed")
+	c.Assert(runner.Projection(), Equals, live)
+
+	err = runner.Rebuild(s.ctx, newItemCountProjection(), RebuildOptions{
+		OnSwap: func(ctx context.Context) error { return fmt.Errorf("swap refused") },
+	})
+	c.Assert(err, ErrorMatches, "swap refused")
+	c.Assert(runner.Projection(), Equals, live)
+
+	s.append(c, "c")
+	_, err = runner.RunPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(live.items(), DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *ProjectionRunnerSuite) TestRebuildWhileRunning(c *C) {
+	s.append(c, "a", "b", "c")
+
+	live := newItemCountProjection()
+	runner := s.runner(c, live)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	rebuilt := newItemCountProjection()
+	swapped := false
+	err := runner.Rebuild(s.ctx, rebuilt, RebuildOptions{
+		OnSwap: func(ctx context.Context) error {
+			swapped = true
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(swapped, Equals, true)
+
+	s.append(c, "d", "e")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rebuilt.items()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(rebuilt.items(), DeepEquals, []string{"a", "b", "c", "d", "e"})
+
+	cancel()
+	c.Assert(<-done, IsNil)
+
+	for _, item := range live.items() {
+		c.Assert(item, Not(Matches), "d|e")
+	}
+}
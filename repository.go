@@ -116,6 +116,13 @@ func (r *EventStoreDomainRepo) Load(ctx context.Context, streamId string, aggreg
 		for k, v := range meta {
 			em.SetHeader(k, v)
 		}
+		if r, ok := aggregateRoot.(eventRouter); ok && r.routesEvents() {
+			if err := r.Rebuild([]EventMessage{em}); err != nil {
+				return err
+			}
+			continue
+		}
+
 		aggregateRoot.Apply(em)
 		aggregateRoot.IncrementVersion()
 	}
@@ -139,6 +146,7 @@ func (r *EventStoreDomainRepo) Save(ctx context.Context, streamId string, aggreg
 		for k, v := range resultEvents {
 			//TODO: There is no test for this code
 			v.SetHeader("AggregateID", aggregate.AggregateID())
+			stampEvent(ctx, v)
 			evs[k] = goes.NewEvent("", v.Event().Name(), v.Event(), v.GetHeaders())
 		}
 
@@ -160,14 +168,17 @@ func (r *EventStoreDomainRepo) Save(ctx context.Context, streamId string, aggreg
 
 	aggregate.ClearChanges()
 
+	var publishErr error
 	for k, v := range resultEvents {
-		if expectedVersion == nil {
-			r.eventBus.PublishEvent(v)
-		} else {
-			em := NewEventMessage(v.EventID(), v.Event(), Int(*expectedVersion+k+1))
-			r.eventBus.PublishEvent(em)
+		em := v
+		if expectedVersion != nil {
+			em = NewEventMessage(v.EventID(), v.Event(), Int(*expectedVersion+k+1))
+		}
+
+		if err := r.eventBus.PublishEvent(ctx, em); err != nil && publishErr == nil {
+			publishErr = err
 		}
 	}
 
-	return nil
+	return publishErr
 }
@@ -0,0 +1,117 @@
+package ycq
+
+import (
+	"context"
+	"sync"
+)
+
+// Snapshotter is the interface an aggregate implements to opt into snapshots.
+//
+// A snapshot holds the state of the aggregate at a version so that loading the
+// aggregate only has to replay the events appended after that version.
+type Snapshotter interface {
+	// MarshalSnapshot returns the serialised state of the aggregate.
+	MarshalSnapshot() (string, error)
+
+	// UnmarshalSnapshot restores the state of the aggregate from a snapshot
+	// returned by MarshalSnapshot.
+	UnmarshalSnapshot(rawString string) error
+}
+
+// Snapshot is the persisted state of an aggregate at a version of its stream.
+type Snapshot struct {
+	StreamId string
+	Version  int
+	Data     string
+}
+
+// SnapshotStore is the interface a snapshot store must implement.
+type SnapshotStore interface {
+	// SaveSnapshot persists the snapshot.
+	SaveSnapshot(ctx context.Context, snapshot *Snapshot) error
+
+	// LoadSnapshot returns the latest snapshot of the stream or nil if the
+	// stream has no snapshot.
+	LoadSnapshot(ctx context.Context, streamId string) (*Snapshot, error)
+}
+
+// SnapshotPolicy decides whether a snapshot is taken after an aggregate was saved.
+//
+// previousVersion is the version of the aggregate before the save and
+// currentVersion the version after the save.
+type SnapshotPolicy func(aggregate AggregateRoot, previousVersion, currentVersion int) bool
+
+// SnapshotEvery returns a SnapshotPolicy that takes a snapshot every time the
+// version of the aggregate passes a multiple of n.
+func SnapshotEvery(n int) SnapshotPolicy {
+	return func(aggregate AggregateRoot, previousVersion, currentVersion int) bool {
+		if n <= 0 {
+			return false
+		}
+
+		return currentVersion/n > previousVersion/n
+	}
+}
+
+// SnapshotOnDemand returns a SnapshotPolicy that never takes snapshots on save,
+// snapshots are only taken by calling TakeSnapshot on the repository.
+func SnapshotOnDemand() SnapshotPolicy {
+	return func(aggregate AggregateRoot, previousVersion, currentVersion int) bool {
+		return false
+	}
+}
+
+// SnapshotRepository is implemented by domain repositories that can restore
+// aggregates from snapshots.
+type SnapshotRepository interface {
+	// SetSnapshotStore sets the store snapshots are saved to and loaded from and
+	// the policy deciding when snapshots are taken on save.
+	SetSnapshotStore(store SnapshotStore, policy SnapshotPolicy)
+
+	// TakeSnapshot saves a snapshot of the aggregate at its current version.
+	TakeSnapshot(ctx context.Context, streamId string, aggregate AggregateRoot) error
+
+	// OnSnapshotError sets the function the snapshots that could not be taken
+	// on save are reported to, the save itself succeeds.
+	OnSnapshotError(handler func(ctx context.Context, err *ErrSnapshotFailed))
+}
+
+// InMemorySnapshotStore keeps the latest snapshot of every stream in memory.
+type InMemorySnapshotStore struct {
+	sync.RWMutex
+	snapshots map[string]Snapshot
+}
+
+// NewInMemorySnapshotStore constructs a new InMemorySnapshotStore
+func NewInMemorySnapshotStore() *InMemorySnapshotStore {
+	return &InMemorySnapshotStore{
+		snapshots: make(map[string]Snapshot),
+	}
+}
+
+// SaveSnapshot stores the snapshot unless a snapshot of a later version is
+// already stored for the stream.
+func (s *InMemorySnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if current, ok := s.snapshots[snapshot.StreamId]; ok && current.Version >= snapshot.Version {
+		return nil
+	}
+	s.snapshots[snapshot.StreamId] = *snapshot
+
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot of the stream or nil if there is none.
+func (s *InMemorySnapshotStore) LoadSnapshot(ctx context.Context, streamId string) (*Snapshot, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	snapshot, ok := s.snapshots[streamId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &snapshot, nil
+}
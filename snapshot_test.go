@@ -0,0 +1,78 @@
+package ycq
+
+import (
+	"context"
+	"strconv"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SnapshotSuite{})
+
+type SnapshotSuite struct{}
+
+func (s *SnapshotSuite) TestSnapshotEvery(c *C) {
+	policy := SnapshotEvery(10)
+
+	c.Assert(policy(nil, 0, 9), Equals, false)
+	c.Assert(policy(nil, 9, 10), Equals, true)
+	c.Assert(policy(nil, 8, 12), Equals, true)
+	c.Assert(policy(nil, 10, 19), Equals, false)
+	c.Assert(SnapshotEvery(0)(nil, 0, 100), Equals, false)
+}
+
+func (s *SnapshotSuite) TestSnapshotOnDemand(c *C) {
+	c.Assert(SnapshotOnDemand()(nil, 0, 100), Equals, false)
+}
+
+func (s *SnapshotSuite) TestInMemorySnapshotStoreKeepsLatest(c *C) {
+	store := NewInMemorySnapshotStore()
+	ctx := context.Background()
+
+	snapshot, err := store.LoadSnapshot(ctx, "stream")
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, IsNil)
+
+	c.Assert(store.SaveSnapshot(ctx, &Snapshot{StreamId: "stream", Version: 5, Data: "5"}), IsNil)
+	c.Assert(store.SaveSnapshot(ctx, &Snapshot{StreamId: "stream", Version: 3, Data: "3"}), IsNil)
+
+	snapshot, err = store.LoadSnapshot(ctx, "stream")
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, DeepEquals, &Snapshot{StreamId: "stream", Version: 5, Data: "5"})
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// Fakes
+
+func NewCountingAggregate(id string) *CountingAggregate {
+	return &CountingAggregate{
+		RebuildableAggregate: NewRebuildableAggregate(id),
+	}
+}
+
+// CountingAggregate counts the events applied to it and supports snapshots.
+type CountingAggregate struct {
+	*RebuildableAggregate
+	count int
+}
+
+func (t *CountingAggregate) Apply(event EventMessage) {
+	t.RebuildableAggregate.Apply(event)
+	t.count++
+}
+
+func (t *CountingAggregate) RebuildFromEvents(events []EventMessage) {
+	for _, e := range events {
+		t.Apply(e)
+		t.IncrementVersion()
+	}
+}
+
+func (t *CountingAggregate) MarshalSnapshot() (string, error) {
+	return strconv.Itoa(t.count), nil
+}
+
+func (t *CountingAggregate) UnmarshalSnapshot(raw string) (err error) {
+	t.count, err = strconv.Atoi(raw)
+	return err
+}
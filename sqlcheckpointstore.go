@@ -0,0 +1,91 @@
+package ycq
+
+import (
+	"context"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type sqlCheckpointStore struct {
+	db orm.DB
+}
+
+// NewSqlCheckpointStore constructs a CheckpointStore that persists checkpoints
+// in the projection_checkpoints table of the database of a sql event repository.
+//
+// A TransactionalProjection run with the store writes its read model in the
+// transaction that saves its checkpoint.
+func NewSqlCheckpointStore(repo EventRepository) (CheckpointStore, error) {
+	db, err := sqlDB(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlCheckpointStore{
+		db: db,
+	}, nil
+}
+
+func (s *sqlCheckpointStore) LoadCheckpoint(ctx context.Context, name string) (int, error) {
+	m, err := s.db.GetQuery().ProjectionCheckpoint.WithContext(ctx).Where(models.ProjectionCheckpoint.Name.Eq(name)).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, nil
+		}
+
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return int(m.Position), nil
+}
+
+func (s *sqlCheckpointStore) SaveCheckpoint(ctx context.Context, name string, position int) error {
+	if err := saveCheckpoint(ctx, s.db.GetQuery(), name, position); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlCheckpointStore) saveCheckpointWith(ctx context.Context, name string, position int, write func(tx SqlTx) error) error {
+	var writeErr error
+	err := s.db.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if writeErr = write(tx.Statement.ConnPool); writeErr != nil {
+			return writeErr
+		}
+
+		return saveCheckpoint(ctx, models.Use(tx), name, position)
+	})
+
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func saveCheckpoint(ctx context.Context, q *models.Query, name string, position int) error {
+	return q.ProjectionCheckpoint.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: models.ProjectionCheckpoint.Name.ColumnName().String()}},
+		DoUpdates: clause.AssignmentColumns([]string{models.ProjectionCheckpoint.Position.ColumnName().String(), models.ProjectionCheckpoint.UpdatedAt.ColumnName().String()}),
+	}).Create(&model.ProjectionCheckpoint{
+		Name:      name,
+		Position:  int64(position),
+		UpdatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,185 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gorm"
+)
+
+type sqlCommandScheduleStore struct {
+	db orm.DB
+}
+
+// NewSqlCommandScheduleStore constructs a CommandScheduleStore that persists
+// scheduled commands in the scheduled_command table of the database of a sql
+// event repository.
+func NewSqlCommandScheduleStore(repo EventRepository) (CommandScheduleStore, error) {
+	db, err := sqlDB(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlCommandScheduleStore{
+		db: db,
+	}, nil
+}
+
+func (s *sqlCommandScheduleStore) Schedule(ctx context.Context, command *ScheduledCommand) error {
+	m := &model.ScheduledCommand{
+		ID:          command.ID,
+		CommandName: command.CommandName,
+		AggregateID: command.AggregateID,
+		Data:        command.Data,
+		DueAt:       command.DueAt.UTC(),
+		Attempts:    int32(command.Attempts),
+		CreatedAt:   command.CreatedAt.UTC(),
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+
+	if len(command.Headers) > 0 {
+		headers, err := json.Marshal(command.Headers)
+		if err != nil {
+			return &ErrUnexpected{Err: err}
+		}
+		h := string(headers)
+		m.Headers = &h
+	}
+
+	if command.LastError != "" {
+		m.LastError = &command.LastError
+	}
+
+	if err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).Create(m); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlCommandScheduleStore) Get(ctx context.Context, id string) (*ScheduledCommand, error) {
+	m, err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).Where(models.ScheduledCommand.ID.Eq(id)).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &ErrScheduledCommandNotFound{ID: id}
+		}
+
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return buildScheduledCommand(m)
+}
+
+func (s *sqlCommandScheduleStore) Cancel(ctx context.Context, id string) error {
+	info, err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).Where(models.ScheduledCommand.ID.Eq(id)).Delete()
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	if info.RowsAffected == 0 {
+		return &ErrScheduledCommandNotFound{ID: id}
+	}
+
+	return nil
+}
+
+func (s *sqlCommandScheduleStore) Due(ctx context.Context, now time.Time, limit int) ([]*ScheduledCommand, error) {
+	q := s.db.GetQuery().ScheduledCommand.WithContext(ctx).
+		Where(models.ScheduledCommand.DueAt.Lte(now.UTC())).
+		Order(models.ScheduledCommand.DueAt, models.ScheduledCommand.ID)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+
+	ms, err := q.Find()
+	if err != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	commands := make([]*ScheduledCommand, 0, len(ms))
+	for _, m := range ms {
+		command, err := buildScheduledCommand(m)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+func (s *sqlCommandScheduleStore) Claim(ctx context.Context, command *ScheduledCommand, until time.Time) (bool, error) {
+	info, err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).
+		Where(models.ScheduledCommand.ID.Eq(command.ID), models.ScheduledCommand.Attempts.Eq(int32(command.Attempts))).
+		UpdateSimple(models.ScheduledCommand.DueAt.Value(until.UTC()), models.ScheduledCommand.Attempts.Add(1))
+	if err != nil {
+		return false, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return info.RowsAffected == 1, nil
+}
+
+func (s *sqlCommandScheduleStore) Fail(ctx context.Context, id string, retryAt time.Time, lastError string) error {
+	_, err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).
+		Where(models.ScheduledCommand.ID.Eq(id)).
+		UpdateSimple(models.ScheduledCommand.DueAt.Value(retryAt.UTC()), models.ScheduledCommand.LastError.Value(lastError))
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlCommandScheduleStore) Complete(ctx context.Context, id string) error {
+	if _, err := s.db.GetQuery().ScheduledCommand.WithContext(ctx).Where(models.ScheduledCommand.ID.Eq(id)).Delete(); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func buildScheduledCommand(m *model.ScheduledCommand) (*ScheduledCommand, error) {
+	command := &ScheduledCommand{
+		ID:          m.ID,
+		CommandName: m.CommandName,
+		AggregateID: m.AggregateID,
+		Data:        m.Data,
+		Headers:     make(map[string]interface{}),
+		DueAt:       m.DueAt,
+		Attempts:    int(m.Attempts),
+		CreatedAt:   m.CreatedAt,
+	}
+
+	if m.Headers != nil {
+		if err := json.Unmarshal([]byte(*m.Headers), &command.Headers); err != nil {
+			return nil, &ErrUnexpected{Err: err}
+		}
+	}
+
+	if m.LastError != nil {
+		command.LastError = *m.LastError
+	}
+
+	return command, nil
+}
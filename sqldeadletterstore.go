@@ -0,0 +1,196 @@
+package ycq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gen"
+	"gorm.io/gorm"
+)
+
+type sqlDeadLetterStore struct {
+	db orm.DB
+}
+
+// NewSqlDeadLetterStore constructs a DeadLetterStore that persists dead letters
+// in the dead_letter table of the database of a sql event repository.
+func NewSqlDeadLetterStore(repo EventRepository) (DeadLetterStore, error) {
+	db, err := sqlDB(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlDeadLetterStore{
+		db: db,
+	}, nil
+}
+
+func (s *sqlDeadLetterStore) ParkEvent(ctx context.Context, failure *HandlerFailure) error {
+	letter, err := newEventDeadLetter(failure)
+	if err != nil {
+		return err
+	}
+
+	return s.park(ctx, letter)
+}
+
+func (s *sqlDeadLetterStore) ParkCommand(ctx context.Context, failure *CommandFailure) error {
+	letter, err := newCommandDeadLetter(failure)
+	if err != nil {
+		return err
+	}
+
+	return s.park(ctx, letter)
+}
+
+func (s *sqlDeadLetterStore) park(ctx context.Context, letter *DeadLetterEntry) error {
+	m := &model.DeadLetter{
+		Kind:     string(letter.Kind),
+		Name:     letter.Name,
+		Handler:  letter.Handler,
+		EventID:  letter.EventID,
+		Data:     letter.Data,
+		Error:    letter.Error,
+		Attempts: int32(letter.Attempts),
+	}
+
+	if letter.AggregateID != "" {
+		m.AggregateID = &letter.AggregateID
+	}
+
+	if letter.Version != nil {
+		version := int32(*letter.Version)
+		m.Version = &version
+	}
+
+	if len(letter.Headers) > 0 {
+		headers, err := json.Marshal(letter.Headers)
+		if err != nil {
+			return &ErrUnexpected{Err: err}
+		}
+		h := string(headers)
+		m.Headers = &h
+	}
+
+	if err := s.db.GetQuery().DeadLetter.WithContext(ctx).Create(m); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlDeadLetterStore) List(ctx context.Context, query DeadLetterQuery) ([]*DeadLetterEntry, error) {
+	q := s.db.GetQuery().DeadLetter.WithContext(ctx).Where(deadLetterConds(query)...).Order(models.DeadLetter.ID)
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+
+	ms, err := q.Find()
+	if err != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	letters := make([]*DeadLetterEntry, 0, len(ms))
+	for _, m := range ms {
+		letter, err := buildDeadLetter(m)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+
+	return letters, nil
+}
+
+func (s *sqlDeadLetterStore) Get(ctx context.Context, id int64) (*DeadLetterEntry, error) {
+	m, err := s.db.GetQuery().DeadLetter.WithContext(ctx).Where(models.DeadLetter.ID.Eq(id)).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &ErrDeadLetterNotFound{ID: id}
+		}
+
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return buildDeadLetter(m)
+}
+
+func (s *sqlDeadLetterStore) Delete(ctx context.Context, id int64) error {
+	if _, err := s.db.GetQuery().DeadLetter.WithContext(ctx).Where(models.DeadLetter.ID.Eq(id)).Delete(); err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlDeadLetterStore) Purge(ctx context.Context, query DeadLetterQuery) (int, error) {
+	conds := deadLetterConds(query)
+	if len(conds) == 0 {
+		// gorm refuses deletes without conditions.
+		conds = append(conds, models.DeadLetter.ID.Gt(0))
+	}
+
+	info, err := s.db.GetQuery().DeadLetter.WithContext(ctx).Where(conds...).Delete()
+	if err != nil {
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return int(info.RowsAffected), nil
+}
+
+func deadLetterConds(query DeadLetterQuery) []gen.Condition {
+	var conds []gen.Condition
+	if query.Kind != "" {
+		conds = append(conds, models.DeadLetter.Kind.Eq(string(query.Kind)))
+	}
+	if query.Name != "" {
+		conds = append(conds, models.DeadLetter.Name.Eq(query.Name))
+	}
+
+	return conds
+}
+
+func buildDeadLetter(m *model.DeadLetter) (*DeadLetterEntry, error) {
+	letter := &DeadLetterEntry{
+		ID:        m.ID,
+		Kind:      DeadLetterKind(m.Kind),
+		Name:      m.Name,
+		Handler:   m.Handler,
+		EventID:   m.EventID,
+		Data:      m.Data,
+		Headers:   make(map[string]interface{}),
+		Error:     m.Error,
+		Attempts:  int(m.Attempts),
+		CreatedAt: m.CreatedAt,
+	}
+
+	if m.AggregateID != nil {
+		letter.AggregateID = *m.AggregateID
+	}
+
+	if m.Version != nil {
+		version := int(*m.Version)
+		letter.Version = &version
+	}
+
+	if m.Headers != nil {
+		if err := json.Unmarshal([]byte(*m.Headers), &letter.Headers); err != nil {
+			return nil, &ErrUnexpected{Err: err}
+		}
+	}
+
+	return letter, nil
+}
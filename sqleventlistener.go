@@ -0,0 +1,166 @@
+package ycq
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// sqlEventStreamChannel is the postgres notification channel events appended to
+// the event_stream table are announced on.
+const sqlEventStreamChannel = "ycq_event_stream"
+
+const (
+	pgListenerMinReconnectInterval = time.Second
+	pgListenerMaxReconnectInterval = time.Minute
+)
+
+// sqlEventStreamNotification is the payload of a notification sent on commit of
+// an append to the event_stream table.
+type sqlEventStreamNotification struct {
+	StreamId string `json:"stream_id"`
+	Position int    `json:"position"`
+}
+
+// pgEventListener listens for event_stream notifications on a dedicated postgres
+// connection and wakes up subscriptions when any process appends events.
+//
+// The notifier is marked as pushed only while the connection is up and the
+// channel is listened on, otherwise subscriptions fall back to polling. The
+// connection is re-established in the background, a channel that could not be
+// listened on is listened on again once it is.
+type pgEventListener struct {
+	listener pgListener
+	notifier *appendNotifier
+	logf     func(format string, args ...interface{})
+
+	// reconnected is signalled when the connection is (re-)established.
+	reconnected chan struct{}
+	done        chan struct{}
+
+	mu        sync.Mutex
+	connected bool
+	listening bool
+	closed    bool
+}
+
+// pgListener is the part of *pq.Listener used by pgEventListener.
+type pgListener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+func newPgEventListener(dsn string, notifier *appendNotifier, logf func(format string, args ...interface{})) *pgEventListener {
+	return startPgEventListener(notifier, logf, func(onEvent pq.EventCallbackType) pgListener {
+		return pq.NewListener(dsn, pgListenerMinReconnectInterval, pgListenerMaxReconnectInterval, onEvent)
+	})
+}
+
+func startPgEventListener(notifier *appendNotifier, logf func(format string, args ...interface{}), open func(onEvent pq.EventCallbackType) pgListener) *pgEventListener {
+	l := &pgEventListener{
+		notifier:    notifier,
+		logf:        logf,
+		reconnected: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	l.listener = open(l.onEvent)
+
+	go l.listen()
+
+	return l
+}
+
+func (l *pgEventListener) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		// Channels are listened again before reconnection is reported, events
+		// appended while disconnected are picked up by the wake up.
+		l.update(func() {
+			l.connected = true
+
+			select {
+			case l.reconnected <- struct{}{}:
+			default:
+			}
+		})
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		l.update(func() { l.connected = false })
+	}
+}
+
+func (l *pgEventListener) listen() {
+	// Listen waits for the connection when it is down and fails when the
+	// server refuses to listen, that is tried again on the next connection.
+	for {
+		select {
+		case <-l.reconnected:
+		default:
+		}
+
+		err := l.listener.Listen(sqlEventStreamChannel)
+		if err == nil || err == pq.ErrChannelAlreadyOpen {
+			break
+		}
+
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+		l.logf("event listener failed to listen for appends, polling until reconnected: %s", err)
+
+		select {
+		case <-l.reconnected:
+		case <-l.done:
+			return
+		}
+	}
+	l.update(func() { l.listening = true })
+
+	for range l.listener.NotificationChannel() {
+		// A nil notification is sent after reconnecting, it wakes up
+		// subscriptions as well.
+		l.notifier.notify()
+	}
+}
+
+// update applies the change to the state of the listener and marks the
+// notifier as pushed while the channel is listened on a live connection.
+func (l *pgEventListener) update(change func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+
+	change()
+	l.notifier.setPushed(l.connected && l.listening)
+}
+
+func (l *pgEventListener) Close() error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	l.mu.Unlock()
+
+	l.notifier.setPushed(false)
+	return l.listener.Close()
+}
+
+func marshalSqlEventStreamNotification(streamId string, position int) (string, error) {
+	b, err := json.Marshal(sqlEventStreamNotification{
+		StreamId: streamId,
+		Position: position,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,172 @@
+package ycq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SqlEventListenerSuite{})
+
+type SqlEventListenerSuite struct{}
+
+func (s *SqlEventListenerSuite) TestNotificationPayload(c *C) {
+	payload, err := marshalSqlEventStreamNotification("stream", 42)
+
+	c.Assert(err, IsNil)
+	c.Assert(payload, Equals, `{"stream_id":"stream","position":42}`)
+}
+
+func (s *SqlEventListenerSuite) TestLosingPushWakesWaiters(c *C) {
+	n := newAppendNotifier()
+	n.setPushed(true)
+	c.Assert(n.isPushed(), Equals, true)
+
+	w := n.wait()
+	n.setPushed(false)
+
+	select {
+	case <-w:
+	default:
+		c.Fatal("waiter was not woken up")
+	}
+	c.Assert(n.isPushed(), Equals, false)
+}
+
+// fakePgListener fails the first failures calls to Listen.
+type fakePgListener struct {
+	failures      int
+	listens       chan error
+	notifications chan *pq.Notification
+}
+
+func newFakePgListener(failures int) *fakePgListener {
+	return &fakePgListener{
+		failures:      failures,
+		listens:       make(chan error, 10),
+		notifications: make(chan *pq.Notification),
+	}
+}
+
+func (f *fakePgListener) Listen(channel string) error {
+	var err error
+	if f.failures > 0 {
+		f.failures--
+		err = errors.New("permission denied")
+	}
+	f.listens <- err
+
+	return err
+}
+
+func (f *fakePgListener) NotificationChannel() <-chan *pq.Notification {
+	return f.notifications
+}
+
+func (f *fakePgListener) Close() error {
+	close(f.notifications)
+	return nil
+}
+
+func (s *SqlEventListenerSuite) TestFailedListenIsRetriedOnReconnect(c *C) {
+	var mu sync.Mutex
+	var logged []string
+	logf := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+
+	fake := newFakePgListener(1)
+	n := newAppendNotifier()
+	l := startPgEventListener(n, logf, func(onEvent pq.EventCallbackType) pgListener {
+		return fake
+	})
+	defer l.Close()
+
+	l.onEvent(pq.ListenerEventConnected, nil)
+	c.Assert(<-fake.listens, NotNil)
+	c.Assert(n.isPushed(), Equals, false)
+
+	l.onEvent(pq.ListenerEventDisconnected, nil)
+	l.onEvent(pq.ListenerEventReconnected, nil)
+	select {
+	case err := <-fake.listens:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("listen was not retried on reconnect")
+	}
+
+	for i := 0; i < 100 && !n.isPushed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(n.isPushed(), Equals, true)
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(logged, HasLen, 1)
+	c.Assert(logged[0], Matches, ".*permission denied")
+}
+
+func (s *SqlEventListenerSuite) TestClosedListenerStopsRetrying(c *C) {
+	fake := newFakePgListener(1)
+	l := startPgEventListener(newAppendNotifier(), func(string, ...interface{}) {}, func(onEvent pq.EventCallbackType) pgListener {
+		return fake
+	})
+
+	c.Assert(<-fake.listens, NotNil)
+	c.Assert(l.Close(), IsNil)
+	l.onEvent(pq.ListenerEventReconnected, nil)
+
+	select {
+	case <-fake.listens:
+		c.Fatal("closed listener listened again")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestPostgresPushesAppendsOfOtherRepositories needs a migrated postgres database,
+// set YCQ_TEST_POSTGRES_DSN to run it.
+func (s *SqlEventListenerSuite) TestPostgresPushesAppendsOfOtherRepositories(c *C) {
+	dsn := os.Getenv("YCQ_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		c.Skip("YCQ_TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+	reader, err := NewSqlEventRepository("postgres", dsn, NewInternalEventBus())
+	c.Assert(err, IsNil)
+	defer reader.(io.Closer).Close()
+
+	writer, err := NewSqlEventRepository("postgres", dsn, NewInternalEventBus())
+	c.Assert(err, IsNil)
+	defer writer.(io.Closer).Close()
+
+	last, err := reader.Read(ctx).Backward().Limit(1).ToList()
+	c.Assert(err, IsNil)
+	from := 0
+	if len(last) > 0 {
+		from, _ = EventPosition(last[0])
+	}
+
+	sub, err := reader.Subscribe(ctx, SubscriptionOptions{FromPosition: from, PollInterval: time.Hour})
+	c.Assert(err, IsNil)
+	defer sub.Close()
+
+	ev := NewTestEventMessage(NewUUID())
+	c.Assert(writer.Append(ctx, NewUUID(), []EventMessage{ev}, nil), IsNil)
+
+	select {
+	case got := <-sub.Events():
+		c.Assert(*got.EventID(), Equals, *ev.EventID())
+	case <-time.After(10 * time.Second):
+		c.Fatal("appended event was not pushed")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"gorm.io/gen"
 	"gorm.io/gen/field"
 	"gorm.io/gorm"
+	"sync"
 	"time"
 )
 
@@ -23,16 +24,37 @@ const (
 )
 
 type sqlEventRepository struct {
-	db orm.DB
+	db       orm.DB
+	dsn      string
+	notifier *appendNotifier
+	outbox   bool
+
+	// snapshots is set once a snapshot store uses the database, the snapshot
+	// table is only required then.
+	snapshots bool
+
+	// listener is opened by the first subscription on postgres.
+	listenerMu sync.Mutex
+	listener   *pgEventListener
+	closed     bool
 }
 
 type sqlEventRepositoryReaderSpec struct {
-	fromTime  *time.Time
-	toTime    *time.Time
-	fromId    *int
-	toId      *int
-	direction readDirection
-	limit     *int
+	fromTime    *time.Time
+	toTime      *time.Time
+	fromId      *int
+	toId        *int
+	fromVersion *int
+	direction   readDirection
+	limit       *int
+	metadata    []metadataFilter
+	db          orm.DB
+}
+
+// metadataFilter selects events with a header of the given string value.
+type metadataFilter struct {
+	key   string
+	value string
 }
 
 type sqlEventRepositoryReader struct {
@@ -41,10 +63,17 @@ type sqlEventRepositoryReader struct {
 }
 
 func (s *sqlEventRepositoryReader) buildEvent(m *model.EventStream) (EventMessage, error) {
-	return NewEventMessage(&m.Event.EventID, &RawEvent{
-		name: m.Event.EventName,
-		data: m.Event.EventData,
-	}, parser.Int(m.StreamVersion).ToIntPtr()), nil
+	meta := parseEventMetadata(m.Event.Metadata)
+	em := NewEventMessage(&m.Event.EventID, &RawEvent{
+		name:          m.Event.EventName,
+		data:          m.Event.EventData,
+		schemaVersion: meta.SchemaVersion,
+	}, parser.Int(m.StreamVersion).ToIntPtr())
+	meta.setHeaders(em)
+	em.SetHeader(HeaderPosition, int(m.ID))
+	em.SetHeader(HeaderStreamId, m.StreamID)
+
+	return em, nil
 }
 
 func (s *sqlEventRepositoryReaderSpec) BuildQuery(query models.IEventStreamDo) (models.IEventStreamDo, error) {
@@ -76,10 +105,18 @@ func (s *sqlEventRepositoryReaderSpec) BuildQuery(query models.IEventStreamDo) (
 		}
 
 		conds = append(conds, models.EventStream.ID.Between(int64(*s.fromId), int64(*s.toId)))
-	} else if s.fromTime != nil {
+	} else if s.fromId != nil {
 		conds = append(conds, models.EventStream.ID.Gte(int64(*s.fromId)))
 	}
 
+	if s.fromVersion != nil {
+		conds = append(conds, models.EventStream.StreamVersion.Gte(int32(*s.fromVersion)))
+	}
+
+	for _, f := range s.metadata {
+		conds = append(conds, s.metadataCond(f))
+	}
+
 	switch s.direction {
 	case readDirectionForward:
 		orders = append(orders, models.EventStream.ID)
@@ -95,6 +132,26 @@ func (s *sqlEventRepositoryReaderSpec) BuildQuery(query models.IEventStreamDo) (
 	return query, nil
 }
 
+// metadataCond matches the stream entries whose event has the header of the
+// filter in its persisted metadata.
+func (s *sqlEventRepositoryReaderSpec) metadataCond(f metadataFilter) field.Expr {
+	path := fmt.Sprintf("$.headers.%q", f.key)
+	var header string
+	switch s.db.Driver() {
+	case orm.OrmDriverPostgres:
+		header, path = "m.metadata::jsonb -> 'headers' ->> ?", f.key
+	case orm.OrmDriverMysql:
+		header = "JSON_UNQUOTE(JSON_EXTRACT(m.metadata, ?))"
+	default:
+		header = "json_extract(m.metadata, ?)"
+	}
+
+	sub := s.db.GetDB().Table(model.TableNameEventStore+" AS m").Select("1").
+		Where(fmt.Sprintf("m.event_id = %s.event_id AND %s = ?", model.TableNameEventStream, header), path, f.value)
+
+	return field.CompareSubQuery(field.ExistsOp, nil, sub)
+}
+
 func (s *sqlEventRepositoryReader) Stream(streamId string) EventRepositoryReader {
 	s.streamQuery = s.streamQuery.Where(models.EventStream.StreamID.Eq(streamId))
 	return s
@@ -110,6 +167,11 @@ func (s *sqlEventRepositoryReader) FromId(id int) EventRepositoryReader {
 	return s
 }
 
+func (s *sqlEventRepositoryReader) FromVersion(version int) EventRepositoryReader {
+	s.spec.fromVersion = &version
+	return s
+}
+
 func (s *sqlEventRepositoryReader) ToTime(date time.Time) EventRepositoryReader {
 	s.spec.toTime = &date
 	return s
@@ -139,6 +201,13 @@ func (s *sqlEventRepositoryReader) Limit(count int) EventRepositoryReader {
 	return s
 }
 
+// Metadata selects the events persisted with the header key set to the string value.
+func (s *sqlEventRepositoryReader) Metadata(key string, value string) EventRepositoryReader {
+	s.spec.metadata = append(s.spec.metadata, metadataFilter{key: key, value: value})
+
+	return s
+}
+
 func (s *sqlEventRepositoryReader) Event(id string) (EventMessage, error) {
 	q, err := s.spec.BuildQuery(s.streamQuery)
 	if err != nil {
@@ -257,7 +326,7 @@ func (s *sqlEventRepository) GetStreamIdOf(ctx context.Context, eventId string)
 		}
 	}
 
-	return evs.EventID, nil
+	return evs.StreamID, nil
 }
 
 func (s *sqlEventRepository) GetVersionInStream(ctx context.Context, streamId, eventId string) (*int, error) {
@@ -283,8 +352,91 @@ func (s *sqlEventRepository) IsEventInStream(ctx context.Context, streamId, even
 }
 
 type eventMetadata struct {
-	Timestamp     time.Time `json:"timestamp"`
-	CorrelationId string    `json:"correlation_id"`
+	Timestamp     time.Time              `json:"timestamp"`
+	CorrelationId string                 `json:"correlation_id"`
+	CausationId   string                 `json:"causation_id,omitempty"`
+	Actor         string                 `json:"actor,omitempty"`
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	Headers       map[string]interface{} `json:"headers,omitempty"`
+}
+
+// newEventMetadata returns the metadata persisted with the event. The standard
+// headers of the event are kept, an event without a correlation id starts a new
+// correlation and an event without a timestamp is timestamped now.
+//
+// All headers but the position and stream id, which belong to the stream entry
+// the event is read from, are kept in Headers.
+func newEventMetadata(ev EventMessage) eventMetadata {
+	headers := ev.GetHeaders()
+	meta := eventMetadata{
+		CorrelationId: CorrelationId(headers),
+		CausationId:   CausationId(headers),
+		Actor:         Actor(headers),
+		SchemaVersion: EventSchemaVersion(ev.Event()),
+	}
+
+	for k, v := range headers {
+		if k == HeaderPosition || k == HeaderStreamId {
+			continue
+		}
+
+		if meta.Headers == nil {
+			meta.Headers = make(map[string]interface{}, len(headers))
+		}
+		meta.Headers[k] = v
+	}
+
+	if meta.CorrelationId == "" {
+		meta.CorrelationId = NewUUID()
+	}
+
+	if t, ok := Timestamp(headers); ok {
+		meta.Timestamp = t
+	} else {
+		meta.Timestamp = time.Now().UTC()
+	}
+
+	return meta
+}
+
+// parseEventMetadata decodes the metadata column of an event, events persisted
+// before the schema version was recorded are at version 1.
+func parseEventMetadata(md *string) eventMetadata {
+	var meta eventMetadata
+	if md != nil {
+		_ = json.Unmarshal([]byte(*md), &meta)
+	}
+
+	if meta.SchemaVersion <= 0 {
+		meta.SchemaVersion = 1
+	}
+
+	return meta
+}
+
+// setHeaders restores the headers of an event read back. Header values are
+// restored as decoded from JSON, except the standard headers which keep their
+// types.
+func (m eventMetadata) setHeaders(em EventMessage) {
+	for k, v := range m.Headers {
+		em.SetHeader(k, v)
+	}
+
+	if !m.Timestamp.IsZero() {
+		em.SetHeader(HeaderTimestamp, m.Timestamp)
+	}
+
+	if m.CorrelationId != "" {
+		em.SetHeader(HeaderCorrelationId, m.CorrelationId)
+	}
+
+	if m.CausationId != "" {
+		em.SetHeader(HeaderCausationId, m.CausationId)
+	}
+
+	if m.Actor != "" {
+		em.SetHeader(HeaderActor, m.Actor)
+	}
 }
 
 func (s *sqlEventRepository) appendToStream(ctx context.Context, streamId string, events []EventMessage, expectedVersion *int) error {
@@ -301,10 +453,10 @@ func (s *sqlEventRepository) appendToStream(ctx context.Context, streamId string
 			return err
 		}
 
-		md, err := json.Marshal(eventMetadata{
-			Timestamp:     time.Now(),
-			CorrelationId: NewUUID(),
-		})
+		md, err := json.Marshal(newEventMetadata(ev))
+		if err != nil {
+			return err
+		}
 
 		eventID := NewUUID()
 		evModels[i] = &model.EventStore{
@@ -330,115 +482,193 @@ func (s *sqlEventRepository) appendToStream(ctx context.Context, streamId string
 			return err
 		}
 
-		for _, evId := range evIds {
-			// Get last stream
-			evs, err := q.EventStream.Select(models.EventStream.StreamVersion).Where(models.EventStream.StreamID.Eq(streamId)).Order(models.EventStream.StreamVersion.Desc()).Limit(1).First()
-			if err != nil {
-				if err != gorm.ErrRecordNotFound {
-					return err
-				}
-			}
-
-			// Get last version
-			lastVersion := 0
-			if evs != nil {
-				lastVersion = int(evs.StreamVersion)
-			}
-
-			newVersion := lastVersion + 1
-			if expectedVersion != nil {
-				if *expectedVersion != lastVersion {
-					return fmt.Errorf("Wrong expected stream version")
-				}
-			}
-
-			if err := q.EventStream.Omit(field.AssociationFields).Create(&model.EventStream{
-				StreamID:      streamId,
-				StreamVersion: int32(newVersion),
-				EventID:       evId,
-			}); err != nil {
-				return err
-			}
+		entries, err := s.appendStreamEntries(q.EventStream, streamId, evIds, expectedVersion)
+		if err != nil || !s.outbox {
+			return err
 		}
 
-		return nil
+		return s.appendToOutbox(q.EventOutbox, evModels, entries)
 	})
 
 	if err != nil {
-		return &ErrRepositoryExecution{
-			Err: err,
-		}
+		return s.wrapStreamWriteError(ctx, err)
 	}
 
+	s.notifier.notify()
+
 	return nil
 }
 
-func (s *sqlEventRepository) Append(ctx context.Context, streamId string, events []EventMessage, expectedVersion *int) error {
-	return s.appendToStream(ctx, streamId, events, expectedVersion)
+// appendToOutbox records the appended events in the outbox, in the same
+// transaction as the events themselves.
+func (s *sqlEventRepository) appendToOutbox(q models.IEventOutboxDo, evModels []*model.EventStore, entries []*model.EventStream) error {
+	rows := make([]*model.EventOutbox, len(evModels))
+	for i, m := range evModels {
+		rows[i] = &model.EventOutbox{
+			EventID:       m.EventID,
+			StreamID:      entries[i].StreamID,
+			StreamVersion: entries[i].StreamVersion,
+			EventName:     m.EventName,
+			EventData:     m.EventData,
+			Metadata:      m.Metadata,
+		}
+	}
+
+	return q.Create(rows...)
 }
 
-func (s *sqlEventRepository) Link(ctx context.Context, streamId string, eventIds []string, expectedVersion *int) error {
-	q := s.db.GetQuery().WithContext(ctx)
-	// Make sure all eventIds in event
-	es, err := q.EventStore.Select(models.EventStore.ID).Where(models.EventStore.EventID.In(eventIds...)).Find()
+// EnableOutbox makes appends write the events to the event_outbox table in the
+// same transaction, to be published by an OutboxRelay.
+func (s *sqlEventRepository) EnableOutbox() {
+	s.outbox = true
+}
+
+func (s *sqlEventRepository) OutboxEnabled() bool {
+	return s.outbox
+}
+
+// lastStreamVersion returns the version of the last event in the stream, an empty
+// stream is at version 0.
+func (s *sqlEventRepository) lastStreamVersion(q models.IEventStreamDo, streamId string) (int, error) {
+	evs, err := q.Select(models.EventStream.StreamVersion).Where(models.EventStream.StreamID.Eq(streamId)).Order(models.EventStream.StreamVersion.Desc()).Limit(1).First()
 	if err != nil {
-		return &ErrRepositoryExecution{
-			Err: err,
+		if err == gorm.ErrRecordNotFound {
+			return 0, nil
 		}
+
+		return 0, err
 	}
 
-	if len(es) != len(eventIds) {
-		return &ErrRepositoryExecution{
-			Err: fmt.Errorf("An event not exist"),
+	return int(evs.StreamVersion), nil
+}
+
+// appendStreamEntries adds the events to the end of the stream after checking the
+// expected version of the stream.
+//
+// A unique key clash on (stream_id, stream_version) means a concurrent writer has
+// appended to the stream after the version was read, it is reported as a
+// concurrency violation as well.
+func (s *sqlEventRepository) appendStreamEntries(q models.IEventStreamDo, streamId string, eventIds []string, expectedVersion *int) ([]*model.EventStream, error) {
+	lastVersion, err := s.lastStreamVersion(q, streamId)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != nil && *expectedVersion != lastVersion {
+		return nil, &ErrConcurrencyViolation{
+			ExpectedVersion: expectedVersion,
+			ActualVersion:   Int(lastVersion),
+			StreamName:      streamId,
 		}
 	}
 
-	for _, evId := range eventIds {
-		// Get last stream
-		evs, err := q.EventStream.Select(models.EventStream.StreamVersion).Where(models.EventStream.StreamID.Eq(streamId)).Order(models.EventStream.StreamVersion.Desc()).Limit(1).First()
-		if err != nil {
-			if err != gorm.ErrRecordNotFound {
-				return &ErrRepositoryExecution{
-					Err: err,
+	entries := make([]*model.EventStream, len(eventIds))
+	for i, evId := range eventIds {
+		entries[i] = &model.EventStream{
+			StreamID:      streamId,
+			StreamVersion: int32(lastVersion + i + 1),
+			EventID:       evId,
+		}
+		if err := q.Omit(field.AssociationFields).Create(entries[i]); err != nil {
+			if orm.IsUniqueViolation(err) {
+				return nil, &ErrConcurrencyViolation{
+					ExpectedVersion: expectedVersion,
+					StreamName:      streamId,
 				}
 			}
+
+			return nil, err
 		}
+	}
 
-		// Get last version
-		lastVersion := 0
-		if evs != nil {
-			lastVersion = int(evs.StreamVersion)
+	if len(entries) > 0 && s.db.Driver() == orm.OrmDriverPostgres {
+		// Notifications are delivered on commit, listeners never see uncommitted events.
+		payload, err := marshalSqlEventStreamNotification(streamId, int(entries[len(entries)-1].ID))
+		if err != nil {
+			return nil, err
 		}
 
-		newVersion := lastVersion + 1
-		if expectedVersion != nil {
-			if *expectedVersion != lastVersion {
-				return fmt.Errorf("Wrong expected stream version")
+		if err := q.UnderlyingDB().Exec("SELECT pg_notify(?, ?)", sqlEventStreamChannel, payload).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// wrapStreamWriteError wraps errors from writing to a stream in ErrRepositoryExecution,
+// concurrency violations are returned as is so callers can detect them.
+//
+// The version of the stream is read again for a violation reported by a unique
+// key clash, once the transaction that clashed was rolled back.
+func (s *sqlEventRepository) wrapStreamWriteError(ctx context.Context, err error) error {
+	if violation, ok := err.(*ErrConcurrencyViolation); ok {
+		if violation.ActualVersion == nil {
+			if lastVersion, err := s.lastStreamVersion(s.db.GetQuery().EventStream.WithContext(ctx), violation.StreamName); err == nil {
+				violation.ActualVersion = Int(lastVersion)
 			}
+		}
+
+		return violation
+	}
 
+	return &ErrRepositoryExecution{
+		Err: err,
+	}
+}
+
+func (s *sqlEventRepository) Append(ctx context.Context, streamId string, events []EventMessage, expectedVersion *int) error {
+	return s.appendToStream(ctx, streamId, events, expectedVersion)
+}
+
+func (s *sqlEventRepository) Link(ctx context.Context, streamId string, eventIds []string, expectedVersion *int) error {
+	err := s.db.GetQuery().Transaction(func(tx *models.Query) error {
+		q := tx.WithContext(ctx)
+		// Make sure all eventIds in event
+		es, err := q.EventStore.Select(models.EventStore.ID).Where(models.EventStore.EventID.In(eventIds...)).Find()
+		if err != nil {
+			return err
 		}
 
-		if err := q.EventStream.Omit(field.AssociationFields).Create(&model.EventStream{
-			StreamID:      streamId,
-			StreamVersion: int32(newVersion),
-			EventID:       evId,
-		}); err != nil {
-			return &ErrRepositoryExecution{
-				Err: err,
-			}
+		if len(es) != len(eventIds) {
+			return fmt.Errorf("An event not exist")
 		}
+
+		_, err = s.appendStreamEntries(q.EventStream, streamId, eventIds, expectedVersion)
+		return err
+	})
+
+	if err != nil {
+		return s.wrapStreamWriteError(ctx, err)
 	}
 
+	s.notifier.notify()
+
 	return nil
 }
 
+// DeleteStream deletes the events of the stream, and its snapshots once a
+// snapshot store was constructed with NewSqlSnapshotStore over the repository.
 func (s *sqlEventRepository) DeleteStream(ctx context.Context, streamId string) error {
 	if streamId == "" {
 		return &ErrRepositoryExecution{
 			Err: fmt.Errorf("streamId can't be empty"),
 		}
 	}
-	_, err := s.db.GetQuery().EventStream.WithContext(ctx).Where(models.EventStream.StreamID.Eq(streamId)).Delete()
+	// The snapshots of the stream go with it, a stream appended again under the
+	// same id must not be restored from them.
+	err := s.db.GetQuery().Transaction(func(tx *models.Query) error {
+		if _, err := tx.EventStream.WithContext(ctx).Where(models.EventStream.StreamID.Eq(streamId)).Delete(); err != nil {
+			return err
+		}
+
+		if !s.snapshots {
+			return nil
+		}
+
+		_, err := tx.SnapshotStore.WithContext(ctx).Where(models.SnapshotStore.StreamID.Eq(streamId)).Delete()
+		return err
+	})
 	if err != nil {
 		return &ErrRepositoryExecution{
 			Err: err,
@@ -451,10 +681,99 @@ func (s *sqlEventRepository) DeleteStream(ctx context.Context, streamId string)
 func (s *sqlEventRepository) Read(ctx context.Context) EventRepositoryReader {
 	return &sqlEventRepositoryReader{
 		streamQuery: s.db.GetQuery().WithContext(ctx).EventStream.ReadDB(),
-		spec:        new(sqlEventRepositoryReaderSpec),
+		spec:        &sqlEventRepositoryReaderSpec{db: s.db},
+	}
+}
+
+// Subscribe subscribes to the global $all stream ordered by event_stream.id.
+//
+// Appends made through this repository wake subscriptions up immediately.
+// On postgres appends made by other processes are announced with NOTIFY, on
+// other drivers or while the notification connection is down they are picked
+// up by polling.
+func (s *sqlEventRepository) Subscribe(ctx context.Context, options SubscriptionOptions) (Subscription, error) {
+	s.listen()
+	return newSubscription(ctx, s, s.notifier, options)
+}
+
+// listen opens the notification listener on postgres unless it is open.
+func (s *sqlEventRepository) listen() {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	if s.listener != nil || s.closed || s.db.Driver() != orm.OrmDriverPostgres {
+		return
+	}
+
+	s.listener = newPgEventListener(s.dsn, s.notifier, s.logf)
+}
+
+// logf logs with the logger of the database connection.
+func (s *sqlEventRepository) logf(format string, args ...interface{}) {
+	s.db.GetDB().Logger.Error(context.Background(), format, args...)
+}
+
+// defaultGapTimeout is zero on sqlite, which serialises write transactions so
+// ids become visible in order. Appends on postgres and mysql commit
+// concurrently and can leave gaps that fill in later.
+func (s *sqlEventRepository) defaultGapTimeout() time.Duration {
+	if s.db.Driver() == orm.OrmDriverSqlite {
+		return 0
+	}
+
+	return defaultGapTimeout
+}
+
+// Close stops listening for notifications and closes the database connection.
+func (s *sqlEventRepository) Close() error {
+	s.listenerMu.Lock()
+	s.closed = true
+	listener := s.listener
+	s.listenerMu.Unlock()
+
+	if listener != nil {
+		if err := listener.Close(); err != nil {
+			return err
+		}
+	}
+
+	db, err := s.db.GetDB().DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+// asSqlEventRepository returns the repository as a sql event repository, the
+// stores sharing the database of the event repository are constructed from it.
+func asSqlEventRepository(repo EventRepository) (*sqlEventRepository, error) {
+	sqlRepo, ok := repo.(*sqlEventRepository)
+	if !ok {
+		return nil, fmt.Errorf("a sql event repository is required, got %T", repo)
+	}
+
+	return sqlRepo, nil
+}
+
+// sqlDB returns the database of a sql event repository.
+func sqlDB(repo EventRepository) (orm.DB, error) {
+	sqlRepo, err := asSqlEventRepository(repo)
+	if err != nil {
+		return nil, err
 	}
+
+	return sqlRepo.db, nil
 }
 
+// NewSqlEventRepository constructs an EventRepository backed by a sql database.
+//
+// Supported drivers are "postgres", "mysql" and "sqlite". The sqlite driver
+// accepts a file path or ":memory:" as dsn and creates its schema on open.
+//
+// The returned repository implements io.Closer, closing it releases the
+// database connections and, on postgres, the notification listener opened by
+// the first subscription.
 func NewSqlEventRepository(driver, dsn string, eventBus EventBus, debug ...bool) (EventRepository, error) {
 	var ormDriver orm.OrmDriver
 	switch driver {
@@ -462,6 +781,10 @@ func NewSqlEventRepository(driver, dsn string, eventBus EventBus, debug ...bool)
 		ormDriver = orm.OrmDriverPostgres
 	case "mysql":
 		ormDriver = orm.OrmDriverMysql
+	case "sqlite":
+		ormDriver = orm.OrmDriverSqlite
+	default:
+		return nil, fmt.Errorf("unsupported sql driver: %s", driver)
 	}
 
 	db, err := orm.New(ormDriver, dsn, debug...)
@@ -470,6 +793,8 @@ func NewSqlEventRepository(driver, dsn string, eventBus EventBus, debug ...bool)
 	}
 
 	return &sqlEventRepository{
-		db: db,
+		db:       db,
+		dsn:      dsn,
+		notifier: newAppendNotifier(),
 	}, nil
 }
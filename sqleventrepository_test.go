@@ -0,0 +1,214 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"gorm.io/gen/field"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SqlEventRepositorySuite{})
+
+type SqlEventRepositorySuite struct {
+	repo EventRepository
+	ctx  context.Context
+}
+
+func (s *SqlEventRepositorySuite) SetUpTest(c *C) {
+	repo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	s.repo = repo
+	s.ctx = context.Background()
+}
+
+func (s *SqlEventRepositorySuite) TestUnknownDriverReturnsAnError(c *C) {
+	repo, err := NewSqlEventRepository("oracle", "", NewInternalEventBus())
+
+	c.Assert(repo, IsNil)
+	c.Assert(err, NotNil)
+}
+
+func (s *SqlEventRepositorySuite) TestAppendAndReadStream(c *C) {
+	evs := []EventMessage{
+		NewEventMessage(nil, &SomeEvent{Item: "a", Count: 1}, nil),
+		NewEventMessage(nil, &SomeOtherEvent{OrderID: "b"}, nil),
+	}
+
+	err := s.repo.Append(s.ctx, "stream", evs, nil)
+	c.Assert(err, IsNil)
+
+	got, err := s.repo.Read(s.ctx).Stream("stream").Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(*got[0].EventID(), Equals, *evs[0].EventID())
+	c.Assert(got[0].Event().Name(), Equals, "SomeEvent")
+	c.Assert(got[0].Event().Data(), Equals, `{"item":"a","count":1}`)
+	c.Assert(*got[0].Version(), Equals, 1)
+	c.Assert(*got[1].EventID(), Equals, *evs[1].EventID())
+	c.Assert(*got[1].Version(), Equals, 2)
+}
+
+func (s *SqlEventRepositorySuite) TestHeadersAreRestoredOnRead(c *C) {
+	ev := NewEventMessage(nil, &SomeEvent{Item: "a", Count: 1}, nil)
+	ev.SetHeader("tenant", "acme")
+	ev.SetHeader("attempt", 2)
+	ev.SetHeader(HeaderCorrelationId, "flow-1")
+
+	c.Assert(s.repo.Append(s.ctx, "stream", []EventMessage{ev}, nil), IsNil)
+
+	got, err := s.repo.Read(s.ctx).Stream("stream").ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 1)
+
+	headers := got[0].GetHeaders()
+	c.Assert(headers["tenant"], Equals, "acme")
+	// Header values are decoded from JSON.
+	c.Assert(headers["attempt"], Equals, float64(2))
+	c.Assert(CorrelationId(headers), Equals, "flow-1")
+	c.Assert(headers[HeaderStreamId], Equals, "stream")
+}
+
+func (s *SqlEventRepositorySuite) TestReadFiltersByMetadata(c *C) {
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		ev := NewEventMessage(nil, &SomeEvent{Item: tenant}, nil)
+		ev.SetHeader("tenant", tenant)
+		c.Assert(s.repo.Append(s.ctx, "stream", []EventMessage{ev}, nil), IsNil)
+	}
+
+	got, err := s.repo.Read(s.ctx).Metadata("tenant", "acme").Forward().ToList()
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Assert(*got[0].Version(), Equals, 1)
+	c.Assert(*got[1].Version(), Equals, 3)
+
+	n, err := s.repo.Read(s.ctx).Stream("stream").Metadata("tenant", "globex").Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	n, err = s.repo.Read(s.ctx).Metadata("tenant", "acme").Metadata("missing", "x").Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *SqlEventRepositorySuite) TestCountAndLast(c *C) {
+	for i := 0; i < 3; i++ {
+		err := s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, nil)
+		c.Assert(err, IsNil)
+	}
+
+	count, err := s.repo.Read(s.ctx).Stream("stream").Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 3)
+
+	last, err := s.repo.Read(s.ctx).Last("stream")
+	c.Assert(err, IsNil)
+	c.Assert(*last.Version(), Equals, 3)
+}
+
+func (s *SqlEventRepositorySuite) TestLinkAndDeleteStream(c *C) {
+	ev := NewTestEventMessage(NewUUID())
+	err := s.repo.Append(s.ctx, "source", []EventMessage{ev}, nil)
+	c.Assert(err, IsNil)
+
+	err = s.repo.Link(s.ctx, "linked", []string{*ev.EventID()}, nil)
+	c.Assert(err, IsNil)
+
+	in, err := s.repo.IsEventInStream(s.ctx, "linked", *ev.EventID())
+	c.Assert(err, IsNil)
+	c.Assert(in, Equals, true)
+
+	err = s.repo.DeleteStream(s.ctx, "linked")
+	c.Assert(err, IsNil)
+
+	in, err = s.repo.IsEventInStream(s.ctx, "linked", *ev.EventID())
+	c.Assert(err, IsNil)
+	c.Assert(in, Equals, false)
+
+	has, err := s.repo.HasEvent(s.ctx, *ev.EventID())
+	c.Assert(err, IsNil)
+	c.Assert(has, Equals, true)
+}
+
+func (s *SqlEventRepositorySuite) TestAppendManyEventsWithExpectedVersion(c *C) {
+	evs := []EventMessage{NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())}
+	err := s.repo.Append(s.ctx, "stream", evs, Int(0))
+	c.Assert(err, IsNil)
+
+	evs = []EventMessage{NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())}
+	err = s.repo.Append(s.ctx, "stream", evs, Int(2))
+	c.Assert(err, IsNil)
+
+	last, err := s.repo.Read(s.ctx).Last("stream")
+	c.Assert(err, IsNil)
+	c.Assert(*last.Version(), Equals, 4)
+}
+
+func (s *SqlEventRepositorySuite) TestAppendWithWrongExpectedVersionFails(c *C) {
+	err := s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, Int(0))
+	c.Assert(err, IsNil)
+
+	err = s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, Int(0))
+	c.Assert(err, DeepEquals, &ErrConcurrencyViolation{
+		ExpectedVersion: Int(0),
+		ActualVersion:   Int(1),
+		StreamName:      "stream",
+	})
+
+	count, err := s.repo.Read(s.ctx).Stream("stream").Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 1)
+}
+
+func (s *SqlEventRepositorySuite) TestLinkWithWrongExpectedVersionFails(c *C) {
+	ev := NewTestEventMessage(NewUUID())
+	err := s.repo.Append(s.ctx, "stream", []EventMessage{ev}, nil)
+	c.Assert(err, IsNil)
+
+	err = s.repo.Link(s.ctx, "stream", []string{*ev.EventID()}, Int(0))
+	c.Assert(err, FitsTypeOf, &ErrConcurrencyViolation{})
+}
+
+func (s *SqlEventRepositorySuite) TestDuplicateStreamVersionIsUniqueViolation(c *C) {
+	ev := NewTestEventMessage(NewUUID())
+	err := s.repo.Append(s.ctx, "stream", []EventMessage{ev}, nil)
+	c.Assert(err, IsNil)
+
+	// A racing writer that read the same last version inserts the same stream version.
+	err = s.repo.(*sqlEventRepository).db.GetQuery().EventStream.WithContext(s.ctx).Omit(field.AssociationFields).Create(&model.EventStream{
+		StreamID:      "stream",
+		StreamVersion: 1,
+		EventID:       *ev.EventID(),
+	})
+	c.Assert(orm.IsUniqueViolation(err), Equals, true)
+}
+
+func (s *SqlEventRepositorySuite) TestUniqueViolationReportsActualVersion(c *C) {
+	c.Assert(s.repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())}, nil), IsNil)
+
+	// The violation of an append that clashed with a racing writer.
+	err := s.repo.(*sqlEventRepository).wrapStreamWriteError(s.ctx, &ErrConcurrencyViolation{
+		ExpectedVersion: Int(1),
+		StreamName:      "stream",
+	})
+	c.Assert(err, FitsTypeOf, &ErrConcurrencyViolation{})
+	c.Assert(*err.(*ErrConcurrencyViolation).ActualVersion, Equals, 2)
+}
+
+func (s *SqlEventRepositorySuite) TestDomainRepoReportsAggregateOnConcurrencyViolation(c *C) {
+	repo, err := NewSqlDomainRepository(s.repo, NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+
+	err = repo.Save(s.ctx, id, agg, Int(3))
+	c.Assert(err, FitsTypeOf, &ErrConcurrencyViolation{})
+	c.Assert(err.(*ErrConcurrencyViolation).Aggregate, Equals, agg)
+	c.Assert(err.Error(), Equals, fmt.Sprintf("ConcurrencyError: AggregateID: %s ExpectedVersion: 3 ActualVersion: 0 StreamName: %s", id, id))
+}
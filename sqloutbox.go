@@ -0,0 +1,486 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	parser "github.com/alfarih31/nb-go-parser"
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultOutboxRelayName         = "default"
+	defaultOutboxRelayBatchSize    = 100
+	defaultOutboxRelayPollInterval = time.Second
+	defaultOutboxRelayMinBackoff   = 100 * time.Millisecond
+	defaultOutboxRelayMaxBackoff   = 30 * time.Second
+	defaultOutboxRelayMaxAttempts  = 10
+)
+
+// OutboxRepository is implemented by event repositories that can record the
+// appended events in a transactional outbox.
+//
+// The outbox is written in the same transaction as the events, so an event is
+// relayed if and only if it was committed. SqlDomainRepo does not publish to
+// its EventBus when the outbox of its repository is enabled, the events are
+// published by an OutboxRelay instead.
+type OutboxRepository interface {
+	// EnableOutbox makes subsequent appends write to the outbox.
+	EnableOutbox()
+
+	// OutboxEnabled reports whether appends write to the outbox.
+	OutboxEnabled() bool
+}
+
+// OutboxPublisher is the interface the destination of an OutboxRelay implements.
+//
+// An event is only marked as relayed once Publish returned nil or it was
+// parked, a failed publish is retried with backoff.
+type OutboxPublisher interface {
+	Publish(ctx context.Context, event EventMessage) error
+}
+
+type eventBusPublisher struct {
+	bus EventBus
+}
+
+// NewEventBusPublisher returns an OutboxPublisher that publishes to an EventBus.
+//
+// Events whose handlers fail are retried by the relay.
+func NewEventBusPublisher(bus EventBus) OutboxPublisher {
+	return &eventBusPublisher{bus: bus}
+}
+
+func (p *eventBusPublisher) Publish(ctx context.Context, event EventMessage) error {
+	return p.bus.PublishEvent(ctx, event)
+}
+
+// OutboxRelayOptions configures an OutboxRelay.
+type OutboxRelayOptions struct {
+	// Name identifies the relay, every relay keeps its own marker of the last
+	// relayed position. Defaults to "default".
+	Name string
+
+	// BatchSize is the number of events read from the outbox at once.
+	// Defaults to 100.
+	BatchSize int
+
+	// PollInterval is the interval at which the outbox is polled for events
+	// appended by other processes. Defaults to one second.
+	PollInterval time.Duration
+
+	// MinBackoff and MaxBackoff bound the delay between retries of a failed
+	// publish, the delay doubles after every failure. They default to 100ms
+	// and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// EventFactory decodes the relayed events into their registered types.
+	// Without a factory events are published as raw events.
+	EventFactory EventFactory
+
+	// Upcasters bring events to their latest schema version before they are
+	// decoded by EventFactory.
+	Upcasters *UpcasterRegistry
+
+	// GapTimeout is how long the relay waits for a missing outbox id before it
+	// moves past it, see SubscriptionOptions.GapTimeout. Defaults to 5 seconds
+	// on postgres and mysql and to none on sqlite. A negative GapTimeout moves
+	// past gaps at once.
+	GapTimeout time.Duration
+
+	// Parker parks the events that can't be relayed, the events whose publish
+	// failed MaxAttempts times and the events that can't be decoded, so the
+	// relay moves on to the next event. Without a Parker a failed publish is
+	// retried until it succeeds and an event that can't be decoded holds up
+	// the relay.
+	Parker EventParker
+
+	// MaxAttempts is the number of times the publish of an event is attempted
+	// before the event is parked. It requires a Parker and defaults to 10 with
+	// one.
+	MaxAttempts int
+
+	// PruneRelayed makes Run delete the rows relayed by every relay known to
+	// the outbox, see Prune. It is only safe once every relay of the outbox
+	// was started.
+	PruneRelayed bool
+
+	// Logger logs the errors Run recovers from.
+	Logger Logger
+}
+
+// OutboxRelay drains the outbox of a sql event repository to an OutboxPublisher.
+//
+// Events are published in outbox order with at-least-once delivery: the
+// position of the last relayed event is stored after it was published, a relay
+// that stops in between publishes the event again when it restarts.
+type OutboxRelay struct {
+	db        orm.DB
+	repo      *sqlEventRepository
+	notifier  *appendNotifier
+	publisher OutboxPublisher
+	gaps      *gapTracker
+	options   OutboxRelayOptions
+}
+
+// NewSqlOutboxRelay constructs an OutboxRelay over the outbox of a sql event
+// repository.
+//
+// The relay only reads the outbox, writing to it is enabled on the repositories
+// appending the events with EnableOutbox.
+func NewSqlOutboxRelay(repo EventRepository, publisher OutboxPublisher, options OutboxRelayOptions) (*OutboxRelay, error) {
+	sqlRepo, err := asSqlEventRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if publisher == nil {
+		return nil, fmt.Errorf("nil OutboxPublisher injected into outbox relay")
+	}
+
+	if options.Name == "" {
+		options.Name = defaultOutboxRelayName
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultOutboxRelayBatchSize
+	}
+
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultOutboxRelayPollInterval
+	}
+
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = defaultOutboxRelayMinBackoff
+	}
+
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = defaultOutboxRelayMaxBackoff
+		if options.MaxBackoff < options.MinBackoff {
+			options.MaxBackoff = options.MinBackoff
+		}
+	}
+
+	if options.Parker == nil && options.MaxAttempts > 0 {
+		return nil, fmt.Errorf("outbox relay MaxAttempts requires a Parker")
+	}
+
+	if options.Parker != nil && options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultOutboxRelayMaxAttempts
+	}
+
+	return &OutboxRelay{
+		repo:      sqlRepo,
+		db:        sqlRepo.db,
+		notifier:  sqlRepo.notifier,
+		publisher: publisher,
+		gaps:      newGapTracker(resolveGapTimeout(sqlRepo, options.GapTimeout)),
+		options:   options,
+	}, nil
+}
+
+// Position returns the outbox position of the last relayed event, 0 when
+// nothing was relayed yet.
+func (r *OutboxRelay) Position(ctx context.Context) (int, error) {
+	m, err := r.db.GetQuery().EventOutboxRelay.WithContext(ctx).Where(models.EventOutboxRelay.Name.Eq(r.options.Name)).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, nil
+		}
+
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return int(m.LastRelayedID), nil
+}
+
+// RelayPending publishes the events in the outbox after the last relayed
+// position and returns how many were published.
+//
+// A failed publish is retried with backoff until it succeeds, ctx is done or,
+// with a Parker, the event is parked after MaxAttempts. Events after an outbox
+// id that may still commit are left for a later call, see GapTimeout.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	relayed, _, err := r.relayPending(ctx)
+	return relayed, err
+}
+
+// relayPending relays the pending events, the returned duration is positive
+// when events are held back behind a gap and tells when it times out.
+func (r *OutboxRelay) relayPending(ctx context.Context) (int, time.Duration, error) {
+	position, err := r.register(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !r.gaps.primed() {
+		// The gaps up to the last row are timed from the first read.
+		last, err := r.db.GetQuery().EventOutbox.WithContext(ctx).Order(models.EventOutbox.ID.Desc()).Limit(1).Find()
+		if err != nil {
+			return 0, 0, &ErrRepositoryExecution{
+				Err: err,
+			}
+		}
+
+		if len(last) > 0 {
+			r.gaps.observe(int(last[0].ID), time.Now())
+		}
+	}
+
+	relayed := 0
+	for {
+		rows, err := r.db.GetQuery().EventOutbox.WithContext(ctx).Where(models.EventOutbox.ID.Gt(int64(position))).Order(models.EventOutbox.ID).Limit(r.options.BatchSize).Find()
+		if err != nil {
+			return relayed, 0, &ErrRepositoryExecution{
+				Err: err,
+			}
+		}
+
+		ids := make([]int, len(rows))
+		for i, row := range rows {
+			ids[i] = int(row.ID)
+		}
+
+		n, wait := r.gaps.ready(position, ids, time.Now())
+		for _, row := range rows[:n] {
+			published, err := r.relay(ctx, row)
+			if err != nil {
+				return relayed, 0, err
+			}
+
+			if err := r.mark(ctx, row.ID); err != nil {
+				return relayed, 0, err
+			}
+
+			position = int(row.ID)
+			if published {
+				relayed++
+			}
+		}
+
+		if wait > 0 || len(rows) < r.options.BatchSize {
+			return relayed, wait, nil
+		}
+	}
+}
+
+// Run relays the outbox until ctx is cancelled.
+//
+// Appends made through the repository the relay was constructed from wake the
+// relay up immediately, appends of other processes are picked up by polling or,
+// on postgres, by LISTEN/NOTIFY. Errors are logged and the relay tries again
+// after MaxBackoff. With PruneRelayed, the rows relayed by every relay are
+// deleted after they were relayed. Run returns nil once ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	r.repo.listen()
+
+	for {
+		// Take the wake up channel before reading so an append that happens
+		// while the outbox is drained is not missed.
+		appended := r.notifier.wait()
+
+		interval := time.Duration(0)
+		if !r.notifier.isPushed() {
+			interval = r.options.PollInterval
+		}
+
+		relayed, wait, err := r.relayPending(ctx)
+		if err == nil && relayed > 0 && r.options.PruneRelayed {
+			_, err = r.Prune(ctx)
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			r.logf("outbox relay %s failed: %s", r.options.Name, err)
+			wait = r.options.MaxBackoff
+		}
+
+		if wait > 0 && (interval == 0 || wait < interval) {
+			interval = wait
+		}
+
+		var poll <-chan time.Time
+		if interval > 0 {
+			poll = time.After(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-appended:
+		case <-poll:
+		}
+	}
+}
+
+// Prune deletes the outbox rows relayed by every relay and returns how many
+// were deleted.
+//
+// Relays are known to the outbox once they first relayed or looked for events
+// to relay, and hold back the prune of the rows they did not relay from then
+// on. A relay that is started after a prune only relays the events appended
+// since.
+func (r *OutboxRelay) Prune(ctx context.Context) (int, error) {
+	markers, err := r.db.GetQuery().EventOutboxRelay.WithContext(ctx).Order(models.EventOutboxRelay.LastRelayedID).Limit(1).Find()
+	if err != nil {
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	if len(markers) == 0 {
+		return 0, nil
+	}
+
+	info, err := r.db.GetQuery().EventOutbox.WithContext(ctx).Where(models.EventOutbox.ID.Lte(markers[0].LastRelayedID)).Delete()
+	if err != nil {
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return int(info.RowsAffected), nil
+}
+
+// relay publishes the event of the row and reports whether it was published,
+// an event that can't be relayed is parked when the relay has a Parker.
+func (r *OutboxRelay) relay(ctx context.Context, row *model.EventOutbox) (bool, error) {
+	raw := r.rawEvent(row)
+
+	attempts := 0
+	ev, err := r.decode(raw)
+	if err == nil {
+		attempts, err = r.publish(ctx, ev)
+	}
+
+	if err == nil {
+		return true, nil
+	}
+
+	if ctx.Err() != nil || r.options.Parker == nil {
+		return false, err
+	}
+
+	if ev == nil {
+		ev = raw
+	}
+
+	if perr := r.options.Parker.ParkEvent(ctx, &HandlerFailure{
+		HandlerName: "outbox relay " + r.options.Name,
+		Event:       ev,
+		Err:         err,
+		Attempts:    attempts,
+	}); perr != nil {
+		return false, fmt.Errorf("parking event failed: %s, relay failed: %w", perr, err)
+	}
+
+	return false, nil
+}
+
+// publish publishes the event, retrying with exponential backoff until the
+// publish succeeds, MaxAttempts publishes failed or ctx is done. It returns
+// the number of attempts.
+func (r *OutboxRelay) publish(ctx context.Context, event EventMessage) (int, error) {
+	backoff := r.options.MinBackoff
+	for attempts := 1; ; attempts++ {
+		err := r.publisher.Publish(ctx, event)
+		if err == nil {
+			return attempts, nil
+		}
+
+		if r.options.MaxAttempts > 0 && attempts >= r.options.MaxAttempts {
+			return attempts, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > r.options.MaxBackoff {
+			backoff = r.options.MaxBackoff
+		}
+	}
+}
+
+func (r *OutboxRelay) logf(format string, args ...interface{}) {
+	if r.options.Logger != nil {
+		r.options.Logger.Printf(format, args...)
+	}
+}
+
+// mark stores id as the position of the last relayed event.
+// register records the marker of a relay that did not relay anything yet, so
+// that Prune keeps the rows it has still to relay, and returns its position.
+func (r *OutboxRelay) register(ctx context.Context) (int, error) {
+	position, err := r.Position(ctx)
+	if err != nil || position > 0 {
+		return position, err
+	}
+
+	err = r.db.GetQuery().EventOutboxRelay.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model.EventOutboxRelay{
+		Name:      r.options.Name,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return 0, nil
+}
+
+func (r *OutboxRelay) mark(ctx context.Context, id int64) error {
+	err := r.db.GetQuery().EventOutboxRelay.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: models.EventOutboxRelay.Name.ColumnName().String()}},
+		DoUpdates: clause.AssignmentColumns([]string{models.EventOutboxRelay.LastRelayedID.ColumnName().String(), models.EventOutboxRelay.UpdatedAt.ColumnName().String()}),
+	}).Create(&model.EventOutboxRelay{
+		Name:          r.options.Name,
+		LastRelayedID: id,
+		UpdatedAt:     time.Now(),
+	})
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+// rawEvent builds the event of the row as stored.
+func (r *OutboxRelay) rawEvent(m *model.EventOutbox) EventMessage {
+	meta := parseEventMetadata(m.Metadata)
+	em := NewEventMessage(&m.EventID, &RawEvent{
+		name:          m.EventName,
+		data:          m.EventData,
+		schemaVersion: meta.SchemaVersion,
+	}, parser.Int(m.StreamVersion).ToIntPtr())
+	meta.setHeaders(em)
+	em.SetHeader(HeaderStreamId, m.StreamID)
+
+	return em
+}
+
+// decode decodes the event with the EventFactory of the relay, if any.
+func (r *OutboxRelay) decode(em EventMessage) (EventMessage, error) {
+	if r.options.EventFactory == nil {
+		return em, nil
+	}
+
+	return decodeEvent(r.options.EventFactory, r.options.Upcasters, em)
+}
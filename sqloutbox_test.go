@@ -0,0 +1,342 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SqlOutboxSuite{})
+
+type SqlOutboxSuite struct {
+	eventBus  *InternalEventBus
+	eventRepo EventRepository
+	repo      DomainRepository
+	factory   EventFactory
+	ctx       context.Context
+}
+
+func (s *SqlOutboxSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+	s.eventBus = NewInternalEventBus()
+
+	var err error
+	s.eventRepo, err = NewSqlEventRepository("sqlite", ":memory:", s.eventBus)
+	c.Assert(err, IsNil)
+	s.eventRepo.(OutboxRepository).EnableOutbox()
+
+	s.repo, err = NewSqlDomainRepository(s.eventRepo, s.eventBus)
+	c.Assert(err, IsNil)
+
+	s.factory = NewDelegateEventFactory()
+	s.factory.RegisterDelegate("SomeEvent",
+		func() Event { return &SomeEvent{} })
+	s.repo.SetEventFactory(s.factory)
+}
+
+func (s *SqlOutboxSuite) saveAggregate(c *C, n int) string {
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	for i := 0; i < n; i++ {
+		agg.TrackChange(NewEventMessage(nil, &SomeEvent{Item: id, Count: i}, nil))
+	}
+
+	c.Assert(s.repo.Save(s.ctx, id, agg, Int(0)), IsNil)
+
+	return id
+}
+
+func (s *SqlOutboxSuite) TestSaveDefersPublishingToRelay(c *C) {
+	handler := &FakeEventHandler{}
+	s.eventBus.AddHandler(handler, "SomeEvent")
+
+	id := s.saveAggregate(c, 2)
+	c.Assert(handler.Events, HasLen, 0)
+
+	relay, err := NewSqlOutboxRelay(s.eventRepo, NewEventBusPublisher(s.eventBus), OutboxRelayOptions{
+		EventFactory: s.factory,
+	})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(handler.Events, HasLen, 2)
+	c.Assert(handler.Events[0].Event(), FitsTypeOf, &SomeEvent{})
+	c.Assert(*handler.Events[1].Version(), Equals, 2)
+
+	streamId, _ := EventStreamId(handler.Events[1])
+	c.Assert(streamId, Equals, id)
+
+	position, err := relay.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 2)
+
+	// Relayed events are not published again.
+	n, err = relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *SqlOutboxSuite) TestFailedAppendWritesNoOutboxRows(c *C) {
+	id := s.saveAggregate(c, 1)
+
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewEventMessage(nil, &SomeEvent{Item: id}, nil))
+	err := s.repo.Save(s.ctx, id, agg, Int(0))
+	c.Assert(err, FitsTypeOf, &ErrConcurrencyViolation{})
+
+	publisher := &recordingPublisher{}
+	relay, err := NewSqlOutboxRelay(s.eventRepo, publisher, OutboxRelayOptions{})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(publisher.events, HasLen, 1)
+	c.Assert(publisher.events[0].Event().Name(), Equals, "SomeEvent")
+}
+
+func (s *SqlOutboxSuite) TestRelayRetriesFailedPublish(c *C) {
+	s.saveAggregate(c, 2)
+
+	publisher := &recordingPublisher{failures: 3}
+	relay, err := NewSqlOutboxRelay(s.eventRepo, publisher, OutboxRelayOptions{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(publisher.attempts, Equals, 5)
+	c.Assert(publisher.events, HasLen, 2)
+	c.Assert(*publisher.events[0].Version(), Equals, 1)
+}
+
+func (s *SqlOutboxSuite) TestRelaysKeepSeparateMarkers(c *C) {
+	s.saveAggregate(c, 3)
+
+	first, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{BatchSize: 2})
+	c.Assert(err, IsNil)
+	n, err := first.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	second, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{Name: "second"})
+	c.Assert(err, IsNil)
+	position, err := second.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 0)
+
+	n, err = second.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+}
+
+func (s *SqlOutboxSuite) TestRunRelaysNewEvents(c *C) {
+	publisher := &recordingPublisher{}
+	relay, err := NewSqlOutboxRelay(s.eventRepo, publisher, OutboxRelayOptions{
+		PollInterval: time.Hour,
+		PruneRelayed: true,
+	})
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+
+	s.saveAggregate(c, 2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for publisher.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(publisher.count(), Equals, 2)
+
+	// Run deletes the relayed rows with PruneRelayed.
+	for len(s.outboxRows(c)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(s.outboxRows(c), HasLen, 0)
+
+	cancel()
+	c.Assert(<-done, IsNil)
+}
+
+func (s *SqlOutboxSuite) TestRelayRequiresSqlRepository(c *C) {
+	_, err := NewSqlOutboxRelay(NewInMemoryEventRepository(), &recordingPublisher{}, OutboxRelayOptions{})
+	c.Assert(err, NotNil)
+}
+
+// outboxRows returns the ids of the rows in the outbox.
+func (s *SqlOutboxSuite) outboxRows(c *C) []int64 {
+	var ids []int64
+	c.Assert(s.eventRepo.(*sqlEventRepository).db.GetDB().Model(&model.EventOutbox{}).Order("id").Pluck("id", &ids).Error, IsNil)
+	return ids
+}
+
+func (s *SqlOutboxSuite) TestRowsCommittedOutOfOrderAreRelayed(c *C) {
+	s.saveAggregate(c, 1)
+	s.saveAggregate(c, 1)
+
+	// The first row was inserted first but commits after the second one.
+	db := s.eventRepo.(*sqlEventRepository).db.GetDB()
+	var first model.EventOutbox
+	c.Assert(db.First(&first, 1).Error, IsNil)
+	c.Assert(db.Delete(&model.EventOutbox{}, 1).Error, IsNil)
+
+	publisher := &recordingPublisher{}
+	relay, err := NewSqlOutboxRelay(s.eventRepo, publisher, OutboxRelayOptions{GapTimeout: time.Hour})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	c.Assert(db.Create(&first).Error, IsNil)
+
+	n, err = relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(*publisher.events[0].EventID(), Equals, first.EventID)
+}
+
+func (s *SqlOutboxSuite) TestPoisonEventIsParked(c *C) {
+	id := s.saveAggregate(c, 2)
+
+	parker := NewInMemoryDeadLetterStore()
+	publisher := &recordingPublisher{failures: 2}
+	relay, err := NewSqlOutboxRelay(s.eventRepo, publisher, OutboxRelayOptions{
+		MinBackoff:  time.Millisecond,
+		Parker:      parker,
+		MaxAttempts: 2,
+	})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(*publisher.events[0].Version(), Equals, 2)
+
+	letters, err := parker.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].AggregateID, Equals, id)
+	c.Assert(*letters[0].Version, Equals, 1)
+	c.Assert(letters[0].Handler, Equals, "outbox relay default")
+	c.Assert(letters[0].Attempts, Equals, 2)
+	c.Assert(letters[0].Error, Equals, "publish failed")
+
+	position, err := relay.Position(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, 2)
+}
+
+func (s *SqlOutboxSuite) TestUndecodableEventIsParked(c *C) {
+	s.saveAggregate(c, 1)
+
+	parker := NewInMemoryDeadLetterStore()
+	relay, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{
+		EventFactory: NewDelegateEventFactory(),
+		Parker:       parker,
+	})
+	c.Assert(err, IsNil)
+
+	n, err := relay.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	letters, err := parker.List(s.ctx, DeadLetterQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(letters, HasLen, 1)
+	c.Assert(letters[0].Name, Equals, "SomeEvent")
+	c.Assert(letters[0].Attempts, Equals, 0)
+}
+
+func (s *SqlOutboxSuite) TestMaxAttemptsRequiresParker(c *C) {
+	_, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{MaxAttempts: 3})
+	c.Assert(err, ErrorMatches, "outbox relay MaxAttempts requires a Parker")
+}
+
+func (s *SqlOutboxSuite) TestPruneKeepsRowsPendingForAnyRelay(c *C) {
+	s.saveAggregate(c, 2)
+
+	first, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{})
+	c.Assert(err, IsNil)
+	second, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{Name: "second"})
+	c.Assert(err, IsNil)
+
+	_, err = second.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+
+	s.saveAggregate(c, 1)
+	_, err = first.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+
+	pruned, err := first.Prune(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(pruned, Equals, 2)
+	c.Assert(s.outboxRows(c), DeepEquals, []int64{3})
+
+	n, err := second.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *SqlOutboxSuite) TestRelayThatDidNotRelayYetHoldsBackPrune(c *C) {
+	first, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{})
+	c.Assert(err, IsNil)
+	second, err := NewSqlOutboxRelay(s.eventRepo, &recordingPublisher{}, OutboxRelayOptions{Name: "second"})
+	c.Assert(err, IsNil)
+
+	// The second relay looks for events before any was appended.
+	n, err := second.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	s.saveAggregate(c, 2)
+	_, err = first.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+
+	pruned, err := first.Prune(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(pruned, Equals, 0)
+
+	n, err = second.RelayPending(s.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+}
+
+type recordingPublisher struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	events   []EventMessage
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event EventMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts++
+	if p.failures > 0 {
+		p.failures--
+		return fmt.Errorf("publish failed")
+	}
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.events)
+}
@@ -0,0 +1,170 @@
+package ycq
+
+import (
+	"context"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type sqlProcessedCommandStore struct {
+	db orm.DB
+}
+
+// NewSqlProcessedCommandStore constructs a ProcessedCommandStore that persists
+// processed commands in the processed_command table of the database of a sql
+// event repository.
+func NewSqlProcessedCommandStore(repo EventRepository) (ProcessedCommandStore, error) {
+	db, err := sqlDB(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlProcessedCommandStore{
+		db: db,
+	}, nil
+}
+
+func (s *sqlProcessedCommandStore) Get(ctx context.Context, commandID string) (*ProcessedCommand, error) {
+	m, err := s.db.GetQuery().ProcessedCommand.WithContext(ctx).Where(models.ProcessedCommand.CommandID.Eq(commandID)).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	command := &ProcessedCommand{
+		CommandID:   m.CommandID,
+		CommandName: m.CommandName,
+		Pending:     m.Pending,
+		ProcessedAt: m.ProcessedAt,
+	}
+	if m.Result != nil {
+		command.Result = *m.Result
+	}
+
+	return command, nil
+}
+
+// Claim inserts the pending row first, the primary key tells concurrent
+// claims apart: the row of the claim that lost the race is not inserted.
+func (s *sqlProcessedCommandStore) Claim(ctx context.Context, command *ProcessedCommand, staleBefore time.Time) (*ProcessedCommand, error) {
+	m := &model.ProcessedCommand{
+		CommandID:   command.CommandID,
+		CommandName: command.CommandName,
+		Pending:     true,
+		ProcessedAt: command.ProcessedAt,
+	}
+
+	if m.ProcessedAt.IsZero() {
+		m.ProcessedAt = time.Now()
+	}
+
+	res := s.db.GetDB().WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	if res.Error != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: res.Error,
+		}
+	}
+
+	if res.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	info, err := s.db.GetQuery().ProcessedCommand.WithContext(ctx).
+		Where(models.ProcessedCommand.CommandID.Eq(command.CommandID), models.ProcessedCommand.Pending.Is(true), models.ProcessedCommand.ProcessedAt.Lt(staleBefore)).
+		UpdateSimple(models.ProcessedCommand.CommandName.Value(m.CommandName), models.ProcessedCommand.ProcessedAt.Value(m.ProcessedAt))
+	if err != nil {
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	if info.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	existing, err := s.Get(ctx, command.CommandID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		// The claim that won the race was released in the meantime.
+		return &ProcessedCommand{CommandID: command.CommandID, CommandName: command.CommandName, Pending: true}, nil
+	}
+
+	return existing, nil
+}
+
+func (s *sqlProcessedCommandStore) Save(ctx context.Context, command *ProcessedCommand) error {
+	m := &model.ProcessedCommand{
+		CommandID:   command.CommandID,
+		CommandName: command.CommandName,
+		ProcessedAt: command.ProcessedAt,
+	}
+
+	if m.ProcessedAt.IsZero() {
+		m.ProcessedAt = time.Now()
+	}
+
+	if command.Result != "" {
+		result := command.Result
+		m.Result = &result
+	}
+
+	res := s.db.GetDB().WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	if res.Error != nil {
+		return &ErrRepositoryExecution{
+			Err: res.Error,
+		}
+	}
+
+	if res.RowsAffected == 1 {
+		return nil
+	}
+
+	_, err := s.db.GetQuery().ProcessedCommand.WithContext(ctx).
+		Where(models.ProcessedCommand.CommandID.Eq(command.CommandID), models.ProcessedCommand.Pending.Is(true)).
+		Select(models.ProcessedCommand.CommandName, models.ProcessedCommand.Result, models.ProcessedCommand.Pending, models.ProcessedCommand.ProcessedAt).
+		Updates(m)
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlProcessedCommandStore) Release(ctx context.Context, commandID string) error {
+	_, err := s.db.GetQuery().ProcessedCommand.WithContext(ctx).
+		Where(models.ProcessedCommand.CommandID.Eq(commandID), models.ProcessedCommand.Pending.Is(true)).
+		Delete()
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlProcessedCommandStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	info, err := s.db.GetQuery().ProcessedCommand.WithContext(ctx).Where(models.ProcessedCommand.ProcessedAt.Lt(before)).Delete()
+	if err != nil {
+		return 0, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return int(info.RowsAffected), nil
+}
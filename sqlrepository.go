@@ -6,65 +6,163 @@ import (
 	"github.com/jetbasrawi/go.cqrs/internal/transformer"
 )
 
+var _ SnapshotRepository = new(SqlDomainRepo)
+var _ UpcastingRepository = new(SqlDomainRepo)
+
 // SqlDomainRepo is an implementation of the DomainRepository
 // that uses Get for persistence
 type SqlDomainRepo struct {
 	*DomainRepositoryBase
-	repo EventRepository
+	repo            EventRepository
+	snapshotStore   SnapshotStore
+	snapshotPolicy  SnapshotPolicy
+	onSnapshotError func(ctx context.Context, err *ErrSnapshotFailed)
+	upcasters       *UpcasterRegistry
+}
+
+// SetUpcasters sets the upcasters applied to events before they are
+// instantiated by the EventFactory on Load.
+func (e *SqlDomainRepo) SetUpcasters(upcasters *UpcasterRegistry) {
+	e.upcasters = upcasters
+}
+
+// SetSnapshotStore enables snapshots for aggregates that implement Snapshotter.
+func (e *SqlDomainRepo) SetSnapshotStore(store SnapshotStore, policy SnapshotPolicy) {
+	e.snapshotStore = store
+	e.snapshotPolicy = policy
+}
+
+// OnSnapshotError sets the function the snapshots that could not be taken on
+// save are reported to.
+func (e *SqlDomainRepo) OnSnapshotError(handler func(ctx context.Context, err *ErrSnapshotFailed)) {
+	e.onSnapshotError = handler
 }
 
+// TakeSnapshot saves a snapshot of the aggregate at its current version.
+func (e *SqlDomainRepo) TakeSnapshot(ctx context.Context, streamId string, aggregate AggregateRoot) error {
+	if e.snapshotStore == nil {
+		return fmt.Errorf("the domain has no Snapshot Store")
+	}
+
+	snapshotter, ok := aggregate.(Snapshotter)
+	if !ok {
+		return fmt.Errorf("aggregate of type %s does not implement Snapshotter", TypeOf(aggregate))
+	}
+
+	data, err := snapshotter.MarshalSnapshot()
+	if err != nil {
+		return err
+	}
+
+	return e.snapshotStore.SaveSnapshot(ctx, &Snapshot{
+		StreamId: streamId,
+		Version:  aggregate.CurrentVersion(),
+		Data:     data,
+	})
+}
+
+// restoreSnapshot restores the aggregate from the latest snapshot of the stream
+// and returns the version it was restored at, 0 when there is no snapshot.
+func (e *SqlDomainRepo) restoreSnapshot(ctx context.Context, streamId string, aggregateRoot AggregateRoot) (int, error) {
+	snapshotter, ok := aggregateRoot.(Snapshotter)
+	if e.snapshotStore == nil || !ok {
+		return 0, nil
+	}
+
+	snapshot, err := e.snapshotStore.LoadSnapshot(ctx, streamId)
+	if err != nil || snapshot == nil {
+		return 0, err
+	}
+
+	if err := snapshotter.UnmarshalSnapshot(snapshot.Data); err != nil {
+		return 0, &ErrUnexpected{Err: err}
+	}
+	aggregateRoot.setVersion(snapshot.Version)
+
+	return snapshot.Version, nil
+}
+
+// Load rebuilds the aggregate from its stream.
+//
+// When a snapshot store is set and the aggregate implements Snapshotter, the
+// aggregate is restored from its latest snapshot and only the events appended
+// after the snapshot are replayed.
 func (e *SqlDomainRepo) Load(ctx context.Context, streamId string, aggregateRoot AggregateRoot) error {
 	if err := e.ValidateDependencies(); err != nil {
 		return err
 	}
 
-	msgs, err := e.repo.Read(ctx).Stream(streamId).Forward().ToList()
+	snapshotVersion, err := e.restoreSnapshot(ctx, streamId, aggregateRoot)
 	if err != nil {
 		return err
 	}
 
-	evs, err := transformer.ArrayTransformer[EventMessage, EventMessage](msgs, func(em EventMessage) (EventMessage, error) {
-		event := e.eventFactory.GetEvent(em.Event().Name())
-		if event == nil {
-			return nil, &ErrEventNotFound{
-				EventName: em.Event().Name(),
-			}
-		}
+	msgs, err := e.repo.Read(ctx).Stream(streamId).FromVersion(snapshotVersion + 1).Forward().ToList()
+	if err != nil {
+		return err
+	}
 
-		if err = event.Unmarshal(em.Event().Data().(string)); err != nil {
-			return nil, &ErrUnexpected{Err: err}
-		}
-		return NewEventMessage(em.EventID(), event, em.Version()), nil
+	evs, err := transformer.ArrayTransformer[EventMessage, EventMessage](msgs, func(em EventMessage) (EventMessage, error) {
+		return decodeEvent(e.eventFactory, e.upcasters, em)
 	})
 	if err != nil {
 		return err
 	}
 
-	aggregateRoot.RebuildFromEvents(evs)
-
-	return nil
+	return RebuildAggregate(aggregateRoot, evs)
 }
 
+// Save appends the changes of the aggregate to its stream and publishes them.
+//
+// All events are published even when a publish fails, the first publish error
+// is returned after the aggregate was persisted. A snapshot that can't be taken
+// does not fail the save, see OnSnapshotError.
 func (e *SqlDomainRepo) Save(ctx context.Context, streamId string, aggregate AggregateRoot, expectedVersion *int) error {
 	changes := aggregate.GetChanges()
+	for _, v := range changes {
+		stampEvent(ctx, v)
+		stampSchemaVersion(e.eventFactory, v.Event())
+	}
 
 	err := e.repo.Append(ctx, streamId, changes, expectedVersion)
 	if err != nil {
+		if e, ok := err.(*ErrConcurrencyViolation); ok {
+			e.Aggregate = aggregate
+		}
+
 		return err
 	}
 
 	// Set version to current version on saved
+	previousVersion := aggregate.OriginalVersion()
 	aggregate.setVersion(aggregate.CurrentVersion())
 	aggregate.ClearChanges()
 
-	for _, v := range changes {
-		e.eventBus.PublishEvent(v)
+	// With an outbox the events are published by the relay once committed.
+	var publishErr error
+	if o, ok := e.repo.(OutboxRepository); !ok || !o.OutboxEnabled() {
+		for _, v := range changes {
+			v.SetHeader(HeaderStreamId, streamId)
+			if err := e.eventBus.PublishEvent(ctx, v); err != nil && publishErr == nil {
+				publishErr = err
+			}
+		}
+	}
+
+	if _, ok := aggregate.(Snapshotter); ok && e.snapshotStore != nil && e.snapshotPolicy != nil &&
+		e.snapshotPolicy(aggregate, previousVersion, aggregate.CurrentVersion()) {
+		// The events are committed, a failed snapshot is only reported.
+		if err := e.TakeSnapshot(ctx, streamId, aggregate); err != nil && e.onSnapshotError != nil {
+			e.onSnapshotError(ctx, &ErrSnapshotFailed{StreamName: streamId, Err: err})
+		}
 	}
 
-	return nil
+	return publishErr
 }
 
 // NewSqlDomainRepository constructs a new CommonDomainRepository
+//
+// The returned repository implements SnapshotRepository and UpcastingRepository.
 func NewSqlDomainRepository(repo EventRepository, eventBus EventBus) (DomainRepository, error) {
 	if repo == nil {
 		return nil, fmt.Errorf("nil Eventstore injected into repository")
@@ -0,0 +1,224 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SqlDomainRepoSuite{})
+
+type SqlDomainRepoSuite struct {
+	eventBus *InternalEventBus
+	repo     DomainRepository
+}
+
+func (s *SqlDomainRepoSuite) SetUpTest(c *C) {
+	s.eventBus = NewInternalEventBus()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", s.eventBus)
+	c.Assert(err, IsNil)
+
+	s.repo, err = NewSqlDomainRepository(eventRepo, s.eventBus)
+	c.Assert(err, IsNil)
+
+	eventFactory := NewDelegateEventFactory()
+	eventFactory.RegisterDelegate("SomeEvent",
+		func() Event { return &SomeEvent{} })
+	s.repo.SetEventFactory(eventFactory)
+}
+
+func (s *SqlDomainRepoSuite) TestSaveAndLoadAggregate(c *C) {
+	handler := &FakeEventHandler{}
+	s.eventBus.AddHandler(handler, "SomeEvent")
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewEventMessage(nil, &SomeEvent{Item: "a", Count: 1}, nil))
+
+	err := s.repo.Save(context.Background(), id, agg, nil)
+	c.Assert(err, IsNil)
+	c.Assert(agg.GetChanges(), HasLen, 0)
+	c.Assert(handler.Events, HasLen, 1)
+
+	got := NewRebuildableAggregate(id)
+	err = s.repo.Load(context.Background(), id, got)
+	c.Assert(err, IsNil)
+	c.Assert(got.events, HasLen, 1)
+	c.Assert(got.CurrentVersion(), Equals, 1)
+}
+
+func (s *SqlDomainRepoSuite) TestSavePublishesWithContextOfCaller(c *C) {
+	handler := &recordingEventHandler{}
+	s.eventBus.AddHandler(handler, "SomeEvent")
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewEventMessage(nil, &SomeEvent{Item: "a", Count: 1}, nil))
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "trace")
+	c.Assert(s.repo.Save(ctx, id, agg, nil), IsNil)
+
+	c.Assert(handler.handledContexts(), HasLen, 1)
+	c.Assert(handler.handledContexts()[0].Value(testContextKey{}), Equals, "trace")
+}
+
+func (s *SqlDomainRepoSuite) TestLoadRestoresSnapshotAndReplaysTail(c *C) {
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", s.eventBus)
+	c.Assert(err, IsNil)
+	snapshotStore, err := NewSqlSnapshotStore(eventRepo)
+	c.Assert(err, IsNil)
+
+	repo, err := NewSqlDomainRepository(eventRepo, s.eventBus)
+	c.Assert(err, IsNil)
+	repo.SetEventFactory(NewDelegateEventFactory())
+	repo.(SnapshotRepository).SetSnapshotStore(snapshotStore, SnapshotEvery(5))
+
+	ctx := context.Background()
+	id := NewUUID()
+	agg := NewCountingAggregate(id)
+	for i := 0; i < 5; i++ {
+		agg.TrackChange(NewTestEventMessage(id))
+	}
+	c.Assert(repo.Save(ctx, id, agg, Int(0)), IsNil)
+
+	snapshot, err := snapshotStore.LoadSnapshot(ctx, id)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, DeepEquals, &Snapshot{StreamId: id, Version: 5, Data: "0"})
+
+	// The snapshot is of a fresh aggregate, replaying the whole stream would count 7.
+	agg.TrackChange(NewTestEventMessage(id))
+	agg.TrackChange(NewTestEventMessage(id))
+	c.Assert(repo.Save(ctx, id, agg, Int(5)), IsNil)
+
+	eventFactory := NewDelegateEventFactory()
+	eventFactory.RegisterDelegate("SomeEvent",
+		func() Event { return &SomeEvent{} })
+	repo.SetEventFactory(eventFactory)
+
+	got := NewCountingAggregate(id)
+	c.Assert(repo.Load(ctx, id, got), IsNil)
+	c.Assert(got.count, Equals, 2)
+	c.Assert(got.CurrentVersion(), Equals, 7)
+}
+
+func (s *SqlDomainRepoSuite) TestTakeSnapshotOnDemand(c *C) {
+	snapshotStore := NewInMemorySnapshotStore()
+	s.repo.(SnapshotRepository).SetSnapshotStore(snapshotStore, SnapshotOnDemand())
+
+	ctx := context.Background()
+	id := NewUUID()
+	agg := NewCountingAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+	c.Assert(s.repo.Save(ctx, id, agg, nil), IsNil)
+
+	snapshot, err := snapshotStore.LoadSnapshot(ctx, id)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, IsNil)
+
+	c.Assert(s.repo.(SnapshotRepository).TakeSnapshot(ctx, id, agg), IsNil)
+
+	snapshot, err = snapshotStore.LoadSnapshot(ctx, id)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Version, Equals, 1)
+}
+
+func (s *SqlDomainRepoSuite) TestTakeSnapshotRequiresSnapshotter(c *C) {
+	s.repo.(SnapshotRepository).SetSnapshotStore(NewInMemorySnapshotStore(), SnapshotOnDemand())
+
+	err := s.repo.(SnapshotRepository).TakeSnapshot(context.Background(), "stream", NewRebuildableAggregate(NewUUID()))
+	c.Assert(err, NotNil)
+}
+
+func (s *SqlDomainRepoSuite) TestFailedSnapshotDoesNotFailSave(c *C) {
+	var reported []*ErrSnapshotFailed
+	s.repo.(SnapshotRepository).SetSnapshotStore(&failingSnapshotStore{}, SnapshotEvery(1))
+	s.repo.(SnapshotRepository).OnSnapshotError(func(ctx context.Context, err *ErrSnapshotFailed) {
+		reported = append(reported, err)
+	})
+
+	id := NewUUID()
+	agg := NewCountingAggregate(id)
+	agg.TrackChange(NewTestEventMessage(id))
+	c.Assert(s.repo.Save(context.Background(), id, agg, nil), IsNil)
+	c.Assert(agg.OriginalVersion(), Equals, 1)
+
+	c.Assert(reported, HasLen, 1)
+	c.Assert(reported[0].StreamName, Equals, id)
+	c.Assert(reported[0].Err, ErrorMatches, "snapshot store unavailable")
+}
+
+func (s *SqlDomainRepoSuite) TestDeleteStreamDeletesSnapshots(c *C) {
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", s.eventBus)
+	c.Assert(err, IsNil)
+	defer eventRepo.(io.Closer).Close()
+
+	snapshotStore, err := NewSqlSnapshotStore(eventRepo)
+	c.Assert(err, IsNil)
+
+	ctx := context.Background()
+	c.Assert(eventRepo.Append(ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, nil), IsNil)
+	c.Assert(snapshotStore.SaveSnapshot(ctx, &Snapshot{StreamId: "stream", Version: 1, Data: "1"}), IsNil)
+	c.Assert(snapshotStore.SaveSnapshot(ctx, &Snapshot{StreamId: "other", Version: 1, Data: "1"}), IsNil)
+
+	c.Assert(eventRepo.DeleteStream(ctx, "stream"), IsNil)
+
+	snapshot, err := snapshotStore.LoadSnapshot(ctx, "stream")
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, IsNil)
+
+	snapshot, err = snapshotStore.LoadSnapshot(ctx, "other")
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, NotNil)
+}
+
+func (s *SqlDomainRepoSuite) TestDeleteStreamWithoutSnapshotTable(c *C) {
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", s.eventBus)
+	c.Assert(err, IsNil)
+	defer eventRepo.(io.Closer).Close()
+
+	// A database migrated before snapshots were introduced.
+	c.Assert(eventRepo.(*sqlEventRepository).db.GetDB().Exec("DROP TABLE snapshot_store").Error, IsNil)
+
+	ctx := context.Background()
+	c.Assert(eventRepo.Append(ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID())}, nil), IsNil)
+	c.Assert(eventRepo.DeleteStream(ctx, "stream"), IsNil)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// Fakes
+
+// failingSnapshotStore fails to save snapshots.
+type failingSnapshotStore struct{}
+
+func (s *failingSnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	return fmt.Errorf("snapshot store unavailable")
+}
+
+func (s *failingSnapshotStore) LoadSnapshot(ctx context.Context, streamId string) (*Snapshot, error) {
+	return nil, nil
+}
+
+func NewRebuildableAggregate(id string) *RebuildableAggregate {
+	return &RebuildableAggregate{
+		AggregateBase: NewAggregateBase(id),
+	}
+}
+
+type RebuildableAggregate struct {
+	*AggregateBase
+	events []EventMessage
+}
+
+func (t *RebuildableAggregate) Apply(event EventMessage) {
+	t.events = append(t.events, event)
+}
+
+func (t *RebuildableAggregate) RebuildFromEvents(events []EventMessage) {
+	for _, e := range events {
+		t.Apply(e)
+		t.IncrementVersion()
+	}
+}
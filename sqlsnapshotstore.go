@@ -0,0 +1,66 @@
+package ycq
+
+import (
+	"context"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	"github.com/jetbasrawi/go.cqrs/internal/orm/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type sqlSnapshotStore struct {
+	db orm.DB
+}
+
+// NewSqlSnapshotStore constructs a SnapshotStore that persists snapshots in the
+// snapshot_store table of the database of a sql event repository.
+//
+// The repository deletes the snapshots of the streams it deletes from then on.
+func NewSqlSnapshotStore(repo EventRepository) (SnapshotStore, error) {
+	sqlRepo, err := asSqlEventRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	sqlRepo.snapshots = true
+
+	return &sqlSnapshotStore{
+		db: sqlRepo.db,
+	}, nil
+}
+
+func (s *sqlSnapshotStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	// Snapshots are immutable, a snapshot of the same version is already up to date.
+	err := s.db.GetQuery().SnapshotStore.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model.SnapshotStore{
+		StreamID:      snapshot.StreamId,
+		StreamVersion: int32(snapshot.Version),
+		SnapshotData:  snapshot.Data,
+	})
+	if err != nil {
+		return &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlSnapshotStore) LoadSnapshot(ctx context.Context, streamId string) (*Snapshot, error) {
+	m, err := s.db.GetQuery().SnapshotStore.WithContext(ctx).Where(models.SnapshotStore.StreamID.Eq(streamId)).Order(models.SnapshotStore.StreamVersion.Desc()).Limit(1).First()
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+
+		return nil, &ErrRepositoryExecution{
+			Err: err,
+		}
+	}
+
+	return &Snapshot{
+		StreamId: m.StreamID,
+		Version:  int(m.StreamVersion),
+		Data:     m.SnapshotData,
+	}, nil
+}
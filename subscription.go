@@ -0,0 +1,445 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderPosition is the header set on events read from an EventRepository that
+	// holds the position of the event in the global $all stream.
+	//
+	// The position is the id of the event stream entry, it increases monotonically
+	// and is what subscriptions use as a checkpoint.
+	HeaderPosition = "position"
+
+	// HeaderStreamId is the header set on events read from an EventRepository that
+	// holds the id of the stream the event was read from.
+	HeaderStreamId = "stream_id"
+)
+
+const (
+	defaultSubscriptionPageSize     = 100
+	defaultSubscriptionPollInterval = time.Second
+	defaultGapTimeout               = 5 * time.Second
+)
+
+// EventPosition returns the position of an event read from an EventRepository
+// in the global $all stream.
+func EventPosition(event EventMessage) (int, bool) {
+	p, ok := event.GetHeaders()[HeaderPosition].(int)
+	return p, ok
+}
+
+// EventStreamId returns the id of the stream an event was read from.
+func EventStreamId(event EventMessage) (string, bool) {
+	s, ok := event.GetHeaders()[HeaderStreamId].(string)
+	return s, ok
+}
+
+// SubscriptionOptions configures a subscription to the global $all stream.
+//
+// The zero value subscribes from the beginning of the store with an unbuffered
+// channel.
+type SubscriptionOptions struct {
+	// FromPosition is the checkpoint to start from, only events with a position
+	// greater than FromPosition are delivered.
+	FromPosition int
+
+	// PageSize is the number of events read from the repository at once while
+	// catching up. Defaults to 100.
+	PageSize int
+
+	// BufferSize is the capacity of the events channel. A full channel stops the
+	// subscription from reading further pages until the consumer catches up.
+	BufferSize int
+
+	// PollInterval is the interval at which the repository is polled for new
+	// events that were not appended through this process. Defaults to one second.
+	//
+	// Postgres repositories push new events with LISTEN/NOTIFY and only poll
+	// while the notification connection is down.
+	PollInterval time.Duration
+
+	// GapTimeout is how long the subscription waits for a missing position
+	// before it moves past it.
+	//
+	// Positions are taken when an append starts, not when it commits, so an
+	// append that commits after a later one leaves a gap that fills in once it
+	// commits. Events after a gap are held back until the gap fills or times
+	// out; gaps left by rolled back appends or deleted streams never fill.
+	// Defaults to 5 seconds, repositories whose appends commit in position
+	// order, like the in memory and sqlite repositories, default to none. A
+	// negative GapTimeout moves past gaps at once.
+	GapTimeout time.Duration
+}
+
+// Subscription delivers the events of the global $all stream in position order.
+//
+// A subscription first replays the history after its checkpoint, then keeps
+// delivering events as they are appended.
+type Subscription interface {
+	// Events returns the channel the events are delivered on. The channel is
+	// closed when the subscription ends.
+	Events() <-chan EventMessage
+
+	// Err waits for the subscription to end and returns the error that ended it,
+	// it is nil when the subscription was closed or its context was cancelled.
+	Err() error
+
+	// Close ends the subscription and waits for it to stop.
+	Close()
+}
+
+// SubscribeFunc subscribes to the repository and calls handler for every event
+// until ctx is cancelled or handler returns an error.
+//
+// The next event is only read once handler has returned.
+func SubscribeFunc(ctx context.Context, repo EventRepository, options SubscriptionOptions, handler func(context.Context, EventMessage) error) error {
+	sub, err := repo.Subscribe(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for ev := range sub.Events() {
+		if err := handler(ctx, ev); err != nil {
+			return err
+		}
+	}
+
+	return sub.Err()
+}
+
+// appendNotifier wakes up subscriptions when events are appended to a repository.
+//
+// When appends from other processes are pushed to the notifier as well, e.g. by
+// a postgres listener, subscriptions stop polling until the push is lost.
+type appendNotifier struct {
+	mu     sync.Mutex
+	ch     chan struct{}
+	pushed bool
+}
+
+func newAppendNotifier() *appendNotifier {
+	return &appendNotifier{}
+}
+
+// wait returns a channel that is closed on the next call to notify.
+func (n *appendNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+
+	return n.ch
+}
+
+// notify wakes up everyone waiting.
+func (n *appendNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
+
+// setPushed records whether appends of all writers are pushed to the notifier.
+//
+// Waiters are woken up so they re-read and fall back to polling if needed.
+func (n *appendNotifier) setPushed(pushed bool) {
+	n.mu.Lock()
+	n.pushed = pushed
+	n.mu.Unlock()
+
+	n.notify()
+}
+
+func (n *appendNotifier) isPushed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.pushed
+}
+
+type subscription struct {
+	repo     EventRepository
+	notifier *appendNotifier
+	options  SubscriptionOptions
+	events   chan EventMessage
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+func newSubscription(ctx context.Context, repo EventRepository, notifier *appendNotifier, options SubscriptionOptions) (Subscription, error) {
+	if options.FromPosition < 0 {
+		return nil, fmt.Errorf("subscription position can't be negative")
+	}
+
+	if options.PageSize <= 0 {
+		options.PageSize = defaultSubscriptionPageSize
+	}
+
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultSubscriptionPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &subscription{
+		repo:     repo,
+		notifier: notifier,
+		options:  options,
+		events:   make(chan EventMessage, options.BufferSize),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+func (s *subscription) Events() <-chan EventMessage {
+	return s.events
+}
+
+func (s *subscription) Err() error {
+	<-s.done
+	return s.err
+}
+
+func (s *subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *subscription) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.events)
+
+	reader := newPositionReader(s.repo, s.options.GapTimeout)
+	position := s.options.FromPosition
+	for {
+		// Take the wake up channel before reading so an append that happens
+		// while the page is read is not missed.
+		appended := s.notifier.wait()
+
+		evs, more, wait, err := reader.read(ctx, position, s.options.PageSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.err = err
+			}
+			return
+		}
+
+		for _, ev := range evs {
+			select {
+			case s.events <- ev:
+			case <-ctx.Done():
+				return
+			}
+
+			if p, ok := EventPosition(ev); ok {
+				position = p
+			}
+		}
+
+		if more {
+			continue
+		}
+
+		// Polling is only needed while appends of other processes are not
+		// pushed, or to move past a gap that may never fill.
+		interval := time.Duration(0)
+		if !s.notifier.isPushed() {
+			interval = s.options.PollInterval
+		}
+		if wait > 0 && (interval == 0 || wait < interval) {
+			interval = wait
+		}
+
+		var poll <-chan time.Time
+		if interval > 0 {
+			poll = time.After(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-appended:
+		case <-poll:
+		}
+	}
+}
+
+// positionReader reads the events of the global $all stream in position order
+// without moving past the positions of appends that may still commit.
+type positionReader struct {
+	repo EventRepository
+	gaps *gapTracker
+}
+
+// newPositionReader constructs a positionReader that waits up to gapTimeout for
+// a missing position, see SubscriptionOptions.GapTimeout.
+func newPositionReader(repo EventRepository, gapTimeout time.Duration) *positionReader {
+	return &positionReader{
+		repo: repo,
+		gaps: newGapTracker(resolveGapTimeout(repo, gapTimeout)),
+	}
+}
+
+// read returns up to limit events after position that can be consumed in order.
+//
+// more reports that a full page was read and the next page can be read at
+// once. wait is positive when events are held back behind a gap, the read is
+// to be repeated once it elapsed or an append was announced.
+func (r *positionReader) read(ctx context.Context, position, limit int) (evs []EventMessage, more bool, wait time.Duration, err error) {
+	if !r.gaps.primed() {
+		// The gaps of the history up to the head are timed from the first
+		// read, so catching up waits for them once rather than page by page.
+		head, err := r.repo.Read(ctx).Backward().Limit(1).ToList()
+		if err != nil {
+			return nil, false, 0, err
+		}
+
+		if len(head) > 0 {
+			if p, ok := EventPosition(head[0]); ok {
+				r.gaps.observe(p, time.Now())
+			}
+		}
+	}
+
+	evs, err = r.repo.Read(ctx).FromId(position + 1).Forward().Limit(limit).ToList()
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	positions := make([]int, len(evs))
+	for i, ev := range evs {
+		positions[i], _ = EventPosition(ev)
+	}
+
+	n, wait := r.gaps.ready(position, positions, time.Now())
+	return evs[:n], wait == 0 && len(evs) == limit, wait, nil
+}
+
+// resolveGapTimeout returns the gap timeout to use for the repository given the
+// configured one.
+func resolveGapTimeout(repo EventRepository, timeout time.Duration) time.Duration {
+	switch {
+	case timeout < 0:
+		return 0
+	case timeout > 0:
+		return timeout
+	}
+
+	if r, ok := repo.(interface{ defaultGapTimeout() time.Duration }); ok {
+		return r.defaultGapTimeout()
+	}
+
+	return defaultGapTimeout
+}
+
+// gapTracker decides when a reader of an autoincrement column read in id order
+// moves past a missing id.
+//
+// Ids are taken when a row is inserted and become visible when its transaction
+// commits, so a reader can see an id before a lower id taken by a transaction
+// that commits later. A missing id is waited for until timeout passed since a
+// higher id was first seen, a transaction that did not commit by then is taken
+// for rolled back.
+type gapTracker struct {
+	mu      sync.Mutex
+	timeout time.Duration
+
+	// seen holds the highest ids read so far with the time they were first
+	// read, in increasing order.
+	seen []gapWatermark
+}
+
+type gapWatermark struct {
+	id int
+	at time.Time
+}
+
+func newGapTracker(timeout time.Duration) *gapTracker {
+	return &gapTracker{
+		timeout: timeout,
+	}
+}
+
+// primed reports whether an id was read yet, or gaps are not waited for.
+func (g *gapTracker) primed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.timeout <= 0 || len(g.seen) > 0
+}
+
+// observe records that id was read at now.
+func (g *gapTracker) observe(id int, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.observeLocked(id, now)
+}
+
+func (g *gapTracker) observeLocked(id int, now time.Time) {
+	if n := len(g.seen); n == 0 || g.seen[n-1].id < id {
+		g.seen = append(g.seen, gapWatermark{id: id, at: now})
+	}
+}
+
+// ready returns how many of the ids, read at now in increasing order after
+// position, can be consumed in order. When ids are held back behind a gap it
+// also returns how long until the gap times out.
+func (g *gapTracker) ready(position int, ids []int, now time.Time) (int, time.Duration) {
+	if g.timeout <= 0 {
+		return len(ids), 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(ids) > 0 {
+		g.observeLocked(ids[len(ids)-1], now)
+	}
+
+	// Watermarks at or below position are of no use anymore, the last one is
+	// kept so the head is not read again.
+	i := 0
+	for i < len(g.seen)-1 && g.seen[i].id <= position {
+		i++
+	}
+	g.seen = g.seen[i:]
+
+	expected := position + 1
+	for n, id := range ids {
+		if id > expected {
+			if wait := g.timeout - now.Sub(g.since(expected)); wait > 0 {
+				return n, wait
+			}
+		}
+		expected = id + 1
+	}
+
+	return len(ids), 0
+}
+
+// since returns when an id above the missing id was first read.
+func (g *gapTracker) since(missing int) time.Time {
+	for _, w := range g.seen {
+		if w.id > missing {
+			return w.at
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,223 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jetbasrawi/go.cqrs/internal/orm/model"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SubscriptionSuite{})
+
+type SubscriptionSuite struct {
+	ctx context.Context
+}
+
+func (s *SubscriptionSuite) SetUpTest(c *C) {
+	s.ctx = context.Background()
+}
+
+func (s *SubscriptionSuite) repositories(c *C) map[string]EventRepository {
+	sqlRepo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	return map[string]EventRepository{
+		"memory": NewInMemoryEventRepository(),
+		"sql":    sqlRepo,
+	}
+}
+
+func (s *SubscriptionSuite) receive(c *C, sub Subscription, n int) []EventMessage {
+	evs := []EventMessage{}
+	for len(evs) < n {
+		select {
+		case ev, ok := <-sub.Events():
+			c.Assert(ok, Equals, true)
+			evs = append(evs, ev)
+		case <-time.After(5 * time.Second):
+			c.Fatalf("timed out after receiving %d of %d events", len(evs), n)
+		}
+	}
+
+	return evs
+}
+
+func (s *SubscriptionSuite) TestCatchUpThenLive(c *C) {
+	for name, repo := range s.repositories(c) {
+		c.Log(name)
+		for i := 0; i < 5; i++ {
+			c.Assert(repo.Append(s.ctx, fmt.Sprintf("stream-%d", i%2), []EventMessage{NewTestEventMessage(NewUUID())}, nil), IsNil)
+		}
+
+		sub, err := repo.Subscribe(s.ctx, SubscriptionOptions{PageSize: 2, PollInterval: time.Hour})
+		c.Assert(err, IsNil)
+
+		history := s.receive(c, sub, 5)
+		for i, ev := range history {
+			p, ok := EventPosition(ev)
+			c.Assert(ok, Equals, true)
+			c.Assert(p, Equals, i+1)
+		}
+
+		live := NewTestEventMessage(NewUUID())
+		c.Assert(repo.Append(s.ctx, "stream-live", []EventMessage{live}, nil), IsNil)
+
+		got := s.receive(c, sub, 1)
+		c.Assert(*got[0].EventID(), Equals, *live.EventID())
+		streamId, _ := EventStreamId(got[0])
+		c.Assert(streamId, Equals, "stream-live")
+
+		sub.Close()
+		c.Assert(sub.Err(), IsNil)
+	}
+}
+
+func (s *SubscriptionSuite) TestStartsAfterCheckpoint(c *C) {
+	for name, repo := range s.repositories(c) {
+		c.Log(name)
+		evs := []EventMessage{NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())}
+		c.Assert(repo.Append(s.ctx, "stream", evs, nil), IsNil)
+
+		sub, err := repo.Subscribe(s.ctx, SubscriptionOptions{FromPosition: 2})
+		c.Assert(err, IsNil)
+
+		got := s.receive(c, sub, 1)
+		c.Assert(*got[0].EventID(), Equals, *evs[2].EventID())
+		sub.Close()
+	}
+}
+
+func (s *SubscriptionSuite) TestCancellingContextEndsSubscription(c *C) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	sub, err := NewInMemoryEventRepository().Subscribe(ctx, SubscriptionOptions{})
+	c.Assert(err, IsNil)
+
+	cancel()
+
+	_, ok := <-sub.Events()
+	c.Assert(ok, Equals, false)
+	c.Assert(sub.Err(), IsNil)
+}
+
+func (s *SubscriptionSuite) TestNegativePositionIsRejected(c *C) {
+	_, err := NewInMemoryEventRepository().Subscribe(s.ctx, SubscriptionOptions{FromPosition: -1})
+	c.Assert(err, NotNil)
+}
+
+func (s *SubscriptionSuite) TestSubscribeFuncStopsOnHandlerError(c *C) {
+	repo := NewInMemoryEventRepository()
+	c.Assert(repo.Append(s.ctx, "stream", []EventMessage{NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())}, nil), IsNil)
+
+	handled := 0
+	stop := fmt.Errorf("stop")
+	err := SubscribeFunc(s.ctx, repo, SubscriptionOptions{}, func(ctx context.Context, ev EventMessage) error {
+		handled++
+		return stop
+	})
+
+	c.Assert(err, Equals, stop)
+	c.Assert(handled, Equals, 1)
+}
+
+// uncommitStreamEntry removes the stream entry at the position of a sql
+// repository, as if the append that took the position had not committed yet,
+// and returns the function that commits it.
+func uncommitStreamEntry(c *C, repo EventRepository, position int) func() {
+	db := repo.(*sqlEventRepository).db.GetDB()
+
+	var entry model.EventStream
+	c.Assert(db.First(&entry, position).Error, IsNil)
+	c.Assert(db.Delete(&model.EventStream{}, position).Error, IsNil)
+
+	return func() {
+		c.Assert(db.Create(&entry).Error, IsNil)
+	}
+}
+
+func (s *SubscriptionSuite) TestAppendsCommittedOutOfOrderAreDelivered(c *C) {
+	repo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+	defer repo.(io.Closer).Close()
+
+	first, second := NewTestEventMessage(NewUUID()), NewTestEventMessage(NewUUID())
+	c.Assert(repo.Append(s.ctx, "stream-1", []EventMessage{first}, nil), IsNil)
+	c.Assert(repo.Append(s.ctx, "stream-2", []EventMessage{second}, nil), IsNil)
+
+	// The first append took position 1 but commits after the second one.
+	commit := uncommitStreamEntry(c, repo, 1)
+
+	sub, err := repo.Subscribe(s.ctx, SubscriptionOptions{PollInterval: 10 * time.Millisecond, GapTimeout: time.Hour})
+	c.Assert(err, IsNil)
+	defer sub.Close()
+
+	select {
+	case ev := <-sub.Events():
+		c.Fatalf("event at position %v delivered before the gap filled", ev.GetHeaders()[HeaderPosition])
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	commit()
+
+	got := s.receive(c, sub, 2)
+	c.Assert(*got[0].EventID(), Equals, *first.EventID())
+	c.Assert(*got[1].EventID(), Equals, *second.EventID())
+}
+
+func (s *SubscriptionSuite) TestGapIsSkippedAfterTimeout(c *C) {
+	repo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+	defer repo.(io.Closer).Close()
+
+	c.Assert(repo.Append(s.ctx, "stream-1", []EventMessage{NewTestEventMessage(NewUUID())}, nil), IsNil)
+	second := NewTestEventMessage(NewUUID())
+	c.Assert(repo.Append(s.ctx, "stream-2", []EventMessage{second}, nil), IsNil)
+
+	// The append that took position 1 rolled back.
+	uncommitStreamEntry(c, repo, 1)
+
+	start := time.Now()
+	sub, err := repo.Subscribe(s.ctx, SubscriptionOptions{PollInterval: time.Hour, GapTimeout: 50 * time.Millisecond})
+	c.Assert(err, IsNil)
+	defer sub.Close()
+
+	got := s.receive(c, sub, 1)
+	c.Assert(*got[0].EventID(), Equals, *second.EventID())
+	c.Assert(time.Since(start) >= 50*time.Millisecond, Equals, true)
+}
+
+func (s *SubscriptionSuite) TestGapTrackerHoldsBackIdsAfterGap(c *C) {
+	now := time.Now()
+	gaps := newGapTracker(time.Second)
+
+	n, wait := gaps.ready(0, []int{1, 2, 4, 5}, now)
+	c.Assert(n, Equals, 2)
+	c.Assert(wait, Equals, time.Second)
+
+	// The gap fills in.
+	n, wait = gaps.ready(2, []int{3, 4, 5}, now.Add(100*time.Millisecond))
+	c.Assert(n, Equals, 3)
+	c.Assert(wait, Equals, time.Duration(0))
+
+	// A gap is timed from when a higher id was first seen.
+	n, wait = gaps.ready(5, []int{7}, now.Add(200*time.Millisecond))
+	c.Assert(n, Equals, 0)
+	c.Assert(wait, Equals, time.Second)
+
+	n, _ = gaps.ready(5, []int{7, 8}, now.Add(1200*time.Millisecond))
+	c.Assert(n, Equals, 2)
+}
+
+func (s *SubscriptionSuite) TestGapTimeoutDefaults(c *C) {
+	sqlRepo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+	defer sqlRepo.(io.Closer).Close()
+
+	c.Assert(resolveGapTimeout(NewInMemoryEventRepository(), 0), Equals, time.Duration(0))
+	c.Assert(resolveGapTimeout(sqlRepo, 0), Equals, time.Duration(0))
+	c.Assert(resolveGapTimeout(struct{ EventRepository }{sqlRepo}, 0), Equals, defaultGapTimeout)
+	c.Assert(resolveGapTimeout(sqlRepo, time.Minute), Equals, time.Minute)
+	c.Assert(resolveGapTimeout(sqlRepo, -1), Equals, time.Duration(0))
+}
@@ -0,0 +1,198 @@
+package ycq
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// EventCodec serialises the payload of an event to the string persisted by an
+// EventRepository and back.
+type EventCodec interface {
+	Marshal(v interface{}) (string, error)
+	Unmarshal(rawString string, v interface{}) error
+}
+
+// JSONCodec is the default EventCodec, it encodes payloads with encoding/json.
+var JSONCodec EventCodec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) (string, error) {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(jb), nil
+}
+
+func (jsonCodec) Unmarshal(rawString string, v interface{}) error {
+	return json.Unmarshal([]byte(rawString), v)
+}
+
+var _ Event = new(TypedEvent[struct{}])
+
+// TypedEvent is a generic Event that carries a name and a payload of type T.
+//
+// The payload is a plain Go value, TypedEvent takes care of serialising it with
+// its codec, JSONCodec unless another codec is given.
+type TypedEvent[T any] struct {
+	name          string
+	data          T
+	codec         EventCodec
+	schemaVersion int
+}
+
+// NewTypedEvent returns a TypedEvent named after the type of the payload.
+func NewTypedEvent[T any](data T, codec ...EventCodec) *TypedEvent[T] {
+	return NewNamedTypedEvent(TypedEventName[T](), data, codec...)
+}
+
+// NewNamedTypedEvent returns a TypedEvent with the given name.
+func NewNamedTypedEvent[T any](name string, data T, codec ...EventCodec) *TypedEvent[T] {
+	e := &TypedEvent[T]{
+		name:  name,
+		data:  data,
+		codec: JSONCodec,
+	}
+	if len(codec) > 0 && codec[0] != nil {
+		e.codec = codec[0]
+	}
+
+	return e
+}
+
+// TypedEventName returns the name NewTypedEvent gives to events with a payload
+// of type T, the name of T without its package. Pointers are dereferenced.
+func TypedEventName[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+// TypedEventOption configures the registration of a TypedEvent.
+type TypedEventOption func(*typedEventOptions)
+
+type typedEventOptions struct {
+	codec   EventCodec
+	version int
+}
+
+// WithCodec registers the event with the codec its payload is serialised with.
+func WithCodec(codec EventCodec) TypedEventOption {
+	return func(o *typedEventOptions) {
+		o.codec = codec
+	}
+}
+
+// WithVersion registers the current schema version of the event.
+//
+// The version is kept by the delegate registered with the factory: events
+// decoded by the factory report it, as they are upcast to it first, and events
+// of that name saved by a repository using the factory are persisted at it
+// unless set otherwise with WithSchemaVersion.
+func WithVersion(version int) TypedEventOption {
+	return func(o *typedEventOptions) {
+		o.version = version
+	}
+}
+
+// RegisterTypedEvent registers a delegate for TypedEvent[T] under the name of
+// T so events created with NewTypedEvent can be read back.
+func RegisterTypedEvent[T any](factory EventFactory, options ...TypedEventOption) error {
+	return RegisterNamedTypedEvent[T](factory, TypedEventName[T](), options...)
+}
+
+// RegisterNamedTypedEvent registers a delegate for TypedEvent[T] under the
+// given name.
+func RegisterNamedTypedEvent[T any](factory EventFactory, name string, options ...TypedEventOption) error {
+	o := &typedEventOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	return factory.RegisterDelegate(name, func() Event {
+		var zero T
+		return NewNamedTypedEvent(name, zero, o.codec).WithSchemaVersion(o.version)
+	})
+}
+
+// Name returns the name of the event.
+func (e *TypedEvent[T]) Name() string {
+	return e.name
+}
+
+// Data returns the payload as an interface{}.
+func (e *TypedEvent[T]) Data() interface{} {
+	return e.data
+}
+
+// Payload returns the typed payload.
+func (e *TypedEvent[T]) Payload() T {
+	return e.data
+}
+
+// WithSchemaVersion sets the schema version the payload is persisted with and
+// returns the event, overriding the version registered with WithVersion.
+func (e *TypedEvent[T]) WithSchemaVersion(version int) *TypedEvent[T] {
+	e.schemaVersion = version
+	return e
+}
+
+// SchemaVersion returns the schema version of the payload: the version set with
+// WithSchemaVersion or by the factory the event was created with, else 1.
+func (e *TypedEvent[T]) SchemaVersion() int {
+	if e.schemaVersion > 0 {
+		return e.schemaVersion
+	}
+
+	return 1
+}
+
+// defaultSchemaVersion sets the schema version of an event that was not given
+// one.
+func (e *TypedEvent[T]) defaultSchemaVersion(version int) {
+	if e.schemaVersion == 0 {
+		e.schemaVersion = version
+	}
+}
+
+// stampSchemaVersion gives an event raised without a schema version the version
+// its name is registered with in the factory.
+func stampSchemaVersion(factory EventFactory, event Event) {
+	e, ok := event.(interface{ defaultSchemaVersion(int) })
+	if !ok || factory == nil {
+		return
+	}
+
+	if registered := factory.GetEvent(event.Name()); registered != nil {
+		e.defaultSchemaVersion(EventSchemaVersion(registered))
+	}
+}
+
+// Marshal serialises the payload with the codec of the event.
+func (e *TypedEvent[T]) Marshal() (string, error) {
+	return e.getCodec().Marshal(e.data)
+}
+
+// Unmarshal replaces the payload with the one decoded from rawString.
+func (e *TypedEvent[T]) Unmarshal(rawString string) error {
+	var data T
+	if err := e.getCodec().Unmarshal(rawString, &data); err != nil {
+		return err
+	}
+	e.data = data
+
+	return nil
+}
+
+func (e *TypedEvent[T]) getCodec() EventCodec {
+	if e.codec == nil {
+		return JSONCodec
+	}
+
+	return e.codec
+}
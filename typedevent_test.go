@@ -0,0 +1,146 @@
+package ycq
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&TypedEventSuite{})
+
+type TypedEventSuite struct{}
+
+type ItemAdded struct {
+	Item  string `json:"item"`
+	Count int    `json:"count"`
+}
+
+// base64Codec wraps the JSON encoding in base64 to tell it apart from JSONCodec.
+type base64Codec struct{}
+
+func (base64Codec) Marshal(v interface{}) (string, error) {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(jb), nil
+}
+
+func (base64Codec) Unmarshal(rawString string, v interface{}) error {
+	jb, err := base64.StdEncoding.DecodeString(rawString)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(jb, v)
+}
+
+func (s *TypedEventSuite) TestNameDefaultsToPayloadType(c *C) {
+	c.Assert(NewTypedEvent(ItemAdded{}).Name(), Equals, "ItemAdded")
+	c.Assert(NewTypedEvent(&ItemAdded{}).Name(), Equals, "ItemAdded")
+	c.Assert(NewNamedTypedEvent("Added", ItemAdded{}).Name(), Equals, "Added")
+}
+
+func (s *TypedEventSuite) TestJsonRoundTrip(c *C) {
+	ev := NewTypedEvent(ItemAdded{Item: "a", Count: 2})
+
+	data, err := ev.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, `{"item":"a","count":2}`)
+
+	got := NewTypedEvent(ItemAdded{})
+	c.Assert(got.Unmarshal(data), IsNil)
+	c.Assert(got.Payload(), Equals, ItemAdded{Item: "a", Count: 2})
+	c.Assert(got.Data(), Equals, ItemAdded{Item: "a", Count: 2})
+}
+
+func (s *TypedEventSuite) TestPointerPayloadRoundTrip(c *C) {
+	got := NewTypedEvent[*ItemAdded](nil)
+	c.Assert(got.Unmarshal(`{"item":"a","count":2}`), IsNil)
+	c.Assert(got.Payload(), DeepEquals, &ItemAdded{Item: "a", Count: 2})
+}
+
+func (s *TypedEventSuite) TestCustomCodec(c *C) {
+	ev := NewTypedEvent(ItemAdded{Item: "a"}, base64Codec{})
+
+	data, err := ev.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(data, Not(Equals), `{"item":"a","count":0}`)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory, WithCodec(base64Codec{})), IsNil)
+
+	got := factory.GetEvent("ItemAdded")
+	c.Assert(got.Unmarshal(data), IsNil)
+	c.Assert(got.Data(), Equals, ItemAdded{Item: "a"})
+}
+
+func (s *TypedEventSuite) TestRegisterTwiceFails(c *C) {
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](factory, "ItemAdded"), NotNil)
+}
+
+func (s *TypedEventSuite) TestRegisteredVersionIsReported(c *C) {
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](factory, "VersionedItemAdded", WithVersion(2)), IsNil)
+
+	c.Assert(EventSchemaVersion(factory.GetEvent("VersionedItemAdded")), Equals, 2)
+	c.Assert(NewNamedTypedEvent("VersionedItemAdded", ItemAdded{}).SchemaVersion(), Equals, 1)
+	c.Assert(NewNamedTypedEvent("VersionedItemAdded", ItemAdded{}).WithSchemaVersion(3).SchemaVersion(), Equals, 3)
+
+	event := NewNamedTypedEvent("VersionedItemAdded", ItemAdded{})
+	stampSchemaVersion(factory, event)
+	c.Assert(event.SchemaVersion(), Equals, 2)
+
+	event = NewNamedTypedEvent("VersionedItemAdded", ItemAdded{}).WithSchemaVersion(1)
+	stampSchemaVersion(factory, event)
+	c.Assert(event.SchemaVersion(), Equals, 1)
+}
+
+func (s *TypedEventSuite) TestVersionIsKeptPerFactory(c *C) {
+	first, second := NewDelegateEventFactory(), NewDelegateEventFactory()
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](first, "VersionedItemAdded", WithVersion(2)), IsNil)
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](second, "VersionedItemAdded", WithVersion(3)), IsNil)
+
+	c.Assert(EventSchemaVersion(first.GetEvent("VersionedItemAdded")), Equals, 2)
+	c.Assert(EventSchemaVersion(second.GetEvent("VersionedItemAdded")), Equals, 3)
+}
+
+func (s *TypedEventSuite) TestRoundTripThroughSqlRepository(c *C) {
+	ctx := context.Background()
+	eventBus := NewInternalEventBus()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", eventBus)
+	c.Assert(err, IsNil)
+
+	repo, err := NewSqlDomainRepository(eventRepo, eventBus)
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAdded](factory), IsNil)
+	repo.SetEventFactory(factory)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewEventMessage(nil, NewTypedEvent(ItemAdded{Item: "a", Count: 2}), nil))
+	c.Assert(repo.Save(ctx, id, agg, Int(0)), IsNil)
+
+	got := NewRebuildableAggregate(id)
+	c.Assert(repo.Load(ctx, id, got), IsNil)
+	c.Assert(got.events, HasLen, 1)
+	c.Assert(got.events[0].Event(), FitsTypeOf, &TypedEvent[ItemAdded]{})
+	c.Assert(got.events[0].Event().(*TypedEvent[ItemAdded]).Payload(), Equals, ItemAdded{Item: "a", Count: 2})
+
+	// Raw events read from the repository can be appended again.
+	raw, err := eventRepo.Read(ctx).Stream(id).ToList()
+	c.Assert(err, IsNil)
+	c.Assert(eventRepo.Append(ctx, "copy", []EventMessage{NewEventMessage(nil, raw[0].Event(), nil)}, Int(0)), IsNil)
+
+	copied, err := eventRepo.Read(ctx).Stream("copy").ToList()
+	c.Assert(err, IsNil)
+	c.Assert(copied[0].Event().Data(), Equals, `{"item":"a","count":2}`)
+}
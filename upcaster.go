@@ -0,0 +1,146 @@
+package ycq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Upcaster transforms the serialised payload of an event from one schema
+// version to the next.
+type Upcaster func(rawString string) (string, error)
+
+// UpcastJSON returns an Upcaster that edits a JSON object payload in place,
+// e.g. to rename or default fields.
+func UpcastJSON(fn func(payload map[string]interface{}) error) Upcaster {
+	return func(rawString string) (string, error) {
+		payload := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(rawString), &payload); err != nil {
+			return "", err
+		}
+
+		if err := fn(payload); err != nil {
+			return "", err
+		}
+
+		return JSONCodec.Marshal(payload)
+	}
+}
+
+type upcasterKey struct {
+	eventName     string
+	schemaVersion int
+}
+
+type upcastStep struct {
+	toName   string
+	upcaster Upcaster
+}
+
+// UpcasterRegistry holds the upcasters of every event name and schema version.
+//
+// Upcasters are chained, an event persisted at version 1 goes through the
+// upcasters of version 1, 2 and so on until no upcaster is registered for its
+// name and version. Every step increments the version, a step may also rename
+// the event so that later steps and the EventFactory see the new name.
+type UpcasterRegistry struct {
+	sync.RWMutex
+	steps map[upcasterKey]upcastStep
+}
+
+// UpcastingRepository is implemented by domain repositories that upcast events
+// before they are instantiated by the EventFactory.
+type UpcastingRepository interface {
+	SetUpcasters(upcasters *UpcasterRegistry)
+}
+
+// NewUpcasterRegistry constructs an empty UpcasterRegistry.
+func NewUpcasterRegistry() *UpcasterRegistry {
+	return &UpcasterRegistry{
+		steps: make(map[upcasterKey]upcastStep),
+	}
+}
+
+// Register registers an upcaster that transforms events named eventName from
+// fromVersion to fromVersion+1.
+func (r *UpcasterRegistry) Register(eventName string, fromVersion int, upcaster Upcaster) error {
+	if upcaster == nil {
+		return fmt.Errorf("nil upcaster registered for event: \"%s\"", eventName)
+	}
+
+	return r.RegisterRename(eventName, fromVersion, eventName, upcaster)
+}
+
+// RegisterRename registers an upcaster that transforms events named eventName
+// from fromVersion to newName at fromVersion+1. A nil upcaster only renames
+// the event.
+func (r *UpcasterRegistry) RegisterRename(eventName string, fromVersion int, newName string, upcaster Upcaster) error {
+	if eventName == "" || newName == "" {
+		return fmt.Errorf("upcasters require an event name")
+	}
+
+	if fromVersion < 1 {
+		return fmt.Errorf("schema versions start at 1, got %d", fromVersion)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	key := upcasterKey{eventName: eventName, schemaVersion: fromVersion}
+	if _, ok := r.steps[key]; ok {
+		return fmt.Errorf("Upcaster already registered for event: \"%s\" version: %d", eventName, fromVersion)
+	}
+
+	r.steps[key] = upcastStep{
+		toName:   newName,
+		upcaster: upcaster,
+	}
+
+	return nil
+}
+
+// Upcast brings a raw event to the latest schema version registered.
+//
+// The event is returned as is when no upcaster applies.
+func (r *UpcasterRegistry) Upcast(event *RawEvent) (*RawEvent, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	name, version := event.Name(), event.SchemaVersion()
+	data, err := event.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	upcasted := false
+	for {
+		step, ok := r.steps[upcasterKey{eventName: name, schemaVersion: version}]
+		if !ok {
+			break
+		}
+
+		if step.upcaster != nil {
+			if data, err = step.upcaster(data); err != nil {
+				return nil, &ErrUpcastFailed{
+					EventName:     name,
+					SchemaVersion: version,
+					Err:           err,
+				}
+			}
+		}
+
+		name = step.toName
+		version++
+		upcasted = true
+	}
+
+	if !upcasted {
+		return event, nil
+	}
+
+	return &RawEvent{
+		name:          name,
+		data:          data,
+		schemaVersion: version,
+	}, nil
+}
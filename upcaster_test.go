@@ -0,0 +1,191 @@
+package ycq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&UpcasterSuite{})
+
+type UpcasterSuite struct {
+	upcasters *UpcasterRegistry
+}
+
+func (s *UpcasterSuite) SetUpTest(c *C) {
+	s.upcasters = NewUpcasterRegistry()
+}
+
+type ItemAddedV1 struct {
+	Name string `json:"name"`
+}
+
+type ItemAddedV3 struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+func (s *UpcasterSuite) registerChain(c *C) {
+	// v1 -> v2 renames the name field to item.
+	c.Assert(s.upcasters.Register("ItemAdded", 1, UpcastJSON(func(p map[string]interface{}) error {
+		p["item"] = p["name"]
+		delete(p, "name")
+		return nil
+	})), IsNil)
+
+	// v2 -> v3 renames the event and defaults the quantity.
+	c.Assert(s.upcasters.RegisterRename("ItemAdded", 2, "ItemAddedV3", UpcastJSON(func(p map[string]interface{}) error {
+		p["quantity"] = 1
+		return nil
+	})), IsNil)
+}
+
+func (s *UpcasterSuite) TestUpcastChainsVersions(c *C) {
+	s.registerChain(c)
+
+	got, err := s.upcasters.Upcast(NewRawEvent("ItemAdded", `{"name":"a"}`))
+	c.Assert(err, IsNil)
+	c.Assert(got.Name(), Equals, "ItemAddedV3")
+	c.Assert(got.SchemaVersion(), Equals, 3)
+	c.Assert(got.Data(), Equals, `{"item":"a","quantity":1}`)
+}
+
+func (s *UpcasterSuite) TestUpcastStartsAtPersistedVersion(c *C) {
+	s.registerChain(c)
+
+	got, err := s.upcasters.Upcast(&RawEvent{name: "ItemAdded", data: `{"item":"a"}`, schemaVersion: 2})
+	c.Assert(err, IsNil)
+	c.Assert(got.Name(), Equals, "ItemAddedV3")
+	c.Assert(got.Data(), Equals, `{"item":"a","quantity":1}`)
+}
+
+func (s *UpcasterSuite) TestUpcastWithoutUpcasterReturnsEvent(c *C) {
+	s.registerChain(c)
+
+	ev := NewRawEvent("SomeEvent", `{}`)
+	got, err := s.upcasters.Upcast(ev)
+	c.Assert(err, IsNil)
+	c.Assert(got, Equals, ev)
+}
+
+func (s *UpcasterSuite) TestRenameOnly(c *C) {
+	c.Assert(s.upcasters.RegisterRename("Old", 1, "New", nil), IsNil)
+
+	got, err := s.upcasters.Upcast(NewRawEvent("Old", `{"a":1}`))
+	c.Assert(err, IsNil)
+	c.Assert(got.Name(), Equals, "New")
+	c.Assert(got.Data(), Equals, `{"a":1}`)
+}
+
+func (s *UpcasterSuite) TestRegisterValidates(c *C) {
+	s.registerChain(c)
+
+	c.Assert(s.upcasters.Register("ItemAdded", 1, UpcastJSON(func(map[string]interface{}) error { return nil })), NotNil)
+	c.Assert(s.upcasters.Register("ItemAdded", 0, UpcastJSON(func(map[string]interface{}) error { return nil })), NotNil)
+	c.Assert(s.upcasters.Register("ItemAdded", 5, nil), NotNil)
+}
+
+func (s *UpcasterSuite) TestUpcasterErrorIsReported(c *C) {
+	c.Assert(s.upcasters.Register("ItemAdded", 1, func(string) (string, error) {
+		return "", fmt.Errorf("bad payload")
+	}), IsNil)
+
+	_, err := s.upcasters.Upcast(NewRawEvent("ItemAdded", `{}`))
+	c.Assert(err, DeepEquals, &ErrUpcastFailed{EventName: "ItemAdded", SchemaVersion: 1, Err: fmt.Errorf("bad payload")})
+}
+
+func (s *UpcasterSuite) TestLoadUpcastsPersistedEvents(c *C) {
+	ctx := context.Background()
+	eventBus := NewInternalEventBus()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", eventBus)
+	c.Assert(err, IsNil)
+
+	repo, err := NewSqlDomainRepository(eventRepo, eventBus)
+	c.Assert(err, IsNil)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAddedV3](factory, WithVersion(3)), IsNil)
+	repo.SetEventFactory(factory)
+	repo.(UpcastingRepository).SetUpcasters(s.upcasters)
+	s.registerChain(c)
+
+	// The first event was persisted before the schema changed, the second one
+	// is raised at the version registered for its type.
+	id := NewUUID()
+	old := NewRebuildableAggregate(id)
+	old.TrackChange(NewEventMessage(nil, NewNamedTypedEvent("ItemAdded", ItemAddedV1{Name: "a"}), nil))
+	old.TrackChange(NewEventMessage(nil, NewTypedEvent(ItemAddedV3{Item: "b", Quantity: 2}), nil))
+	c.Assert(repo.Save(ctx, id, old, Int(0)), IsNil)
+
+	got := NewRebuildableAggregate(id)
+	c.Assert(repo.Load(ctx, id, got), IsNil)
+	c.Assert(got.events, HasLen, 2)
+	c.Assert(got.events[0].Event().(*TypedEvent[ItemAddedV3]).Payload(), Equals, ItemAddedV3{Item: "a", Quantity: 1})
+	c.Assert(got.events[1].Event().(*TypedEvent[ItemAddedV3]).Payload(), Equals, ItemAddedV3{Item: "b", Quantity: 2})
+	c.Assert(EventSchemaVersion(got.events[0].Event()), Equals, 3)
+	c.Assert(EventSchemaVersion(got.events[1].Event()), Equals, 3)
+
+	raw, err := eventRepo.Read(ctx).Stream(id).ToList()
+	c.Assert(err, IsNil)
+	c.Assert(EventSchemaVersion(raw[0].Event()), Equals, 1)
+	c.Assert(EventSchemaVersion(raw[1].Event()), Equals, 3)
+}
+
+func (s *UpcasterSuite) TestEventRaisedAtRegisteredVersionIsNotUpcast(c *C) {
+	ctx := context.Background()
+	eventBus := NewInternalEventBus()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", eventBus)
+	c.Assert(err, IsNil)
+
+	repo, err := NewSqlDomainRepository(eventRepo, eventBus)
+	c.Assert(err, IsNil)
+
+	// ItemCounted renamed its name field to item in version 2.
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterNamedTypedEvent[ItemAdded](factory, "ItemCounted", WithVersion(2)), IsNil)
+	c.Assert(s.upcasters.Register("ItemCounted", 1, UpcastJSON(func(p map[string]interface{}) error {
+		p["item"] = p["name"]
+		delete(p, "name")
+		return nil
+	})), IsNil)
+	repo.SetEventFactory(factory)
+	repo.(UpcastingRepository).SetUpcasters(s.upcasters)
+
+	id := NewUUID()
+	agg := NewRebuildableAggregate(id)
+	agg.TrackChange(NewEventMessage(nil, NewNamedTypedEvent("ItemCounted", ItemAdded{Item: "b", Count: 2}), nil))
+	c.Assert(repo.Save(ctx, id, agg, Int(0)), IsNil)
+
+	got := NewRebuildableAggregate(id)
+	c.Assert(repo.Load(ctx, id, got), IsNil)
+	c.Assert(got.events, HasLen, 1)
+	c.Assert(got.events[0].Event().(*TypedEvent[ItemAdded]).Payload(), Equals, ItemAdded{Item: "b", Count: 2})
+}
+
+func (s *UpcasterSuite) TestLoadWithoutUpcastersFailsOnRenamedEvent(c *C) {
+	ctx := context.Background()
+	eventBus := NewInternalEventBus()
+
+	eventRepo, err := NewSqlEventRepository("sqlite", ":memory:", eventBus)
+	c.Assert(err, IsNil)
+
+	repo, err := NewSqlDomainRepository(eventRepo, eventBus)
+	c.Assert(err, IsNil)
+
+	id := NewUUID()
+	old := NewRebuildableAggregate(id)
+	old.TrackChange(NewEventMessage(nil, NewNamedTypedEvent("ItemAdded", ItemAddedV1{Name: "a"}), nil))
+	c.Assert(repo.Save(ctx, id, old, Int(0)), IsNil)
+
+	factory := NewDelegateEventFactory()
+	c.Assert(RegisterTypedEvent[ItemAddedV3](factory), IsNil)
+	repo.SetEventFactory(factory)
+
+	err = repo.Load(ctx, id, NewRebuildableAggregate(id))
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(err.Error(), "ItemAdded"), Equals, true)
+}
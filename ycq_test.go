@@ -6,9 +6,47 @@
 package ycq
 
 import (
+	"io"
 	"testing"
 
 	. "gopkg.in/check.v1"
 )
 
 func Test(t *testing.T) { TestingT(t) }
+
+// repositoryFixture is embedded by the suites that run against the in memory
+// and the sql implementations of a store, see suiteForEveryRepository. The
+// repositories opened by a test are closed when the test ends.
+type repositoryFixture struct {
+	sql    bool
+	opened []EventRepository
+}
+
+// suiteForEveryRepository registers the suite returned by newSuite once with an
+// in memory and once with a sqlite fixture.
+func suiteForEveryRepository(newSuite func(fixture repositoryFixture) interface{}) []interface{} {
+	return []interface{}{
+		Suite(newSuite(repositoryFixture{})),
+		Suite(newSuite(repositoryFixture{sql: true})),
+	}
+}
+
+// openRepository opens an event repository for the test.
+func (f *repositoryFixture) openRepository(c *C) EventRepository {
+	if !f.sql {
+		return NewInMemoryEventRepository()
+	}
+
+	repo, err := NewSqlEventRepository("sqlite", ":memory:", NewInternalEventBus())
+	c.Assert(err, IsNil)
+
+	f.opened = append(f.opened, repo)
+	return repo
+}
+
+func (f *repositoryFixture) TearDownTest(c *C) {
+	for _, repo := range f.opened {
+		c.Assert(repo.(io.Closer).Close(), IsNil)
+	}
+	f.opened = nil
+}
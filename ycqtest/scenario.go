@@ -0,0 +1,357 @@
+// Package ycqtest provides a Given/When/Then harness to test aggregates and
+// command handlers.
+//
+// A scenario starts from the events of the past, acts through a command
+// handler or a method of the aggregate and asserts the events raised or the
+// error returned:
+//
+//	ycqtest.NewScenario(t, id).
+//		WithCommandHandler(func(repo ycq.DomainRepository) ycq.CommandHandler {
+//			return NewItemCommandHandler(repo)
+//		}).
+//		Given(&ItemCreated{ID: id}).
+//		When(ycq.NewCommandMessage(id, &RenameItem{Name: "new"})).
+//		Then(&ItemRenamed{ID: id, Name: "new"})
+//
+// Command handlers are given a domain repository backed by the in memory event
+// repository, holding the past events in the stream of the scenario.
+package ycqtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	ycq "github.com/jetbasrawi/go.cqrs"
+)
+
+// T is the part of *testing.T used by scenarios, it is also satisfied by the
+// *check.C of gopkg.in/check.v1.
+type T interface {
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Scenario is a Given/When/Then test of an aggregate or a command handler.
+//
+// When runs the scenario, Then and ThenError report the differences between
+// the expected and actual outcome to T.
+type Scenario struct {
+	t        T
+	helper   func()
+	ctx      context.Context
+	streamId string
+
+	given        []ycq.EventMessage
+	factory      ycq.EventFactory
+	newAggregate func(id string) ycq.AggregateRoot
+	newHandler   func(repo ycq.DomainRepository) ycq.CommandHandler
+
+	ran    bool
+	events []ycq.EventMessage
+	err    error
+}
+
+// NewScenario starts a scenario on the stream of the aggregate with the id.
+func NewScenario(t T, streamId string) *Scenario {
+	s := &Scenario{
+		t:        t,
+		helper:   func() {},
+		ctx:      context.Background(),
+		streamId: streamId,
+	}
+
+	// Marks the methods of the scenario as test helpers on *testing.T.
+	if h, ok := t.(interface{ Helper() }); ok {
+		s.helper = h.Helper
+	}
+
+	return s
+}
+
+// WithContext sets the context the command is dispatched with.
+func (s *Scenario) WithContext(ctx context.Context) *Scenario {
+	s.ctx = ctx
+	return s
+}
+
+// WithAggregate sets the constructor of the aggregate acted on by WhenAggregate.
+func (s *Scenario) WithAggregate(newAggregate func(id string) ycq.AggregateRoot) *Scenario {
+	s.newAggregate = newAggregate
+	return s
+}
+
+// WithCommandHandler sets the constructor of the command handler When
+// dispatches to.
+func (s *Scenario) WithCommandHandler(newHandler func(repo ycq.DomainRepository) ycq.CommandHandler) *Scenario {
+	s.newHandler = newHandler
+	return s
+}
+
+// WithEventFactory sets the factory the repository given to the command handler
+// decodes the past events with.
+//
+// By default the past events are decoded into copies of the events passed to
+// Given.
+func (s *Scenario) WithEventFactory(factory ycq.EventFactory) *Scenario {
+	s.factory = factory
+	return s
+}
+
+// Given sets the events of the past.
+func (s *Scenario) Given(events ...ycq.Event) *Scenario {
+	for _, event := range events {
+		s.given = append(s.given, ycq.NewEventMessage(nil, event, nil))
+	}
+
+	return s
+}
+
+// GivenMessages sets the events of the past with their headers.
+func (s *Scenario) GivenMessages(events ...ycq.EventMessage) *Scenario {
+	s.given = append(s.given, events...)
+	return s
+}
+
+// When handles the command with the command handler and records the events it
+// saved and the error it returned.
+func (s *Scenario) When(command ycq.CommandMessage) *Scenario {
+	s.helper()
+	if s.newHandler == nil {
+		s.t.Fatalf("ycqtest: When requires a command handler, see WithCommandHandler")
+		return s
+	}
+
+	eventRepo := ycq.NewInMemoryEventRepository()
+	if len(s.given) > 0 {
+		if err := eventRepo.Append(s.ctx, s.streamId, s.given, nil); err != nil {
+			s.t.Fatalf("ycqtest: appending the given events failed: %s", err)
+			return s
+		}
+	}
+
+	repo, err := ycq.NewSqlDomainRepository(eventRepo, ycq.NewInternalEventBus())
+	if err != nil {
+		s.t.Fatalf("ycqtest: creating the repository failed: %s", err)
+		return s
+	}
+	repo.SetEventFactory(s.eventFactory())
+
+	_, s.err = s.newHandler(repo).Handle(s.ctx, command)
+	s.ran = true
+
+	s.events, err = eventRepo.Read(s.ctx).FromId(len(s.given) + 1).Forward().ToList()
+	if err != nil {
+		s.t.Fatalf("ycqtest: reading the saved events failed: %s", err)
+	}
+
+	return s
+}
+
+// WhenAggregate rebuilds the aggregate from the given events, calls act with
+// it and records the changes of the aggregate and the error act returned.
+//
+// The given events are applied one at a time as the repositories load them,
+// an event the aggregate fails to apply, e.g. one without a handler registered
+// with ycq.On, fails the scenario.
+func (s *Scenario) WhenAggregate(act func(agg ycq.AggregateRoot) error) *Scenario {
+	s.helper()
+	if s.newAggregate == nil {
+		s.t.Fatalf("ycqtest: WhenAggregate requires an aggregate, see WithAggregate")
+		return s
+	}
+
+	agg := s.newAggregate(s.streamId)
+	for i, event := range s.given {
+		if err := ycq.RebuildAggregate(agg, []ycq.EventMessage{event}); err != nil {
+			s.t.Fatalf("ycqtest: applying given event %d (%s) failed: %s", i, event.Event().Name(), err)
+			return s
+		}
+	}
+
+	s.err = act(agg)
+	s.events = agg.GetChanges()
+	s.ran = true
+
+	return s
+}
+
+// Then asserts that the scenario raised the events, in order, and succeeded.
+//
+// Events are compared by name and serialised payload.
+func (s *Scenario) Then(expected ...ycq.Event) *Scenario {
+	s.helper()
+	messages := make([]ycq.EventMessage, len(expected))
+	for i, event := range expected {
+		messages[i] = ycq.NewEventMessage(nil, event, nil)
+	}
+
+	return s.ThenMessages(messages...)
+}
+
+// ThenMessages asserts that the scenario raised the events, in order, and
+// succeeded.
+//
+// Events are compared by name and serialised payload, the headers of the
+// expected events must be set on the actual events with equal values, other
+// headers of the actual events are ignored.
+func (s *Scenario) ThenMessages(expected ...ycq.EventMessage) *Scenario {
+	s.helper()
+	if !s.checkRan() {
+		return s
+	}
+
+	if s.err != nil {
+		s.t.Errorf("ycqtest: expected events, got error: %s\n%s", s.err, formatEvents("actual", s.events))
+		return s
+	}
+
+	if diff := diffEvents(expected, s.events); diff != "" {
+		s.t.Errorf("ycqtest: events do not match\n%s\n%s\n%s", diff, formatEvents("expected", expected), formatEvents("actual", s.events))
+	}
+
+	return s
+}
+
+// ThenError asserts that the scenario failed with an error equal to expected,
+// or with the same message, and raised no events.
+func (s *Scenario) ThenError(expected error) *Scenario {
+	s.helper()
+	if !s.checkRan() {
+		return s
+	}
+
+	switch {
+	case s.err == nil:
+		s.t.Errorf("ycqtest: expected error %q, got none\n%s", expected, formatEvents("actual", s.events))
+	case !reflect.DeepEqual(s.err, expected) && s.err.Error() != expected.Error():
+		s.t.Errorf("ycqtest: errors do not match\nexpected: %s\nactual:   %s", expected, s.err)
+	case len(s.events) > 0:
+		s.t.Errorf("ycqtest: expected no events with error %q\n%s", expected, formatEvents("actual", s.events))
+	}
+
+	return s
+}
+
+// Events returns the events raised by the scenario.
+func (s *Scenario) Events() []ycq.EventMessage {
+	return s.events
+}
+
+// Err returns the error of the scenario.
+func (s *Scenario) Err() error {
+	return s.err
+}
+
+func (s *Scenario) checkRan() bool {
+	if !s.ran {
+		s.t.Fatalf("ycqtest: Then called before When")
+	}
+
+	return s.ran
+}
+
+// eventFactory returns the factory of the scenario or one that returns copies
+// of the given events.
+func (s *Scenario) eventFactory() ycq.EventFactory {
+	if s.factory != nil {
+		return s.factory
+	}
+
+	factory := ycq.NewDelegateEventFactory()
+	for _, em := range s.given {
+		event := em.Event()
+		_ = factory.RegisterDelegate(event.Name(), func() ycq.Event {
+			return copyEvent(event)
+		})
+	}
+
+	return factory
+}
+
+// copyEvent returns a shallow copy of the event, so that decoding into the copy
+// does not change the given event.
+func copyEvent(event ycq.Event) ycq.Event {
+	v := reflect.ValueOf(event)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return event
+	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+
+	return c.Interface().(ycq.Event)
+}
+
+// diffEvents describes the differences between the expected and actual events,
+// it returns an empty string when they match.
+func diffEvents(expected, actual []ycq.EventMessage) string {
+	var diffs []string
+	if len(expected) != len(actual) {
+		diffs = append(diffs, fmt.Sprintf("expected %d events, got %d", len(expected), len(actual)))
+	}
+
+	for i := 0; i < len(expected) && i < len(actual); i++ {
+		e, a := expected[i], actual[i]
+		if e.Event().Name() != a.Event().Name() {
+			diffs = append(diffs, fmt.Sprintf("event %d: expected %s, got %s", i, e.Event().Name(), a.Event().Name()))
+			continue
+		}
+
+		if ed, ad := marshal(e.Event()), marshal(a.Event()); ed != ad {
+			diffs = append(diffs, fmt.Sprintf("event %d (%s): payloads differ\n  expected: %s\n  actual:   %s", i, e.Event().Name(), ed, ad))
+		}
+
+		for _, key := range sortedKeys(e.GetHeaders()) {
+			ev := e.GetHeaders()[key]
+			av, ok := a.GetHeaders()[key]
+			switch {
+			case !ok:
+				diffs = append(diffs, fmt.Sprintf("event %d (%s): header %q missing, expected %v", i, e.Event().Name(), key, ev))
+			case !reflect.DeepEqual(ev, av) && fmt.Sprint(ev) != fmt.Sprint(av):
+				diffs = append(diffs, fmt.Sprintf("event %d (%s): header %q expected %v, got %v", i, e.Event().Name(), key, ev, av))
+			}
+		}
+	}
+
+	return strings.Join(diffs, "\n")
+}
+
+func formatEvents(title string, events []ycq.EventMessage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:", title)
+	if len(events) == 0 {
+		b.WriteString(" none")
+	}
+
+	for i, em := range events {
+		fmt.Fprintf(&b, "\n  %d: %s %s", i, em.Event().Name(), marshal(em.Event()))
+		headers := em.GetHeaders()
+		for _, key := range sortedKeys(headers) {
+			fmt.Fprintf(&b, "\n       %s: %v", key, headers[key])
+		}
+	}
+
+	return b.String()
+}
+
+func marshal(event ycq.Event) string {
+	data, err := event.Marshal()
+	if err != nil {
+		return fmt.Sprintf("<marshal failed: %s>", err)
+	}
+
+	return data
+}
+
+func sortedKeys(headers map[string]interface{}) []string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
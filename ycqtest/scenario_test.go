@@ -0,0 +1,204 @@
+package ycqtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	ycq "github.com/jetbasrawi/go.cqrs"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&ScenarioSuite{})
+
+type ScenarioSuite struct{}
+
+type Opened struct {
+	ID string `json:"id"`
+}
+
+type Deposited struct {
+	Amount int `json:"amount"`
+}
+
+type Deposit struct {
+	Amount int
+}
+
+var errNotOpened = errors.New("account is not opened")
+
+// account is an aggregate routing its events with ycq.On.
+type account struct {
+	*ycq.AggregateBase
+	opened  bool
+	balance int
+}
+
+func newAccount(id string) ycq.AggregateRoot {
+	a := &account{AggregateBase: ycq.NewAggregateBase(id)}
+	ycq.On(a.AggregateBase, func(Opened) { a.opened = true })
+	ycq.On(a.AggregateBase, func(e Deposited) { a.balance += e.Amount })
+	return a
+}
+
+func (a *account) Apply(event ycq.EventMessage) {
+	_ = a.ApplyEvent(event)
+}
+
+func (a *account) RebuildFromEvents(events []ycq.EventMessage) {
+	_ = a.Rebuild(events)
+}
+
+func (a *account) Deposit(amount int) error {
+	if !a.opened {
+		return errNotOpened
+	}
+
+	return a.Raise(ycq.NewTypedEvent(Deposited{Amount: amount}))
+}
+
+type accountCommandHandler struct {
+	repo ycq.DomainRepository
+}
+
+func (h *accountCommandHandler) Handle(ctx context.Context, command ycq.CommandMessage) (any, error) {
+	a := newAccount(command.AggregateID()).(*account)
+	if err := h.repo.Load(ctx, command.AggregateID(), a); err != nil {
+		return nil, err
+	}
+
+	if err := a.Deposit(command.Command().(*Deposit).Amount); err != nil {
+		return nil, err
+	}
+
+	return nil, h.repo.Save(ctx, command.AggregateID(), a, ycq.Int(a.OriginalVersion()))
+}
+
+func newAccountCommandHandler(repo ycq.DomainRepository) ycq.CommandHandler {
+	return &accountCommandHandler{repo: repo}
+}
+
+// recordingT records the failures reported by a scenario.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+}
+
+func (s *ScenarioSuite) TestCommandHandlerScenario(c *C) {
+	id := ycq.NewUUID()
+
+	NewScenario(c, id).
+		WithCommandHandler(newAccountCommandHandler).
+		Given(ycq.NewTypedEvent(Opened{ID: id}), ycq.NewTypedEvent(Deposited{Amount: 5})).
+		When(ycq.NewCommandMessage(id, &Deposit{Amount: 10})).
+		Then(ycq.NewTypedEvent(Deposited{Amount: 10}))
+}
+
+func (s *ScenarioSuite) TestCommandHandlerScenarioWithError(c *C) {
+	id := ycq.NewUUID()
+
+	NewScenario(c, id).
+		WithCommandHandler(newAccountCommandHandler).
+		When(ycq.NewCommandMessage(id, &Deposit{Amount: 10})).
+		ThenError(errNotOpened)
+}
+
+func (s *ScenarioSuite) TestAggregateScenario(c *C) {
+	id := ycq.NewUUID()
+
+	NewScenario(c, id).
+		WithAggregate(newAccount).
+		Given(ycq.NewTypedEvent(Opened{ID: id})).
+		WhenAggregate(func(agg ycq.AggregateRoot) error {
+			return agg.(*account).Deposit(3)
+		}).
+		Then(ycq.NewTypedEvent(Deposited{Amount: 3}))
+}
+
+func (s *ScenarioSuite) TestHeadersAreCompared(c *C) {
+	id := ycq.NewUUID()
+	expected := ycq.NewEventMessage(nil, ycq.NewTypedEvent(Deposited{Amount: 10}), nil)
+	expected.SetHeader(ycq.HeaderActor, "alice")
+
+	NewScenario(c, id).
+		WithCommandHandler(newAccountCommandHandler).
+		WithContext(ycq.ContextWithActor(context.Background(), "alice")).
+		Given(ycq.NewTypedEvent(Opened{ID: id})).
+		When(ycq.NewCommandMessage(id, &Deposit{Amount: 10})).
+		ThenMessages(expected)
+
+	t := &recordingT{}
+	expected.SetHeader(ycq.HeaderActor, "bob")
+	NewScenario(t, id).
+		WithCommandHandler(newAccountCommandHandler).
+		Given(ycq.NewTypedEvent(Opened{ID: id})).
+		When(ycq.NewCommandMessage(id, &Deposit{Amount: 10})).
+		ThenMessages(expected)
+
+	c.Assert(t.errors, HasLen, 1)
+	c.Assert(t.errors[0], Matches, `(?s).*header "actor" missing, expected bob.*`)
+}
+
+func (s *ScenarioSuite) TestMismatchReportsReadableDiff(c *C) {
+	id := ycq.NewUUID()
+	t := &recordingT{}
+
+	NewScenario(t, id).
+		WithAggregate(newAccount).
+		Given(ycq.NewTypedEvent(Opened{ID: id})).
+		WhenAggregate(func(agg ycq.AggregateRoot) error {
+			return agg.(*account).Deposit(3)
+		}).
+		Then(ycq.NewTypedEvent(Deposited{Amount: 4}), ycq.NewTypedEvent(Deposited{Amount: 1}))
+
+	c.Assert(t.errors, HasLen, 1)
+	lines := strings.Split(t.errors[0], "\n")
+	c.Assert(lines[0], Equals, "ycqtest: events do not match")
+	c.Assert(lines[1], Equals, "expected 2 events, got 1")
+	c.Assert(lines[2], Equals, "event 0 (Deposited): payloads differ")
+	c.Assert(lines[3], Equals, `  expected: {"amount":4}`)
+	c.Assert(lines[4], Equals, `  actual:   {"amount":3}`)
+}
+
+func (s *ScenarioSuite) TestGivenEventWithoutHandlerFailsScenario(c *C) {
+	id := ycq.NewUUID()
+	t := &recordingT{}
+	acted := false
+
+	NewScenario(t, id).
+		WithAggregate(newAccount).
+		Given(ycq.NewTypedEvent(Opened{ID: id}), ycq.NewTypedEvent(Deposit{Amount: 3})).
+		WhenAggregate(func(agg ycq.AggregateRoot) error {
+			acted = true
+			return nil
+		})
+
+	c.Assert(acted, Equals, false)
+	c.Assert(t.errors, HasLen, 1)
+	c.Assert(t.errors[0], Matches, "ycqtest: applying given event 1 \\(Deposit\\) failed: .*")
+}
+
+func (s *ScenarioSuite) TestUnexpectedErrorIsReported(c *C) {
+	t := &recordingT{}
+
+	NewScenario(t, ycq.NewUUID()).
+		WithAggregate(newAccount).
+		WhenAggregate(func(agg ycq.AggregateRoot) error {
+			return agg.(*account).Deposit(3)
+		}).
+		Then(ycq.NewTypedEvent(Deposited{Amount: 3}))
+
+	c.Assert(t.errors, HasLen, 1)
+	c.Assert(t.errors[0], Matches, "ycqtest: expected events, got error: account is not opened(?s).*")
+}